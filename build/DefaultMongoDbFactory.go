@@ -7,6 +7,8 @@ import (
 )
 
 //DefaultMongoDbFactory helps creates MongoDb components by their descriptors.
+//Custom persistence components can be added with RegisterPersistence,
+//so containers are able to create them from configuration.
 //See Factory
 //See MongoDbConnection
 type DefaultMongoDbFactory struct {
@@ -23,3 +25,21 @@ func NewDefaultMongoDbFactory() *DefaultMongoDbFactory {
 	c.RegisterType(mongoDbConnectionDescriptor, conn.NewMongoDbConnection)
 	return &c
 }
+
+// RegisterPersistence registers a constructor of a persistence component,
+// so it can be created by the factory using a given descriptor.
+// Parameters:
+//   - descriptor *cref.Descriptor
+//   a descriptor to locate the persistence, e.g. mygroup:persistence:mongodb:default:1.0
+//   - constructor interface{}
+//   a function without parameters that returns a new persistence instance,
+//   e.g. NewMyMongoDbPersistence
+// Example:
+//   factory := build.NewDefaultMongoDbFactory()
+//   factory.RegisterPersistence(
+//       cref.NewDescriptor("mygroup", "persistence", "mongodb", "default", "1.0"),
+//       NewMyMongoDbPersistence,
+//   )
+func (c *DefaultMongoDbFactory) RegisterPersistence(descriptor *cref.Descriptor, constructor interface{}) {
+	c.RegisterType(descriptor, constructor)
+}
@@ -2,15 +2,29 @@ package connect
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
 	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
 	crefer "github.com/pip-services3-go/pip-services3-commons-go/refer"
+	cinfo "github.com/pip-services3-go/pip-services3-components-go/info"
 	clog "github.com/pip-services3-go/pip-services3-components-go/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
 	mongodrv "go.mongodb.org/mongo-driver/mongo"
 	mongoclopt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
 )
 
 /*
@@ -19,29 +33,65 @@ MongoDB connection using plain driver.
 
 By defining a connection and sharing it through multiple persistence components
 you can reduce number of used database connections.
+Shared connection also allows to run operations over multiple collections
+atomically using WithTransaction method (requires MongoDB replica set).
 
 Configuration parameters:
 
   - connection(s):
     - discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+    - protocol:                  (optional) connection protocol: mongodb or mongodb+srv (default: mongodb)
     - host:                      host name or IP address
-    - port:                      port number (default: 27017)
+    - port:                      port number (default: 27017), not used in mongodb+srv mode
     - uri:                       resource URI or connection string with all parameters in it
   - credential(s):
     - store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
     - username:                  (optional) user name
     - password:                  (optional) user password
+    credential values can refer to environment variables as ${ENV_VAR}, they are expanded on every connect
   - options:
     - max_pool_size:             (optional) maximum connection pool size (default: 2)
+    - min_pool_size:             (optional) minimum number of connections kept in the pool (default: 0)
+    - max_connecting:            (optional) maximum number of connections established concurrently (default: 2)
+    - wait_queue_timeout:        (optional) connection wait queue timeout in milliseconds (not used, limited by operation_timeout)
     - keep_alive:                (optional) enable connection keep alive in ms, if zero connection are keeped indefinitely (default: 0)
     - connect_timeout:           (optional) connection timeout in milliseconds (default: 5000)
     - socket_timeout:            (optional) socket timeout in milliseconds (default: 360000)
-    - auto_reconnect:            (optional) enable auto reconnection (default: true) (Not used)
-    - reconnect_interval:        (optional) reconnection interval in milliseconds (default: 1000) (Not used)
+    - auto_reconnect:            (optional) enable auto reconnection when connection is lost (default: true)
+    - reconnect_interval:        (optional) maximum interval between reconnection attempts in milliseconds (default: 1000)
+    - reconnect_attempts:        (optional) maximum number of reconnection attempts (default: 3)
+    - verify_on_open:            (optional) ping the server on open to fail fast on wrong hosts or credentials (default: true)
     - max_page_size:             (optional) maximum page size (default: 100)
     - replica_set:               (optional) name of replica set
-    - ssl:                       (optional) enable SSL connection (default: false) (Not release in this version)
+    - direct_connection:         (optional) connect directly to a single host without topology discovery,
+                                 cannot be combined with replica_set (default: false)
+    - load_balanced:             (optional) connect to a sharded cluster behind a load balancer,
+                                 cannot be combined with replica_set or direct_connection (default: false)
+    - write_concern:             (optional) write acknowledgement: number of nodes or majority
+    - journal:                   (optional) wait until writes are committed to the journal
+    - write_concern_timeout:     (optional) write concern timeout in milliseconds
+    - read_concern:              (optional) read isolation level: local, available, majority, linearizable or snapshot
+    - read_preference:           (optional) nodes to read from: primary, primaryPreferred, secondary, secondaryPreferred or nearest (default: primary)
+    - max_staleness_seconds:     (optional) maximum replication lag of secondaries to read from, at least 90 seconds,
+                                 cannot be used with primary read preference
+    - retry_writes:              (optional) retry writes once after transient errors, requires replica set (default: true)
+    - retry_reads:               (optional) retry reads once after transient errors (default: true)
+    - compressors:               (optional) comma separated list of wire compressors: zstd, snappy, zlib
+    - zlib_level:                (optional) zlib compression level from -1 to 9
+    - srv:                       (optional) use DNS seedlist (mongodb+srv) connection format (default: false)
+    - uri_options:               (optional) extra driver options appended to the connection URI as a section or a query string,
+                                 options above take precedence over them
+    - ssl:                       (optional) enable SSL connection (default: false)
+    - tls_ca_file:               (optional) path to PEM file with CA certificates (default: system cert pool)
+    - tls_cert_file:             (optional) path to PEM file with client certificate
+    - tls_key_file:              (optional) path to PEM file with client private key (default: tls_cert_file)
     - auth_source:               (optional) authentication source
+    - auth_user:                 (optional) authentication user name
+    - auth_password:             (optional) authentication user password
+    - auth_mechanism:            (optional) authentication mechanism: SCRAM-SHA-1, SCRAM-SHA-256, MONGODB-X509, etc.
+    - auth_mechanism_properties: (optional) authentication mechanism properties as comma separated key:value pairs
+    - app_name:                  (optional) application name reported to the server (default: context name)
+    - monitor:                   (optional) log connection pool and command events at debug level (default: false)
     - debug:                     (optional) enable debug output (default: false). (Not used)
 
 References:
@@ -49,10 +99,16 @@ References:
 - *:logger:*:*:1.0           (optional) ILogger components to pass log messages
 - *:discovery:*:*:1.0        (optional) IDiscovery services
 - *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+- *:context-info:*:*:1.0     (optional) ContextInfo to get default application name
 */
 type MongoDbConnection struct {
-	defaultConfig *cconf.ConfigParams
-	Ctx           context.Context
+	defaultConfig      *cconf.ConfigParams
+	appName            string
+	reconnectLock      *sync.Mutex
+	reconnectListeners []func(correlationId string)
+	openLock           *sync.Mutex
+	openCount          int
+	Ctx                context.Context
 	// The logger.
 	Logger *clog.CompositeLogger
 	//   The connection resolver.
@@ -76,7 +132,12 @@ func NewMongoDbConnection() *MongoDbConnection {
 			"options.keep_alive", "0",
 			"options.connect_timeout", "5000",
 			"options.max_page_size", "100",
+			"options.auto_reconnect", "true",
+			"options.reconnect_interval", "1000",
+			"options.reconnect_attempts", "3",
 		),
+		reconnectLock: &sync.Mutex{},
+		openLock:      &sync.Mutex{},
 		//The logger.
 		Logger: clog.NewCompositeLogger(),
 		//The connection resolver.
@@ -104,6 +165,13 @@ func (c *MongoDbConnection) Configure(config *cconf.ConfigParams) {
 func (c *MongoDbConnection) SetReferences(references crefer.IReferences) {
 	c.Logger.SetReferences(references)
 	c.ConnectionResolver.SetReferences(references)
+
+	// Use container name as default application name
+	contextInfo, ok := references.GetOneOptional(
+		crefer.NewDescriptor("pip-services", "context-info", "*", "*", "1.0")).(*cinfo.ContextInfo)
+	if ok && contextInfo != nil && contextInfo.Name != "" {
+		c.appName = contextInfo.Name
+	}
 }
 
 // IsOpen method is checks if the component is opened.
@@ -112,7 +180,15 @@ func (c *MongoDbConnection) IsOpen() bool {
 	return c.Connection != nil
 }
 
-func (c *MongoDbConnection) composeSettings(settings *mongoclopt.ClientOptions) {
+// ComposeSettings method composes MongoDB client options from the configuration options.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to trace execution through call chain.
+//   - settings *mongoclopt.ClientOptions
+//   client options to be filled.
+// Return error
+// error or nil when no errors occured.
+func (c *MongoDbConnection) ComposeSettings(correlationId string, settings *mongoclopt.ClientOptions) error {
 	maxPoolSize := (uint64)(c.Options.GetAsInteger("max_pool_size"))
 	keepAlive := c.Options.GetAsInteger("keep_alive")
 	MaxConnIdleTime := (time.Duration)(keepAlive) * time.Millisecond
@@ -125,8 +201,36 @@ func (c *MongoDbConnection) composeSettings(settings *mongoclopt.ClientOptions)
 	authSource := c.Options.GetAsString("auth_source")
 	authUser := c.Options.GetAsString("auth_user")
 	authPassword := c.Options.GetAsString("auth_password")
+	authMechanism := c.Options.GetAsString("auth_mechanism")
+	authMechanismProperties := c.Options.GetAsString("auth_mechanism_properties")
+
+	appName := c.Options.GetAsStringWithDefault("app_name", c.appName)
+	if appName != "" {
+		settings.SetAppName(appName)
+	}
 
 	settings.SetMaxPoolSize(maxPoolSize)
+	minPoolSize := c.Options.GetAsNullableInteger("min_pool_size")
+	if minPoolSize != nil {
+		if *minPoolSize < 0 || (maxPoolSize > 0 && (uint64)(*minPoolSize) > maxPoolSize) {
+			return cerror.NewConfigError(correlationId, "INVALID_MIN_POOL_SIZE",
+				"Minimum pool size must be between 0 and max_pool_size")
+		}
+		settings.SetMinPoolSize((uint64)(*minPoolSize))
+	}
+	maxConnecting := c.Options.GetAsNullableInteger("max_connecting")
+	if maxConnecting != nil {
+		if *maxConnecting < 0 {
+			return cerror.NewConfigError(correlationId, "INVALID_MAX_CONNECTING",
+				"Maximum number of connecting connections cannot be negative")
+		}
+		settings.SetMaxConnecting((uint64)(*maxConnecting))
+	}
+	// The driver does not support wait queue timeout, waiting for a connection
+	// is limited by the operation context instead
+	if c.Options.GetAsInteger("wait_queue_timeout") > 0 {
+		c.Logger.Warn(correlationId, "Option wait_queue_timeout is not supported by mongodb driver, use operation_timeout instead")
+	}
 	settings.SetMaxConnIdleTime(MaxConnIdleTime)
 	settings.SetConnectTimeout(ConnectTimeout)
 	settings.SetSocketTimeout(SocketTimeout)
@@ -135,75 +239,527 @@ func (c *MongoDbConnection) composeSettings(settings *mongoclopt.ClientOptions)
 		settings.SetReplicaSet(*replicaSet)
 	}
 
-	// TODO: Relase configure TLS(SSL) connection to MongoDB
-	// ssl := c.Options.GetAsNullableBoolean("ssl")
-	// if ssl != nil {
-	// 	settings.ssl = ssl
-	// }
+	// Direct connection skips discovery of replica set members
+	directConnection := c.Options.GetAsNullableBoolean("direct_connection")
+	if directConnection != nil {
+		if *directConnection && replicaSet != nil && *replicaSet != "" {
+			return cerror.NewConfigError(correlationId, "DIRECT_WITH_REPLICA_SET",
+				"Options direct_connection and replica_set cannot be used together")
+		}
+		settings.SetDirect(*directConnection)
+	}
+
+	// Load balanced mode for sharded clusters behind a proxy
+	loadBalanced := c.Options.GetAsNullableBoolean("load_balanced")
+	if loadBalanced != nil {
+		if *loadBalanced && replicaSet != nil && *replicaSet != "" {
+			return cerror.NewConfigError(correlationId, "LOAD_BALANCED_WITH_REPLICA_SET",
+				"Options load_balanced and replica_set cannot be used together")
+		}
+		if *loadBalanced && directConnection != nil && *directConnection {
+			return cerror.NewConfigError(correlationId, "LOAD_BALANCED_WITH_DIRECT",
+				"Options load_balanced and direct_connection cannot be used together")
+		}
+		settings.SetLoadBalanced(*loadBalanced)
+	}
+
+	// Write concern
+	writeConcern, err := c.composeWriteConcern(correlationId)
+	if err != nil {
+		return err
+	}
+	if writeConcern != nil {
+		settings.SetWriteConcern(writeConcern)
+	}
+
+	// Read concern
+	readConcern := c.Options.GetAsString("read_concern")
+	if readConcern != "" {
+		switch readConcern {
+		case "local", "available", "majority", "linearizable", "snapshot":
+			settings.SetReadConcern(readconcern.New(readconcern.Level(readConcern)))
+		default:
+			return cerror.NewConfigError(correlationId, "INVALID_READ_CONCERN",
+				"Invalid read concern "+readConcern+", expected local, available, majority, linearizable or snapshot")
+		}
+	}
+
+	// Read preference
+	readPreference, err := c.composeReadPreference(correlationId)
+	if err != nil {
+		return err
+	}
+	if readPreference != nil {
+		settings.SetReadPreference(readPreference)
+	}
+
+	// Retryable operations, retryable writes require replica set or sharded cluster
+	retryWrites := c.Options.GetAsNullableBoolean("retry_writes")
+	if retryWrites != nil {
+		settings.SetRetryWrites(*retryWrites)
+	} else if settings.RetryWrites == nil {
+		settings.SetRetryWrites(true)
+	}
+	retryReads := c.Options.GetAsNullableBoolean("retry_reads")
+	if retryReads != nil {
+		settings.SetRetryReads(*retryReads)
+	}
+
+	// Wire compression
+	compressors := c.Options.GetAsString("compressors")
+	if compressors != "" {
+		names := make([]string, 0, 3)
+		for _, name := range strings.Split(compressors, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name != "zstd" && name != "snappy" && name != "zlib" {
+				return cerror.NewConfigError(correlationId, "INVALID_COMPRESSOR",
+					"Unknown compressor "+name+", expected zstd, snappy or zlib")
+			}
+			names = append(names, name)
+		}
+		settings.SetCompressors(names)
+	}
+	zlibLevel := c.Options.GetAsNullableInteger("zlib_level")
+	if zlibLevel != nil {
+		if *zlibLevel < -1 || *zlibLevel > 9 {
+			return cerror.NewConfigError(correlationId, "INVALID_ZLIB_LEVEL",
+				"Zlib compression level must be between -1 and 9")
+		}
+		settings.SetZlibLevel(*zlibLevel)
+	}
+
+	// Monitoring of connection pool and commands
+	if c.Options.GetAsBoolean("monitor") {
+		settings.SetPoolMonitor(c.composePoolMonitor(correlationId))
+		settings.SetMonitor(c.composeCommandMonitor(correlationId))
+	}
+
+	// TLS(SSL) connection
+	if c.Options.GetAsBoolean("ssl") {
+		tlsConfig, err := c.composeTLSConfig(correlationId)
+		if err != nil {
+			return err
+		}
+		settings.SetTLSConfig(tlsConfig)
+	}
 
 	// Auth params
-	if authSource != "" && authUser != "" && authPassword != "" {
-		authParams := mongoclopt.Credential{
-			AuthSource: authSource,
-			Username:   authUser,
-			Password:   authPassword,
+	// Mechanisms like MONGODB-X509 do not require user name and password
+	if authMechanism != "" || (authSource != "" && authUser != "" && authPassword != "") {
+		authParams := mongoclopt.Credential{}
+		// Keep credentials that came with connection URI
+		if settings.Auth != nil {
+			authParams = *settings.Auth
+		}
+		if authMechanism != "" {
+			authParams.AuthMechanism = authMechanism
+		}
+		if authMechanismProperties != "" {
+			properties, err := c.parseAuthMechanismProperties(correlationId, authMechanismProperties)
+			if err != nil {
+				return err
+			}
+			authParams.AuthMechanismProperties = properties
+		}
+		if authSource != "" {
+			authParams.AuthSource = authSource
+		}
+		if authUser != "" {
+			authParams.Username = authUser
+		}
+		if authPassword != "" {
+			authParams.Password = authPassword
 		}
 		settings.SetAuth(authParams)
 	}
+	return nil
+}
+
+func (c *MongoDbConnection) composePoolMonitor(correlationId string) *event.PoolMonitor {
+	return &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			c.Logger.Debug(correlationId, "MongoDb pool event %s on %s (connection %d)", evt.Type, evt.Address, evt.ConnectionID)
+		},
+	}
+}
+
+func (c *MongoDbConnection) composeCommandMonitor(correlationId string) *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, evt *event.CommandStartedEvent) {
+			c.Logger.Debug(correlationId, "MongoDb command %s started on %s (request %d)",
+				evt.CommandName, evt.DatabaseName, evt.RequestID)
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			c.Logger.Debug(correlationId, "MongoDb command %s succeeded in %v (request %d)",
+				evt.CommandName, (time.Duration)(evt.DurationNanos), evt.RequestID)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			c.Logger.Debug(correlationId, "MongoDb command %s failed in %v (request %d): %s",
+				evt.CommandName, (time.Duration)(evt.DurationNanos), evt.RequestID, evt.Failure)
+		},
+	}
+}
+
+func (c *MongoDbConnection) composeWriteConcern(correlationId string) (*writeconcern.WriteConcern, error) {
+	w := c.Options.GetAsString("write_concern")
+	journal := c.Options.GetAsNullableBoolean("journal")
+	timeoutMS := c.Options.GetAsInteger("write_concern_timeout")
+
+	if w == "" && journal == nil && timeoutMS == 0 {
+		return nil, nil
+	}
+
+	wcOptions := make([]writeconcern.Option, 0, 3)
+	if w == "majority" {
+		wcOptions = append(wcOptions, writeconcern.WMajority())
+	} else if w != "" {
+		value, err := strconv.Atoi(w)
+		if err != nil || value < 0 {
+			return nil, cerror.NewConfigError(correlationId, "INVALID_WRITE_CONCERN",
+				"Invalid write concern "+w+", expected number or majority")
+		}
+		wcOptions = append(wcOptions, writeconcern.W(value))
+	}
+	if journal != nil {
+		wcOptions = append(wcOptions, writeconcern.J(*journal))
+	}
+	if timeoutMS < 0 {
+		return nil, cerror.NewConfigError(correlationId, "INVALID_WRITE_CONCERN_TIMEOUT",
+			"Write concern timeout cannot be negative")
+	}
+	if timeoutMS > 0 {
+		wcOptions = append(wcOptions, writeconcern.WTimeout((time.Duration)(timeoutMS)*time.Millisecond))
+	}
+	return writeconcern.New(wcOptions...), nil
+}
+
+// minMaxStalenessSeconds is the smallest max staleness accepted by MongoDB servers
+const minMaxStalenessSeconds = 90
+
+func (c *MongoDbConnection) composeReadPreference(correlationId string) (*readpref.ReadPref, error) {
+	mode := c.Options.GetAsString("read_preference")
+	maxStaleness := c.Options.GetAsNullableInteger("max_staleness_seconds")
+
+	if mode == "" && maxStaleness == nil {
+		return nil, nil
+	}
+	if mode == "" {
+		mode = "primary"
+	}
+
+	rpMode, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, cerror.NewConfigError(correlationId, "INVALID_READ_PREFERENCE",
+			"Invalid read preference "+mode+", expected primary, primaryPreferred, secondary, secondaryPreferred or nearest")
+	}
+
+	rpOptions := make([]readpref.Option, 0, 1)
+	if maxStaleness != nil {
+		if *maxStaleness < minMaxStalenessSeconds {
+			return nil, cerror.NewConfigError(correlationId, "INVALID_MAX_STALENESS",
+				"Max staleness must be at least "+strconv.Itoa(minMaxStalenessSeconds)+" seconds")
+		}
+		if rpMode == readpref.PrimaryMode {
+			return nil, cerror.NewConfigError(correlationId, "INVALID_MAX_STALENESS",
+				"Max staleness cannot be used with primary read preference")
+		}
+		rpOptions = append(rpOptions, readpref.WithMaxStaleness((time.Duration)(*maxStaleness)*time.Second))
+	}
+
+	rp, err := readpref.New(rpMode, rpOptions...)
+	if err != nil {
+		return nil, cerror.NewConfigError(correlationId, "INVALID_READ_PREFERENCE",
+			"Invalid read preference "+mode).WithCause(err)
+	}
+	return rp, nil
+}
+
+func (c *MongoDbConnection) parseAuthMechanismProperties(correlationId string, value string) (map[string]string, error) {
+	properties := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, cerror.NewConfigError(correlationId, "INVALID_AUTH_PROPERTIES",
+				"Invalid auth mechanism property "+pair+", expected key:value")
+		}
+		properties[kv[0]] = kv[1]
+	}
+	return properties, nil
+}
+
+func (c *MongoDbConnection) composeTLSConfig(correlationId string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	caFile := c.Options.GetAsString("tls_ca_file")
+	if caFile != "" {
+		caCert, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, cerror.NewConfigError(correlationId, "READ_CA_FILE_FAILED", "Failed to read TLS CA file "+caFile).WithCause(err)
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(caCert) {
+			return nil, cerror.NewConfigError(correlationId, "INVALID_CA_FILE", "TLS CA file "+caFile+" has no valid certificates")
+		}
+		tlsConfig.RootCAs = certPool
+	} else {
+		// Default to the system cert pool
+		certPool, err := x509.SystemCertPool()
+		if err == nil {
+			tlsConfig.RootCAs = certPool
+		}
+	}
+
+	certFile := c.Options.GetAsString("tls_cert_file")
+	keyFile := c.Options.GetAsStringWithDefault("tls_key_file", certFile)
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, cerror.NewConfigError(correlationId, "READ_CERT_FILE_FAILED", "Failed to load TLS client certificate "+certFile).WithCause(err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
 // Open method is opens the component.
+// The connection counts how many times it was opened by components that share it.
+// Only the first call connects to the server, the following ones reuse the client.
+// Unless options.verify_on_open is false, the server is pinged, so Open returns ConnectionError
+// when the server is unreachable or credentials are wrong.
 // Parameters:
 //   - correlationId string
 //   (optional) transaction id to trace execution through call chain.
 // Return error
 // error or nil when no errors occured.
 func (c *MongoDbConnection) Open(correlationId string) error {
+	c.openLock.Lock()
+	defer c.openLock.Unlock()
+
+	if c.Connection != nil {
+		c.openCount++
+		return nil
+	}
+
+	client, databaseName, err := c.connect(correlationId)
+	if err != nil {
+		return err
+	}
+	// The driver connects lazily, so wrong hosts or credentials are revealed by the first command
+	if c.Options.GetAsBooleanWithDefault("verify_on_open", true) {
+		err = c.ping(correlationId, client)
+		if err != nil {
+			_ = client.Disconnect(c.Ctx)
+			c.Logger.Error(correlationId, err, "Failed to verify connection to mongodb")
+			return err
+		}
+	}
+	c.Connection = client
+	c.DatabaseName = databaseName
+	c.Db = client.Database(c.DatabaseName)
+	c.openCount = 1
+	return nil
+}
+
+// connect creates a new MongoDB client and connects it to the server.
+func (c *MongoDbConnection) connect(correlationId string) (client *mongodrv.Client, databaseName string, err error) {
 	uri, err := c.ConnectionResolver.Resolve(correlationId)
 	if err != nil {
 		c.Logger.Error(correlationId, err, "Failed to resolve MongoDb connection")
-		return err
+		return nil, "", err
 	}
 	c.Logger.Debug(correlationId, "Connecting to mongodb")
 
 	settings := mongoclopt.Client()
 	settings.ApplyURI(uri)
-	c.composeSettings(settings)
+	err = c.ComposeSettings(correlationId, settings)
+	if err != nil {
+		c.Logger.Error(correlationId, err, "Failed to compose MongoDb settings")
+		return nil, "", err
+	}
 
 	//settings.useNewUrlParser = true;
 	//settings.useUnifiedTopology = true;
 
-	client, err := mongodrv.NewClient(settings)
+	client, err = mongodrv.NewClient(settings)
 
 	if err != nil {
 		err = cerror.NewConnectionError(correlationId, "CONNECT_FAILED", "Create client for mongodb failed").WithCause(err)
-		return err
+		return nil, "", err
 	}
 	cs, _ := connstring.Parse(uri)
-	c.DatabaseName = cs.Database
 	//ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	// defer cancel()
 	c.Ctx = context.Background()
 	err = client.Connect(c.Ctx)
 	if err != nil {
 		err = cerror.NewConnectionError(correlationId, "CONNECT_FAILED", "Connection to mongodb failed").WithCause(err)
-		return err
+		return nil, "", err
 	}
-	c.Connection = client
-	c.Db = client.Database(c.DatabaseName)
-	return nil
+	return client, cs.Database, nil
+}
+
+// IsAutoReconnect method checks if the connection shall be re-established
+// automatically when it is lost.
+// Returns true if auto reconnection is enabled and false otherwise.
+func (c *MongoDbConnection) IsAutoReconnect() bool {
+	return c.Options.GetAsBooleanWithDefault("auto_reconnect", true)
+}
+
+// AddReconnectListener method adds a function that is called after
+// the connection was re-established. Components that keep references
+// to the client or database objects shall update them in the listener.
+// Parameters:
+//  - listener func(correlationId string)
+//  a function called after successful reconnection.
+func (c *MongoDbConnection) AddReconnectListener(listener func(correlationId string)) {
+	c.reconnectLock.Lock()
+	defer c.reconnectLock.Unlock()
+
+	c.reconnectListeners = append(c.reconnectListeners, listener)
+}
+
+// Reconnect method re-establishes the connection to MongoDB with a new client
+// and closes the old one. Attempts are repeated with exponential backoff
+// limited by reconnect_interval until reconnect_attempts are exhausted.
+// When several components share the connection only the first one reconnects,
+// the others get the new client. A closed connection is not reconnected.
+// Reconnect listeners are called after the connection is unlocked.
+// Parameters:
+//  - correlationId string
+//  (optional) transaction id to trace execution through call chain.
+//  - failedClient *mongodrv.Client
+//  (optional) the client that failed, reconnection is skipped if it was already replaced.
+// Return error
+// error or nil when connection was re-established.
+func (c *MongoDbConnection) Reconnect(correlationId string, failedClient *mongodrv.Client) error {
+	listeners, err := c.reconnect(correlationId, failedClient)
+	for _, listener := range listeners {
+		listener(correlationId)
+	}
+	return err
+}
+
+// reconnect replaces the client of the opened connection with a new one.
+// Returns listeners to be notified, or nil when the client was not replaced.
+func (c *MongoDbConnection) reconnect(correlationId string, failedClient *mongodrv.Client) ([]func(correlationId string), error) {
+	c.reconnectLock.Lock()
+	defer c.reconnectLock.Unlock()
+
+	c.openLock.Lock()
+	oldClient := c.Connection
+	c.openLock.Unlock()
+
+	if oldClient == nil {
+		return nil, cerror.NewConnectionError(correlationId, "NOT_CONNECTED", "Connection to mongodb is not opened")
+	}
+	if failedClient != nil && oldClient != failedClient {
+		return nil, nil
+	}
+
+	maxInterval := (time.Duration)(c.Options.GetAsIntegerWithDefault("reconnect_interval", 1000)) * time.Millisecond
+	attempts := c.Options.GetAsIntegerWithDefault("reconnect_attempts", 3)
+	interval := 100 * time.Millisecond
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var client *mongodrv.Client
+		var databaseName string
+		client, databaseName, err = c.connect(correlationId)
+		if err == nil {
+			err = c.ping(correlationId, client)
+			if err == nil {
+				// The connection may be closed or reopened while reconnecting
+				c.openLock.Lock()
+				current := c.Connection
+				if current == oldClient {
+					c.Connection = client
+					c.DatabaseName = databaseName
+					c.Db = client.Database(databaseName)
+				}
+				c.openLock.Unlock()
+
+				if current != oldClient {
+					_ = client.Disconnect(c.Ctx)
+					if current == nil {
+						return nil, cerror.NewConnectionError(correlationId, "NOT_CONNECTED", "Connection to mongodb is not opened")
+					}
+					return nil, nil
+				}
+				_ = oldClient.Disconnect(c.Ctx)
+				c.Logger.Info(correlationId, "Reconnected to mongodb database %s after %d attempt(s)", databaseName, attempt)
+				listeners := make([]func(correlationId string), len(c.reconnectListeners))
+				copy(listeners, c.reconnectListeners)
+				return listeners, nil
+			}
+			_ = client.Disconnect(c.Ctx)
+		}
+
+		c.Logger.Warn(correlationId, "Reconnection attempt %d to mongodb failed: %s", attempt, err.Error())
+		if attempt < attempts {
+			time.Sleep(interval)
+			interval *= 2
+			if interval > maxInterval {
+				interval = maxInterval
+			}
+		}
+	}
+	return nil, cerror.NewConnectionError(correlationId, "RECONNECT_FAILED", "Reconnection to mongodb failed").WithCause(err)
+}
+
+// IsDisconnectError checks if an error means that connection to MongoDB was lost
+// and operations can succeed after reconnection.
+// Parameters:
+//  - err error
+//  an error returned by MongoDB driver.
+// Returns true if the error is caused by lost connection and false otherwise.
+func IsDisconnectError(err error) bool {
+	if err == nil {
+		return false
+	}
+	// Operations cancelled by a caller say nothing about the connection state
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, mongodrv.ErrClientDisconnected) || errors.Is(err, topology.ErrTopologyClosed) ||
+		mongodrv.IsNetworkError(err) {
+		return true
+	}
+	var selectionErr topology.ServerSelectionError
+	return errors.As(err, &selectionErr)
 }
 
 // Close method is closes component and frees used resources.
+// Each call releases one Open, the client is disconnected
+// when the last component that opened the connection closes it.
 // Parameters:
 //  - correlationId string
 //  (optional) transaction id to trace execution through call chain.
 // Return error
 // error or nil when no errors occured.
 func (c *MongoDbConnection) Close(correlationId string) error {
+	c.openLock.Lock()
+	defer c.openLock.Unlock()
+
 	if c.Connection == nil {
 		return nil
 	}
+	c.openCount--
+	if c.openCount > 0 {
+		c.Logger.Trace(correlationId, "Mongodb connection is still used by %d component(s)", c.openCount)
+		return nil
+	}
+	c.openCount = 0
 
 	err := c.Connection.Disconnect(c.Ctx)
 	c.Connection = nil
@@ -218,6 +774,120 @@ func (c *MongoDbConnection) Close(correlationId string) error {
 	return err
 }
 
+// Ping method checks if MongoDB server is actually reachable.
+// Parameters:
+//  - correlationId string
+//  (optional) transaction id to trace execution through call chain.
+// Return error
+// error or nil when server responded.
+func (c *MongoDbConnection) Ping(correlationId string) error {
+	if c.Connection == nil {
+		return cerror.NewConnectionError(correlationId, "NOT_CONNECTED", "Connection to mongodb is not opened")
+	}
+
+	return c.ping(correlationId, c.Connection)
+}
+
+// ping sends ping to the server using a given client within connect_timeout.
+func (c *MongoDbConnection) ping(correlationId string, client *mongodrv.Client) error {
+	ctx, cancel := c.newCommandContext()
+	defer cancel()
+
+	err := client.Ping(ctx, nil)
+	if err != nil {
+		return cerror.NewConnectionError(correlationId, "PING_FAILED", "Ping to mongodb failed").WithCause(err)
+	}
+	return nil
+}
+
+// newCommandContext creates a context for administrative commands limited by connect_timeout.
+func (c *MongoDbConnection) newCommandContext() (context.Context, context.CancelFunc) {
+	ctx := c.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	connectTimeout := c.Options.GetAsInteger("connect_timeout")
+	if connectTimeout > 0 {
+		return context.WithTimeout(ctx, (time.Duration)(connectTimeout)*time.Millisecond)
+	}
+	return context.WithCancel(ctx)
+}
+
+// GetServerInfo method gets information about the connected MongoDB server.
+// It returns the result of buildInfo command with the server version, and adds
+// the storage engine reported by serverStatus command when the user is allowed to run it.
+// Parameters:
+//  - correlationId string
+//  (optional) transaction id to trace execution through call chain.
+// Returns info bson.M, err error
+// server information and error, if they are occured
+func (c *MongoDbConnection) GetServerInfo(correlationId string) (info bson.M, err error) {
+	if c.Connection == nil {
+		return nil, cerror.NewConnectionError(correlationId, "NOT_CONNECTED", "Connection to mongodb is not opened")
+	}
+
+	ctx, cancel := c.newCommandContext()
+	defer cancel()
+
+	admin := c.Connection.Database("admin")
+	err = admin.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info)
+	if err != nil {
+		return nil, cerror.NewConnectionError(correlationId, "SERVER_INFO_FAILED", "Failed to get mongodb server info").WithCause(err)
+	}
+
+	// serverStatus requires clusterMonitor role, so it is optional
+	var status struct {
+		StorageEngine bson.M `bson:"storageEngine"`
+	}
+	statusErr := admin.RunCommand(ctx, bson.D{{Key: "serverStatus", Value: 1}}).Decode(&status)
+	if statusErr == nil && status.StorageEngine != nil {
+		info["storageEngine"] = status.StorageEngine
+	} else if statusErr != nil {
+		c.Logger.Debug(correlationId, "Failed to get mongodb server status: %s", statusErr.Error())
+	}
+	return info, nil
+}
+
+// WithTransaction method runs a function within a MongoDB transaction.
+// It starts a new session, executes the function and commits the transaction
+// when the function succeeds or aborts it when the function returns an error.
+// Transient transaction errors are retried by the driver.
+// Persistence operations join the transaction when they are called with
+// the session context, e.g. persistence.CreateWithContext(sessCtx, correlationId, item).
+// Transactions require MongoDB replica set or sharded cluster.
+// Parameters:
+//  - correlationId string
+//  (optional) transaction id to trace execution through call chain.
+//  - fn func(sessCtx mongodrv.SessionContext) (interface{}, error)
+//  function to be executed within the transaction.
+// Return result interface{}, err error
+// result of the function and error, if transaction failed.
+func (c *MongoDbConnection) WithTransaction(correlationId string,
+	fn func(sessCtx mongodrv.SessionContext) (interface{}, error)) (result interface{}, err error) {
+	if c.Connection == nil {
+		return nil, cerror.NewConnectionError(correlationId, "NOT_CONNECTED", "Connection to mongodb is not opened")
+	}
+
+	ctx := c.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	session, err := c.Connection.StartSession()
+	if err != nil {
+		return nil, cerror.NewConnectionError(correlationId, "SESSION_FAILED", "Failed to start mongodb session").WithCause(err)
+	}
+	defer session.EndSession(ctx)
+
+	result, err = session.WithTransaction(ctx, fn)
+	if err != nil {
+		c.Logger.Debug(correlationId, "Transaction in mongodb database %s was aborted", c.DatabaseName)
+		return nil, err
+	}
+	c.Logger.Trace(correlationId, "Transaction in mongodb database %s was committed", c.DatabaseName)
+	return result, nil
+}
+
 // GetConnection method return work connection object
 // Return *mongodrv.Client
 func (c *MongoDbConnection) GetConnection() *mongodrv.Client {
@@ -235,3 +905,18 @@ func (c *MongoDbConnection) GetDatabase() *mongodrv.Database {
 func (c *MongoDbConnection) GetDatabaseName() string {
 	return c.DatabaseName
 }
+
+// GetDatabaseByName method returns a database with a given name on the same client.
+// It allows persistence components to work with several databases
+// over a shared connection, while the default database stays unchanged.
+// Parameters:
+//   - name string
+//   a name of the database.
+// Return *mongodrv.Database
+// database object or nil if connection is not opened
+func (c *MongoDbConnection) GetDatabaseByName(name string) *mongodrv.Database {
+	if c.Connection == nil {
+		return nil
+	}
+	return c.Connection.Database(name)
+}
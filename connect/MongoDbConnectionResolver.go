@@ -7,7 +7,12 @@ import (
 	crefer "github.com/pip-services3-go/pip-services3-commons-go/refer"
 	"github.com/pip-services3-go/pip-services3-components-go/auth"
 	ccon "github.com/pip-services3-go/pip-services3-components-go/connect"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -20,14 +25,23 @@ Configuration parameters
 
   - connection(s):
     - discovery_key:               (optional) a key to retrieve the connection from IDiscovery
+    - protocol:                    (optional) connection protocol: mongodb or mongodb+srv (default: mongodb)
     - host:                        host name or IP address
-    - port:                        port number (default: 27017)
+    - port:                        port number (default: 27017), not used in mongodb+srv mode
     - database:                    database name
     - uri:                         resource URI or connection string with all parameters in it
   - credential(s):
     - store_key:                   (optional) a key to retrieve the credentials from ICredentialStore
     - username:                    user name
     - password:                    user password
+    Credential values can refer to environment variables as ${ENV_VAR}. They are expanded on every Resolve,
+    so rotated secrets are used on reconnection.
+  - options:
+    - srv:                         (optional) use DNS seedlist (mongodb+srv) connection format (default: false)
+    - uri_options:                 (optional) extra driver options appended to the composed URI,
+                                   set as a section (uri_options.tlsInsecure=true) or a query string
+                                   (uri_options=directConnection=true&loadBalanced=false).
+                                   Options set in connection or credential parameters take precedence.
 
  References
 
@@ -39,6 +53,9 @@ type MongoDbConnectionResolver struct {
 	ConnectionResolver ccon.ConnectionResolver
 	//The credentials resolver.
 	CredentialResolver auth.CredentialResolver
+
+	srv        bool
+	uriOptions map[string]string
 }
 
 // NewMongoDbConnectionResolver creates new connection resolver
@@ -57,6 +74,25 @@ func NewMongoDbConnectionResolver() *MongoDbConnectionResolver {
 func (c *MongoDbConnectionResolver) Configure(config *cconf.ConfigParams) {
 	c.ConnectionResolver.Configure(config)
 	c.CredentialResolver.Configure(config)
+	c.srv = config.GetAsBooleanWithDefault("options.srv", c.srv)
+
+	c.uriOptions = make(map[string]string)
+	// Options defined as a query string
+	if query := config.GetAsString("options.uri_options"); query != "" {
+		values, _ := url.ParseQuery(query)
+		for key, value := range values {
+			if len(value) > 0 {
+				c.uriOptions[key] = value[0]
+			} else {
+				c.uriOptions[key] = ""
+			}
+		}
+	}
+	// Options defined as a section
+	section := config.GetSection("options.uri_options")
+	for _, key := range section.Keys() {
+		c.uriOptions[key] = section.GetAsString(key)
+	}
 }
 
 // SetReferences is sets references to dependent components.
@@ -68,7 +104,19 @@ func (c *MongoDbConnectionResolver) SetReferences(references crefer.IReferences)
 	c.CredentialResolver.SetReferences(references)
 }
 
-func (c *MongoDbConnectionResolver) validateConnection(correlationId string, connection *ccon.ConnectionParams) error {
+func (c *MongoDbConnectionResolver) isSrv(connections []*ccon.ConnectionParams) bool {
+	if c.srv {
+		return true
+	}
+	for _, connection := range connections {
+		if connection.Protocol() == "mongodb+srv" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *MongoDbConnectionResolver) validateConnection(correlationId string, connection *ccon.ConnectionParams, srv bool) error {
 	uri := connection.Uri()
 	if uri != "" {
 		return nil
@@ -79,7 +127,7 @@ func (c *MongoDbConnectionResolver) validateConnection(correlationId string, con
 		return cerr.NewConfigError(correlationId, "NO_HOST", "Connection host is not set")
 	}
 	port := connection.Port()
-	if port == 0 {
+	if port == 0 && !srv {
 		return cerr.NewConfigError(correlationId, "NO_PORT", "Connection port is not set")
 	}
 	database := connection.GetAsNullableString("database")
@@ -93,8 +141,12 @@ func (c *MongoDbConnectionResolver) validateConnections(correlationId string, co
 	if connections == nil || len(connections) == 0 {
 		return cerr.NewConfigError(correlationId, "NO_CONNECTION", "Database connection is not set")
 	}
+	srv := c.isSrv(connections)
+	if srv && len(connections) > 1 {
+		return cerr.NewConfigError(correlationId, "MULTIPLE_SRV_HOSTS", "Only one host is allowed in mongodb+srv mode")
+	}
 	for _, connection := range connections {
-		err := c.validateConnection(correlationId, connection)
+		err := c.validateConnection(correlationId, connection, srv)
 		if err != nil {
 			return err
 		}
@@ -103,6 +155,41 @@ func (c *MongoDbConnectionResolver) validateConnections(correlationId string, co
 	return nil
 }
 
+// envReferenceRegex matches references to environment variables in ${ENV_VAR} form.
+var envReferenceRegex = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandCredential returns a copy of credential parameters with references
+// to environment variables replaced by their current values.
+// The configured credential is kept unchanged to expand the references again on the next call.
+func (c *MongoDbConnectionResolver) expandCredential(correlationId string, credential *auth.CredentialParams) (*auth.CredentialParams, error) {
+	if credential == nil {
+		return nil, nil
+	}
+	var err error
+	values := make(map[string]string)
+	for key, value := range credential.Value() {
+		values[key] = envReferenceRegex.ReplaceAllStringFunc(value, func(reference string) string {
+			name := envReferenceRegex.FindStringSubmatch(reference)[1]
+			envValue, ok := os.LookupEnv(name)
+			if !ok && err == nil {
+				err = cerr.NewConfigError(correlationId, "NO_ENV_VARIABLE",
+					"Environment variable "+name+" used in credential "+key+" is not set")
+			}
+			return envValue
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewCredentialParams(values), nil
+}
+
+// escapeUserInfo percent-encodes a user name or password to be safely embedded into URI.
+// Spaces are encoded as %20, because plus signs are not decoded in user information.
+func escapeUserInfo(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
 func (c *MongoDbConnectionResolver) composeUri(connections []*ccon.ConnectionParams, credential *auth.CredentialParams) string {
 	// If there is a uri then return it immediately
 	for _, connection := range connections {
@@ -112,6 +199,8 @@ func (c *MongoDbConnectionResolver) composeUri(connections []*ccon.ConnectionPar
 		}
 	}
 
+	srv := c.isSrv(connections)
+
 	// Define hosts
 	var hosts = ""
 	for _, connection := range connections {
@@ -121,7 +210,10 @@ func (c *MongoDbConnectionResolver) composeUri(connections []*ccon.ConnectionPar
 		if len(hosts) > 0 {
 			hosts += ","
 		}
-		if port != 0 {
+		// DNS seedlist host must not have a port
+		if srv {
+			hosts += host
+		} else if port != 0 {
 			hosts += host + ":" + strconv.Itoa(port)
 		}
 
@@ -145,9 +237,9 @@ func (c *MongoDbConnectionResolver) composeUri(connections []*ccon.ConnectionPar
 		if len(username) > 0 {
 			var password = credential.Password()
 			if len(password) > 0 {
-				auth = username + ":" + password + "@"
+				auth = escapeUserInfo(username) + ":" + escapeUserInfo(password) + "@"
 			} else {
-				auth = username + "@"
+				auth = escapeUserInfo(username) + "@"
 			}
 		}
 	}
@@ -163,6 +255,7 @@ func (c *MongoDbConnectionResolver) composeUri(connections []*ccon.ConnectionPar
 		options = cconf.NewConfigParamsFromValue(consConf.Value())
 	}
 	options.Remove("uri")
+	options.Remove("protocol")
 	options.Remove("host")
 	options.Remove("port")
 	options.Remove("database")
@@ -170,6 +263,23 @@ func (c *MongoDbConnectionResolver) composeUri(connections []*ccon.ConnectionPar
 	options.Remove("password")
 	params := ""
 	keys := options.Keys()
+	// Append extra options, unless they are already set explicitly.
+	// Driver options are case insensitive.
+	definedKeys := make(map[string]bool)
+	for _, key := range keys {
+		definedKeys[strings.ToLower(key)] = true
+	}
+	extraKeys := make([]string, 0, len(c.uriOptions))
+	for key := range c.uriOptions {
+		if !definedKeys[strings.ToLower(key)] {
+			extraKeys = append(extraKeys, key)
+		}
+	}
+	sort.Strings(extraKeys)
+	for _, key := range extraKeys {
+		options.Put(key, c.uriOptions[key])
+	}
+	keys = append(keys, extraKeys...)
 	for _, key := range keys {
 		if len(params) > 0 {
 			params += "&"
@@ -178,7 +288,7 @@ func (c *MongoDbConnectionResolver) composeUri(connections []*ccon.ConnectionPar
 
 		value := options.GetAsString(key)
 		if value != "" {
-			params += "=" + value
+			params += "=" + url.QueryEscape(value)
 		}
 	}
 	if len(params) > 0 {
@@ -186,7 +296,11 @@ func (c *MongoDbConnectionResolver) composeUri(connections []*ccon.ConnectionPar
 	}
 
 	// Compose uri
-	uri := "mongodb://" + auth + hosts + database + params
+	scheme := "mongodb://"
+	if srv {
+		scheme = "mongodb+srv://"
+	}
+	uri := scheme + auth + hosts + database + params
 
 	return uri
 }
@@ -226,6 +340,10 @@ func (c *MongoDbConnectionResolver) Resolve(correlationId string) (uri string, e
 	if errCred != nil {
 		return uri, errCred
 	}
+	credential, errCred = c.expandCredential(correlationId, credential)
+	if errCred != nil {
+		return uri, errCred
+	}
 	uri = c.composeUri(connections, credential)
 	return uri, nil
 }
@@ -0,0 +1,71 @@
+package persistence
+
+import (
+	cconv "github.com/pip-services3-go/pip-services3-commons-go/convert"
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+Helpers to compose filters on array fields.
+Values can be passed as slices, AnyValueArray or comma-separated strings,
+so they can be taken directly from FilterParams.
+
+Example:
+
+  filter := bson.M{"$and": bson.A{
+      bson.M{"status": "active"},
+      ArrayContainsAll("tags", filterParams.GetAsString("tags")),
+  }}
+  page, err := persistence.GetPageByFilter("123", filter, paging, nil, nil)
+*/
+
+// ArrayContains creates a filter that matches items with an array field that contains a given value.
+// Unlike a plain equality filter it does not match scalar fields.
+// Parameters:
+//   - field string
+//   a name of the array field
+//   - value interface{}
+//   a value to search for
+// Returns bson.M
+// filter BSON object
+func ArrayContains(field string, value interface{}) bson.M {
+	return bson.M{field: bson.M{"$elemMatch": bson.M{"$eq": value}}}
+}
+
+// ArrayContainsAll creates a filter that matches items with an array field that contains all given values.
+// An empty list of values matches no items.
+// Parameters:
+//   - field string
+//   a name of the array field
+//   - values interface{}
+//   values to search for as a slice, AnyValueArray or comma-separated string
+// Returns bson.M
+// filter BSON object
+func ArrayContainsAll(field string, values interface{}) bson.M {
+	return bson.M{field: bson.M{"$all": toBsonArray(values)}}
+}
+
+// ArrayContainsAny creates a filter that matches items with an array field that contains at least one of given values.
+// An empty list of values matches no items.
+// Parameters:
+//   - field string
+//   a name of the array field
+//   - values interface{}
+//   values to search for as a slice, AnyValueArray or comma-separated string
+// Returns bson.M
+// filter BSON object
+func ArrayContainsAny(field string, values interface{}) bson.M {
+	return bson.M{field: bson.M{"$in": toBsonArray(values)}}
+}
+
+// toBsonArray converts a list of values into BSON array.
+func toBsonArray(values interface{}) bson.A {
+	if values == nil {
+		return bson.A{}
+	}
+	if array, ok := values.(*cdata.AnyValueArray); ok {
+		return bson.A(array.Value())
+	}
+	return bson.A(cconv.ArrayConverter.ListToArray(values))
+}
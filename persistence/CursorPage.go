@@ -0,0 +1,44 @@
+package persistence
+
+/*
+CursorPage is a page of data items retrieved with keyset pagination.
+Unlike DataPage it has no total count, but contains a continuation token
+to retrieve the next page.
+
+Example:
+
+  var afterId interface{}
+  for {
+    page, err := persistence.GetPageByFilterWithCursor("123", filter, afterId, 100, nil)
+    if err != nil || len(page.Data) == 0 {
+      break
+    }
+    ...
+    if page.LastId == nil {
+      break
+    }
+    afterId = page.LastId
+  }
+*/
+type CursorPage struct {
+	// Data items on the page
+	Data []interface{}
+	// Id of the last item on the page to retrieve the next page,
+	// or nil when there are no more items
+	LastId interface{}
+}
+
+// NewCursorPage creates a new page of data items.
+// Parameters:
+//   - data []interface{}
+//   data items on the page
+//   - lastId interface{}
+//   id of the last item or nil if there are no more items
+// Returns *CursorPage
+// created page
+func NewCursorPage(data []interface{}, lastId interface{}) *CursorPage {
+	return &CursorPage{
+		Data:   data,
+		LastId: lastId,
+	}
+}
@@ -0,0 +1,58 @@
+package persistence
+
+/*
+DataPageEx is a page of data items with pagination metadata.
+In addition to DataPage it contains effective paging parameters
+and tells if there are more items after the page.
+
+Example:
+
+  page, err := persistence.GetPageByFilterEx("123", filter, cdata.NewPagingParams(0, 20, false), nil, nil)
+  ...
+  if page.HasMore {
+      // Show link to the next page
+  }
+*/
+type DataPageEx struct {
+	// Data items on the page
+	Data []interface{}
+	// Total number of items, nil when it was not requested
+	Total *int64
+	// Number of items skipped before the page
+	Skip int64
+	// Maximum number of items on the page after page size limits were applied
+	Take int64
+	// Zero-based page number, calculated as Skip / Take
+	Page int64
+	// True if there are more items after the page
+	HasMore bool
+}
+
+// NewDataPageEx creates a new page of data items.
+// Parameters:
+//   - data []interface{}
+//   data items on the page
+//   - total *int64
+//   (optional) total number of items
+//   - skip int64
+//   number of skipped items
+//   - take int64
+//   maximum number of items on the page
+//   - hasMore bool
+//   true if there are more items after the page
+// Returns *DataPageEx
+// created page
+func NewDataPageEx(data []interface{}, total *int64, skip int64, take int64, hasMore bool) *DataPageEx {
+	var page int64
+	if take > 0 {
+		page = skip / take
+	}
+	return &DataPageEx{
+		Data:    data,
+		Total:   total,
+		Skip:    skip,
+		Take:    take,
+		Page:    page,
+		HasMore: hasMore,
+	}
+}
@@ -0,0 +1,213 @@
+package persistence
+
+import (
+	"regexp"
+	"sort"
+
+	cconv "github.com/pip-services3-go/pip-services3-commons-go/convert"
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Operators of filter fields supported by FilterParamsToBson.
+const (
+	// FilterEq matches a field equal to the filter value.
+	FilterEq = "eq"
+	// FilterLike matches a field that contains the filter value, ignoring case unless CaseSensitive is set.
+	FilterLike = "like"
+	// FilterRegex matches a field by a regular expression given in the filter value.
+	FilterRegex = "regex"
+	// FilterRange matches a field between values of <key>_min and <key>_max filter keys, both inclusive.
+	FilterRange = "range"
+	// FilterIn matches a field equal to one of values given as a list or a comma-separated string.
+	FilterIn = "in"
+)
+
+// FilterFieldSpec defines how a filter key is converted into a query on a document field.
+type FilterFieldSpec struct {
+	// A name of the document field, the filter key when empty.
+	Field string
+	// One of FilterEq, FilterLike, FilterRegex, FilterRange or FilterIn, FilterEq when empty.
+	Operator string
+	// A type to convert filter values to: Integer, Long, Float, Double, Boolean or DateTime.
+	// Values of other types are kept as strings.
+	Type cconv.TypeCode
+	// True to match FilterLike values with case.
+	CaseSensitive bool
+}
+
+// LikeFilter creates a filter that matches items with a field that contains a given text.
+// Regular expression metacharacters in the text are escaped, so user input is matched literally.
+// Parameters:
+//   - field string
+//   a name of the field
+//   - pattern string
+//   a text to search for
+//   - caseInsensitive bool
+//   true to ignore case
+// Returns bson.M
+// filter BSON object
+func LikeFilter(field string, pattern string, caseInsensitive bool) bson.M {
+	return bson.M{field: likeCondition(pattern, caseInsensitive)}
+}
+
+// likeCondition creates $regex condition that matches a given text literally.
+func likeCondition(pattern string, caseInsensitive bool) bson.M {
+	condition := bson.M{"$regex": regexp.QuoteMeta(pattern)}
+	if caseInsensitive {
+		condition["$options"] = "i"
+	}
+	return condition
+}
+
+/*
+FilterParamsToBson converts filter parameters into a filter BSON object
+using a mapping of filter keys to document field queries.
+Missing and empty filter values are ignored, so an empty filter matches all items.
+It can be used to implement ComposeFilter method of persistence components.
+
+Parameters:
+  - filter *cdata.FilterParams
+  (optional) filter parameters
+  - mapping map[string]FilterFieldSpec
+  filter keys mapped to field queries
+
+Returns bson.M
+a filter BSON object
+
+Example:
+
+  func (c *MyPersistence) ComposeFilter(filter *cdata.FilterParams) interface{} {
+      return FilterParamsToBson(filter, map[string]FilterFieldSpec{
+          "id":     {Field: "_id"},
+          "name":   {Operator: FilterLike},
+          "status": {Operator: FilterIn},
+          "time":   {Field: "create_time", Operator: FilterRange, Type: cconv.DateTime},
+      })
+  }
+*/
+func FilterParamsToBson(filter *cdata.FilterParams, mapping map[string]FilterFieldSpec) bson.M {
+	result := bson.M{}
+	if filter == nil {
+		return result
+	}
+
+	// Keys are sorted to compose the same filter on every call
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	conditions := bson.A{}
+	for _, key := range keys {
+		spec := mapping[key]
+		field := spec.Field
+		if field == "" {
+			field = key
+		}
+		condition := composeFieldCondition(filter, key, spec)
+		if condition == nil {
+			continue
+		}
+		// Several keys may query the same field
+		if _, ok := result[field]; ok {
+			conditions = append(conditions, bson.M{field: condition})
+		} else {
+			result[field] = condition
+		}
+	}
+	if len(conditions) > 0 {
+		result["$and"] = conditions
+	}
+	return result
+}
+
+// composeFieldCondition converts a value of a filter key into a field condition.
+// Returns nil when the filter has no value for the key.
+func composeFieldCondition(filter *cdata.FilterParams, key string, spec FilterFieldSpec) interface{} {
+	switch spec.Operator {
+	case FilterRange:
+		condition := bson.M{}
+		if minValue := filterValue(filter, key+"_min", spec.Type); minValue != nil {
+			condition["$gte"] = minValue
+		}
+		if maxValue := filterValue(filter, key+"_max", spec.Type); maxValue != nil {
+			condition["$lte"] = maxValue
+		}
+		if len(condition) == 0 {
+			return nil
+		}
+		return condition
+	case FilterIn:
+		value := filter.GetAsNullableString(key)
+		if value == nil || *value == "" {
+			return nil
+		}
+		values := toBsonArray(*value)
+		if spec.Type != cconv.Unknown {
+			for i, v := range values {
+				values[i] = convertFilterValue(v, spec.Type)
+			}
+		}
+		return bson.M{"$in": values}
+	case FilterLike:
+		value := filter.GetAsNullableString(key)
+		if value == nil || *value == "" {
+			return nil
+		}
+		return likeCondition(*value, !spec.CaseSensitive)
+	case FilterRegex:
+		value := filter.GetAsNullableString(key)
+		if value == nil || *value == "" {
+			return nil
+		}
+		return bson.M{"$regex": *value}
+	default:
+		return filterValue(filter, key, spec.Type)
+	}
+}
+
+// filterValue gets a filter value converted into a given type.
+// Returns nil when the value is missing, empty or can't be converted.
+func filterValue(filter *cdata.FilterParams, key string, typ cconv.TypeCode) interface{} {
+	value := filter.GetAsNullableString(key)
+	if value == nil || *value == "" {
+		return nil
+	}
+	return convertFilterValue(*value, typ)
+}
+
+// convertFilterValue converts a filter value into a given type.
+// Returns nil when the value can't be converted.
+func convertFilterValue(value interface{}, typ cconv.TypeCode) interface{} {
+	switch typ {
+	case cconv.Integer:
+		if v := cconv.IntegerConverter.ToNullableInteger(value); v != nil {
+			return *v
+		}
+	case cconv.Long:
+		if v := cconv.LongConverter.ToNullableLong(value); v != nil {
+			return *v
+		}
+	case cconv.Float:
+		if v := cconv.FloatConverter.ToNullableFloat(value); v != nil {
+			return *v
+		}
+	case cconv.Double:
+		if v := cconv.DoubleConverter.ToNullableDouble(value); v != nil {
+			return *v
+		}
+	case cconv.Boolean:
+		if v := cconv.BooleanConverter.ToNullableBoolean(value); v != nil {
+			return *v
+		}
+	case cconv.DateTime:
+		if v := cconv.DateTimeConverter.ToNullableDateTime(value); v != nil {
+			return *v
+		}
+	default:
+		return value
+	}
+	return nil
+}
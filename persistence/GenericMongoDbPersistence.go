@@ -0,0 +1,39 @@
+package persistence
+
+/*
+GenericMongoDbPersistence is a persistence component that stores arbitrary documents
+without a data type defined in code. Items are read as map[string]interface{}
+and can be written as maps or bson.M. The "_id" field is converted
+into public id field (options.id_field) as in other persistence components.
+
+It supports all configuration parameters and operations of IdentifiableMongoDbPersistence.
+
+Example:
+
+  persistence := NewGenericMongoDbPersistence("events")
+  persistence.Configure(cconf.NewConfigParamsFromTuples(
+      "connection.host", "localhost",
+      "connection.port", "27017",
+      "connection.database", "test",
+  ))
+  err := persistence.Open("123")
+  ...
+  item, err := persistence.Create("123", bson.M{"type": "login", "user": "user1"})
+  ...
+  item, err = persistence.GetOneById("123", item.(map[string]interface{})["Id"])
+*/
+type GenericMongoDbPersistence struct {
+	IdentifiableMongoDbPersistence
+}
+
+// NewGenericMongoDbPersistence creates a new instance of the generic persistence component.
+// Parameters:
+//  - collection string
+//  a collection name.
+// Return *GenericMongoDbPersistence
+// new created GenericMongoDbPersistence component
+func NewGenericMongoDbPersistence(collection string) *GenericMongoDbPersistence {
+	c := &GenericMongoDbPersistence{}
+	c.IdentifiableMongoDbPersistence = *InheritIdentifiableMongoDbPersistence(c, nil, collection)
+	return c
+}
@@ -1,35 +1,57 @@
 package persistence
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
+	"strings"
+	"time"
 
 	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
 	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
+	refl "github.com/pip-services3-go/pip-services3-commons-go/reflect"
 	cmpersist "github.com/pip-services3-go/pip-services3-data-go/persistence"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	mngoptions "go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// IMongoDbFilterComposer is an optional interface of persistence overrides
+// that converts filter parameters into a filter BSON object.
+type IMongoDbFilterComposer interface {
+	ComposeFilter(filter *cdata.FilterParams) interface{}
+}
+
 /*
 IdentifiableMongoDbPersistence is abstract persistence component that stores data in MongoDB
 and implements a number of CRUD operations over data items with unique ids.
 The data items must implement IIdentifiable interface.
 
-In basic scenarios child classes shall only override GetPageByFilter,
-GetListByFilter or DeleteByFilter operations with specific filter function.
-All other operations can be used out of the box.
+In basic scenarios child classes shall only override ComposeFilter method
+that converts FilterParams into a filter BSON object. It is used by
+GetPageByFilterParams and GetCountByFilterParams, so pages and counts
+always use the same filter. All other operations can be used out of the box.
 
 In complex scenarios child classes can implement additional operations by
 accessing c.Collection properties.
 
+To perform several operations atomically run them within MongoDbConnection.WithTransaction
+and call WithContext variants of the operations with the received session context.
+Transactions require MongoDB replica set.
+
 Configuration parameters:
 
   - collection:                  (optional) MongoDB collection name
   - connection(s):
     - discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+    - protocol:                  (optional) connection protocol: mongodb or mongodb+srv (default: mongodb)
     - host:                      host name or IP address
-    - port:                      port number (default: 27017)
+    - port:                      port number (default: 27017), not used in mongodb+srv mode
     - uri:                       resource URI or connection string with all parameters in it
   - credential(s):
     - store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
@@ -37,17 +59,58 @@ Configuration parameters:
     - password:                  (optional) user password
   - options:
     - max_pool_size:             (optional) maximum connection pool size (default: 2)
+    - min_pool_size:             (optional) minimum number of connections kept in the pool (default: 0)
+    - max_connecting:            (optional) maximum number of connections established concurrently (default: 2)
+    - wait_queue_timeout:        (optional) connection wait queue timeout in milliseconds (not used, limited by operation_timeout)
     - keep_alive:                (optional) enable connection keep alive (default: true)
     - connect_timeout:           (optional) connection timeout in milliseconds (default: 5000)
     - socket_timeout:            (optional) socket timeout in milliseconds (default: 360000)
-    - auto_reconnect:            (optional) enable auto reconnection (default: true) (not used)
-    - reconnect_interval:        (optional) reconnection interval in milliseconds (default: 1000) (not used)
+    - auto_reconnect:            (optional) enable auto reconnection when connection is lost (default: true)
+    - reconnect_interval:        (optional) maximum interval between reconnection attempts in milliseconds (default: 1000)
+    - reconnect_attempts:        (optional) maximum number of reconnection attempts (default: 3)
     - max_page_size:             (optional) maximum page size (default: 100)
+    - id_type:                   (optional) type of generated ids: string, objectid or uuid (default: string).
+                                 With objectid the ids are stored as native ObjectIDs and exposed as hex strings
+    - id_field:                  (optional) name of the public id field of data items, stored as _id (default: Id)
+    - batch_size:                (optional) number of documents returned by a cursor in one batch (default: driver default)
+    - index_build_async:         (optional) build indexes in background without blocking Open (default: false)
+    - ignore_index_errors:       (optional) don't return an error from Open when indexes can't be created (default: false)
+    - collation_locale:          (optional) collation locale for queries and sorts, e.g. en (default: simple binary comparison)
+    - collation_strength:        (optional) collation strength from 1 to 5, 2 for case-insensitive comparison
+    - operation_timeout:         (optional) timeout for a single database operation in milliseconds, 0 for no timeout (default: 0)
+    - operation_retries:         (optional) number of retries of queries and idempotent writes after transient network errors (default: 0)
+    - strict_decode:             (optional) true to fail queries on documents that don't match the prototype instead of skipping them with a warning (default: false)
+    - slow_query_threshold:      (optional) duration in milliseconds after which queries are logged as warnings, 0 to disable (default: 0)
+    - max_time_ms:               (optional) maximum execution time of find queries on the server in milliseconds, 0 for no limit (default: 0).
+                                 Queries exceeding it fail with QUERY_TIMEOUT error
+    - soft_delete:               (optional) mark items as deleted instead of removing them (default: false)
+    - track_timestamps:          (optional) set creation and modification time of items when they are written (default: false)
+    - create_time_field:         (optional) name of the creation time field (default: create_time)
+    - update_time_field:         (optional) name of the modification time field (default: update_time)
+    - clear_mode:                (optional) drop to drop the collection with indexes or delete to delete all documents on clear (default: drop)
+    - convert_nested_ids:        (optional) rename ids in nested documents of map items between Id and _id (default: false)
+    - estimate_total:            (optional) use estimated count of the whole collection for page totals without filters (default: false)
     - replica_set:               (optional) name of replica set
-    - ssl:                       (optional) enable SSL connection (default: false) (not implements in this release)
+    - write_concern:             (optional) write acknowledgement: number of nodes or majority
+    - journal:                   (optional) wait until writes are committed to the journal
+    - write_concern_timeout:     (optional) write concern timeout in milliseconds
+    - read_concern:              (optional) read isolation level: local, available, majority, linearizable or snapshot
+    - retry_writes:              (optional) retry writes once after transient errors, requires replica set (default: true)
+    - retry_reads:               (optional) retry reads once after transient errors (default: true)
+    - compressors:               (optional) comma separated list of wire compressors: zstd, snappy, zlib
+    - zlib_level:                (optional) zlib compression level from -1 to 9
+    - srv:                       (optional) use DNS seedlist (mongodb+srv) connection format (default: false)
+    - ssl:                       (optional) enable SSL connection (default: false)
+    - tls_ca_file:               (optional) path to PEM file with CA certificates (default: system cert pool)
+    - tls_cert_file:             (optional) path to PEM file with client certificate
+    - tls_key_file:              (optional) path to PEM file with client private key (default: tls_cert_file)
     - auth_source:               (optional) authentication source
     - auth_user:                 (optional) authentication user name
     - auth_password:             (optional) authentication user password
+    - auth_mechanism:            (optional) authentication mechanism: SCRAM-SHA-1, SCRAM-SHA-256, MONGODB-X509, etc.
+    - auth_mechanism_properties: (optional) authentication mechanism properties as comma separated key:value pairs
+    - app_name:                  (optional) application name reported to the server (default: context name)
+    - monitor:                   (optional) log connection pool and command events at debug level (default: false)
     - debug:                     (optional) enable debug output (default: false). (not used)
 
 References:
@@ -55,6 +118,9 @@ References:
 - *:logger:*:*:1.0           (optional) ILogger components to pass log messages components to pass log messages
 - *:discovery:*:*:1.0        (optional) IDiscovery services
 - *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+- *:context-info:*:*:1.0     (optional) ContextInfo to get default application name
+- *:counters:*:*:1.0         (optional) ICounters components to record operation metrics
+- *:tracer:*:*:1.0           (optional) ITracer components to record operation traces
 
 Example:
 
@@ -124,7 +190,10 @@ type IdentifiableMongoDbPersistence struct {
 	MongoDbPersistence
 }
 
-// NewIdentifiableMongoDbPersistence is creates a new instance of the persistence component.
+// NewIdentifiableMongoDbPersistence is creates a new instance of the persistence component
+// that uses its own conversion methods and schema definition.
+// Use it when child type does not override ConvertToPublic, ConvertFromPublic or DefineSchema,
+// otherwise use InheritIdentifiableMongoDbPersistence and pass the child as overrides.
 // Parameters:
 //  - proto reflect.Type
 //  type of saved data, need for correct decode from DB
@@ -132,6 +201,27 @@ type IdentifiableMongoDbPersistence struct {
 //  (optional) a collection name.
 // Return *IdentifiableMongoDbPersistence
 // new created IdentifiableMongoDbPersistence component
+func NewIdentifiableMongoDbPersistence(proto reflect.Type, collection string) *IdentifiableMongoDbPersistence {
+	if collection == "" {
+		panic("Collection name could not be nil")
+	}
+	c := &IdentifiableMongoDbPersistence{}
+	c.MongoDbPersistence = *InheritMongoDbPersistence(c, proto, collection)
+	c.maxPageSize = 100
+	return c
+}
+
+// InheritIdentifiableMongoDbPersistence is creates a new instance of the persistence component
+// with conversion methods and schema definition overridden by a child type.
+// Parameters:
+//  - overrides IMongoDbPersistenceOverrides
+//  a child type that overrides conversion methods and schema definition
+//  - proto reflect.Type
+//  type of saved data, need for correct decode from DB
+//  - collection string
+//  (optional) a collection name.
+// Return *IdentifiableMongoDbPersistence
+// new created IdentifiableMongoDbPersistence component
 func InheritIdentifiableMongoDbPersistence(overrides IMongoDbPersistenceOverrides, proto reflect.Type, collection string) *IdentifiableMongoDbPersistence {
 	if collection == "" {
 		panic("Collection name could not be nil")
@@ -151,6 +241,273 @@ func (c *IdentifiableMongoDbPersistence) Configure(config *cconf.ConfigParams) {
 	c.maxPageSize = (int32)(config.GetAsIntegerWithDefault("options.max_page_size", (int)(c.maxPageSize)))
 }
 
+// ComposeFilter converts filter parameters into a filter BSON object.
+// This method shall be overridden in child types, the default implementation
+// returns an empty filter that matches all items.
+// Parameters:
+//   - filter *cdata.FilterParams
+//   filter parameters, never nil
+// Returns interface{}
+// a filter BSON object
+func (c *IdentifiableMongoDbPersistence) ComposeFilter(filter *cdata.FilterParams) interface{} {
+	return bson.M{}
+}
+
+// composeFilter calls ComposeFilter of the overrides to convert filter parameters.
+func (c *IdentifiableMongoDbPersistence) composeFilter(filter *cdata.FilterParams) interface{} {
+	if filter == nil {
+		filter = cdata.NewEmptyFilterParams()
+	}
+	if composer, ok := c.Overrides.(IMongoDbFilterComposer); ok {
+		return composer.ComposeFilter(filter)
+	}
+	return c.ComposeFilter(filter)
+}
+
+// GetPageByFilterParams is gets a page of data items retrieved by filter parameters
+// converted into a filter by ComposeFilter method.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter *cdata.FilterParams
+//   (optional) filter parameters
+//   - paging *cdata.PagingParams
+//   (optional) paging parameters
+//   - sort interface{}
+//   (optional) sorting BSON object or *SortParams
+// Returns page *cdata.DataPage, err error
+// a data page and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) GetPageByFilterParams(correlationId string, filter *cdata.FilterParams,
+	paging *cdata.PagingParams, sort interface{}) (page *cdata.DataPage, err error) {
+	return c.GetPageByFilter(correlationId, c.composeFilter(filter), paging, sort, nil)
+}
+
+// GetCountByFilterParams is gets a number of data items retrieved by filter parameters
+// converted into a filter by ComposeFilter method.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter *cdata.FilterParams
+//   (optional) filter parameters
+// Returns count int64, err error
+// a number of data items that satisfy the filter and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) GetCountByFilterParams(correlationId string, filter *cdata.FilterParams) (count int64, err error) {
+	return c.GetCountByFilter(correlationId, c.composeFilter(filter))
+}
+
+// generateId assigns a new unique id of the configured type to an item without id.
+func (c *IdentifiableMongoDbPersistence) generateId(item *interface{}) {
+	switch c.idType {
+	case "objectid":
+		if isEmptyId(c.getObjectId(*item)) {
+			c.setObjectId(item, primitive.NewObjectID().Hex())
+		}
+	case "uuid":
+		if isEmptyId(c.getObjectId(*item)) {
+			c.setObjectId(item, newUuid())
+		}
+	default:
+		if c.idField == "Id" {
+			cmpersist.GenerateObjectId(item)
+		} else if isEmptyId(c.getObjectId(*item)) {
+			c.setObjectId(item, cdata.IdGenerator.NextLong())
+		}
+	}
+}
+
+// getObjectId gets an id of a public item from the configured id field.
+func (c *IdentifiableMongoDbPersistence) getObjectId(item interface{}) interface{} {
+	if c.idField == "Id" {
+		return cmpersist.GetObjectId(item)
+	}
+	return refl.ObjectReader.GetProperty(item, c.idField)
+}
+
+// setObjectId sets an id of a public item into the configured id field.
+// Structs passed by value are copied to set the field.
+func (c *IdentifiableMongoDbPersistence) setObjectId(item *interface{}, id interface{}) {
+	if c.idField == "Id" {
+		cmpersist.SetObjectId(item, id)
+		return
+	}
+	value := reflect.ValueOf(*item)
+	if value.Kind() == reflect.Struct {
+		pointer := reflect.New(value.Type())
+		pointer.Elem().Set(value)
+		refl.ObjectWriter.SetProperty(pointer.Interface(), c.idField, id)
+		*item = pointer.Elem().Interface()
+		return
+	}
+	refl.ObjectWriter.SetProperty(*item, c.idField, id)
+}
+
+// composeId converts an id from a query into the type stored in the database.
+func (c *IdentifiableMongoDbPersistence) composeId(id interface{}) interface{} {
+	return c.toStorageId(id)
+}
+
+// composeIds converts ids from a query into the type stored in the database.
+func (c *IdentifiableMongoDbPersistence) composeIds(ids []interface{}) []interface{} {
+	result := make([]interface{}, len(ids))
+	for i, id := range ids {
+		result[i] = c.composeId(id)
+	}
+	return result
+}
+
+// composeTimestamps converts an item into a stored document with audit timestamps.
+// When create is true the creation time is set unless the item already has it,
+// otherwise an empty creation time is removed to keep the stored one.
+// When update is true the modification time is set to the current time.
+// Items are returned unchanged when timestamps are not tracked.
+func (c *IdentifiableMongoDbPersistence) composeTimestamps(item interface{}, create bool, update bool) interface{} {
+	if !c.trackTimestamps || item == nil {
+		return item
+	}
+	data, err := bson.Marshal(item)
+	if err != nil {
+		return item
+	}
+	doc := bson.D{}
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return item
+	}
+
+	now := time.Now().UTC()
+	for i := range doc {
+		if doc[i].Key == c.createTimeField && isEmptyTime(doc[i].Value) {
+			doc = append(doc[:i], doc[i+1:]...)
+			break
+		}
+	}
+	if create && !hasDocField(doc, c.createTimeField) {
+		doc = append(doc, bson.E{Key: c.createTimeField, Value: now})
+	}
+	if update {
+		doc = setDocField(doc, c.updateTimeField, now)
+	}
+	return doc
+}
+
+// composeUpdateTime adds the modification time into $set of an update with operators.
+// The update is returned unchanged when timestamps are not tracked
+// or when it already changes the modification time.
+func (c *IdentifiableMongoDbPersistence) composeUpdateTime(update bson.M) bson.M {
+	if !c.trackTimestamps {
+		return update
+	}
+	result := bson.M{}
+	for op, fields := range update {
+		var values map[string]interface{}
+		switch v := fields.(type) {
+		case bson.M:
+			values = v
+		case map[string]interface{}:
+			values = v
+		}
+		if _, ok := values[c.updateTimeField]; ok {
+			return update
+		}
+		result[op] = fields
+	}
+	set := bson.M{}
+	if values, ok := result["$set"].(bson.M); ok {
+		for k, v := range values {
+			set[k] = v
+		}
+	} else if values, ok := result["$set"].(map[string]interface{}); ok {
+		for k, v := range values {
+			set[k] = v
+		}
+	}
+	set[c.updateTimeField] = time.Now().UTC()
+	result["$set"] = set
+	return result
+}
+
+// isEmptyTime checks if a stored time value is missing or zero.
+func isEmptyTime(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case primitive.DateTime:
+		return v.Time().IsZero()
+	case time.Time:
+		return v.IsZero()
+	}
+	return false
+}
+
+// hasDocField checks if a document contains a field.
+func hasDocField(doc bson.D, key string) bool {
+	for _, e := range doc {
+		if e.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// setDocField sets a field in a document, adding it when it doesn't exist.
+func setDocField(doc bson.D, key string, value interface{}) bson.D {
+	for i := range doc {
+		if doc[i].Key == key {
+			doc[i].Value = value
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: key, Value: value})
+}
+
+// keepCreateTime sets the creation time of a replacing document to the stored one
+// when the item doesn't have it, so replaced items keep their creation time.
+// New items get the current time.
+func (c *IdentifiableMongoDbPersistence) keepCreateTime(ctx context.Context, correlationId string,
+	filter interface{}, item interface{}) (interface{}, error) {
+	doc, ok := item.(bson.D)
+	if !c.trackTimestamps || !ok || hasDocField(doc, c.createTimeField) {
+		return item, nil
+	}
+	options := mngoptions.FindOne().SetProjection(bson.M{c.createTimeField: 1})
+	foRes := c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+		return c.collectionFor(ctx).FindOne(ctx, filter, options)
+	})
+	stored := bson.M{}
+	if err := foRes.Decode(&stored); err != nil && err != mongo.ErrNoDocuments {
+		return nil, c.convertError(correlationId, err)
+	}
+	createTime, ok := stored[c.createTimeField]
+	if !ok || isEmptyTime(createTime) {
+		createTime = time.Now().UTC()
+	}
+	return append(doc, bson.E{Key: c.createTimeField, Value: createTime}), nil
+}
+
+// reviveDeleted replaces a soft deleted item with a given id by a new one.
+// The stored record is overwritten in place, so it is never physically removed.
+// Returns ErrNoDocuments when there is no soft deleted item with the id.
+func (c *IdentifiableMongoDbPersistence) reviveDeleted(ctx context.Context, correlationId string,
+	id interface{}, item interface{}) *mongo.SingleResult {
+	filter := bson.M{"_id": c.composeId(id), "deleted": true}
+	options := mngoptions.FindOneAndReplace().SetReturnDocument(mngoptions.After)
+	return c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+		return c.collectionFor(ctx).FindOneAndReplace(ctx, filter, item, options)
+	})
+}
+
+func isEmptyId(id interface{}) bool {
+	return id == nil || id == ""
+}
+
+// newUuid generates a random UUID version 4 string.
+func newUuid() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
 // GetListByIds is gets a list of data items retrieved by given unique ids.
 // Parameters:
 //   - correlationId  string
@@ -160,22 +517,69 @@ func (c *IdentifiableMongoDbPersistence) Configure(config *cconf.ConfigParams) {
 // Returns items []interface{}, err error
 // a data list and error, if theq are occured.
 func (c *IdentifiableMongoDbPersistence) GetListByIds(correlationId string, ids []interface{}) (items []interface{}, err error) {
+	return c.GetListByIdsWithContext(c.baseContext(), correlationId, ids)
+}
+
+// GetListByIdsWithContext is the same as GetListByIds, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) GetListByIdsWithContext(ctx context.Context, correlationId string, ids []interface{}) (items []interface{}, err error) {
 	filter := bson.M{
-		"_id": bson.M{"$in": ids},
+		"_id": bson.M{"$in": c.composeIds(ids)},
 	}
-	items, err = c.GetListByFilter(correlationId, filter, nil, nil)
+	items, err = c.GetListByFilterWithContext(ctx, correlationId, filter, nil, nil)
 	return items, err
 }
 
+// GetListByIdsOrdered is gets a list of data items retrieved by given unique ids
+// in the same order as the ids. Positions of missing items are filled with nil,
+// so the result always has the same length as the ids.
+// Parameters:
+//   - correlationId  string
+//   (optional) transaction id to Trace execution through call chain.
+//   - ids  []interface{}
+//   ids of data items to be retrieved
+// Returns items []interface{}, err error
+// a data list ordered by ids and error, if they are occured.
+func (c *IdentifiableMongoDbPersistence) GetListByIdsOrdered(correlationId string, ids []interface{}) (items []interface{}, err error) {
+	values, err := c.GetListByIds(correlationId, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	itemsById := make(map[interface{}]interface{}, len(values))
+	for _, value := range values {
+		itemsById[c.getObjectId(value)] = value
+	}
+
+	items = make([]interface{}, len(ids))
+	for i, id := range ids {
+		items[i] = itemsById[c.toPublicId(id)]
+	}
+	return items, nil
+}
+
 // GetOneById is gets a data item by its unique id.
 // Parameters:
 //   - correlationId     (optional) transaction id to Trace execution through call chain.
 //   - id                an id of data item to be retrieved.
 //   - callback          callback function that receives data item or error.
 func (c *IdentifiableMongoDbPersistence) GetOneById(correlationId string, id interface{}) (item interface{}, err error) {
-	filter := bson.M{"_id": id}
+	return c.GetOneByIdWithContext(c.baseContext(), correlationId, id)
+}
+
+// GetOneByIdWithContext is the same as GetOneById, but runs within a given context.
+// Pass a mongo.SessionContext to read within a transaction.
+func (c *IdentifiableMongoDbPersistence) GetOneByIdWithContext(ctx context.Context, correlationId string, id interface{}) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "get_one_by_id")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	filter := c.composeNotDeletedFilter(bson.M{"_id": c.composeId(id)})
 	docPointer := c.NewObjectByPrototype()
-	foRes := c.Collection.FindOne(c.Connection.Ctx, filter)
+	foRes := c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+		return c.getCollection().FindOne(ctx, filter)
+	})
 	ferr := foRes.Decode(docPointer.Interface())
 	if ferr != nil {
 		if ferr == mongo.ErrNoDocuments {
@@ -189,6 +593,59 @@ func (c *IdentifiableMongoDbPersistence) GetOneById(correlationId string, id int
 	return item, nil
 }
 
+// GetOneByIdWithProjection is gets only selected fields of a data item by its unique id.
+// Fields excluded by the projection are not read from the database,
+// so they are left with zero values when the prototype is a struct.
+// Use a map prototype or tolerate zero-valued fields in such items.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - id interface{}
+//   an id of data item to be retrieved.
+//   - projection interface{}
+//   projection BSON object or *ProjectionParams
+// Returns item interface{}, err error
+// partially retrieved data item or nil if it was not found and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) GetOneByIdWithProjection(correlationId string, id interface{},
+	projection interface{}) (item interface{}, err error) {
+	return c.GetOneByIdWithProjectionWithContext(c.baseContext(), correlationId, id, projection)
+}
+
+// GetOneByIdWithProjectionWithContext is the same as GetOneByIdWithProjection, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) GetOneByIdWithProjectionWithContext(ctx context.Context, correlationId string, id interface{},
+	projection interface{}) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "get_one_by_id_with_projection")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	options := mngoptions.FindOne()
+	if projection != nil {
+		options.Projection, err = c.composeProjection(projection)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filter := c.composeNotDeletedFilter(bson.M{"_id": c.composeId(id)})
+	docPointer := c.NewObjectByPrototype()
+	foRes := c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+		return c.getCollection().FindOne(ctx, filter, options)
+	})
+	ferr := foRes.Decode(docPointer.Interface())
+	if ferr != nil {
+		if ferr == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, ferr
+	}
+	c.Logger.Trace(correlationId, "Retrieved from %s by id = %s with projection", c.CollectionName, id)
+
+	item = c.Overrides.ConvertToPublic(docPointer)
+	return item, nil
+}
+
 // Create was creates a data item.
 // Parameters:
 //   - correlation_id string
@@ -198,27 +655,116 @@ func (c *IdentifiableMongoDbPersistence) GetOneById(correlationId string, id int
 // Returns result interface{}, err error
 // created item and error, if they are occured
 func (c *IdentifiableMongoDbPersistence) Create(correlationId string, item interface{}) (result interface{}, err error) {
+	return c.CreateWithContext(c.baseContext(), correlationId, item)
+}
+
+// CreateWithContext is the same as Create, but runs within a given context.
+// Pass a mongo.SessionContext to create the item within a transaction.
+func (c *IdentifiableMongoDbPersistence) CreateWithContext(ctx context.Context, correlationId string, item interface{}) (result interface{}, err error) {
+	timing := c.instrument(correlationId, "create")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
 	if item == nil {
 		return nil, nil
 	}
 	var newItem interface{}
 	newItem = cmpersist.CloneObject(item, c.Prototype)
 	// Assign unique id if not exist
-	cmpersist.GenerateObjectId(&newItem)
+	c.generateId(&newItem)
 	newItem = c.Overrides.ConvertFromPublic(newItem)
-	insRes, insErr := c.Collection.InsertOne(c.Connection.Ctx, newItem)
+	newItem = c.composeTimestamps(newItem, true, false)
+	insRes, insErr := c.collectionFor(ctx).InsertOne(ctx, newItem)
 	newItem = c.Overrides.ConvertToPublic(newItem)
 
 	if insErr != nil {
-		return nil, insErr
+		return nil, c.convertError(correlationId, insErr)
 	}
-	c.Logger.Trace(correlationId, "Created in %s with id = %s", c.Collection, insRes.InsertedID)
+	c.Logger.Trace(correlationId, "Created in %s with id = %s", c.CollectionName, insRes.InsertedID)
 
 	return newItem, nil
 }
 
+// CreateMany creates multiple data items in one batch.
+// Parameters:
+//   - correlation_id string
+//   (optional) transaction id to Trace execution through call chain.
+//   - items []interface{}
+//   items to be created.
+// Returns result []interface{}, err error
+// created items in the same order and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) CreateMany(correlationId string, items []interface{}) (result []interface{}, err error) {
+	return c.CreateManyWithContext(c.baseContext(), correlationId, items)
+}
+
+// CreateManyWithContext is the same as CreateMany, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) CreateManyWithContext(ctx context.Context, correlationId string, items []interface{}) (result []interface{}, err error) {
+	timing := c.instrument(correlationId, "create_many")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	result = make([]interface{}, 0, len(items))
+	if len(items) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	newItems := make([]interface{}, len(items))
+	for i, item := range items {
+		newItem := cmpersist.CloneObject(item, c.Prototype)
+		// Assign unique id if not exist
+		c.generateId(&newItem)
+		newItems[i] = c.composeTimestamps(c.Overrides.ConvertFromPublic(newItem), true, false)
+	}
+
+	insRes, insErr := c.collectionFor(ctx).InsertMany(ctx, newItems)
+	if insErr != nil {
+		return nil, c.convertError(correlationId, insErr)
+	}
+	c.Logger.Trace(correlationId, "Created %d items in %s", len(insRes.InsertedIDs), c.CollectionName)
+
+	for _, newItem := range newItems {
+		result = append(result, c.Overrides.ConvertToPublic(newItem))
+	}
+	return result, nil
+}
+
+// ImportFromReader is reads data items from newline-delimited JSON, one item per line,
+// and inserts them into the collection in batches. Malformed lines are logged and skipped.
+// Items are converted like in Create, so they get generated ids and creation time.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - r io.Reader
+//   a reader to read imported items from
+//   - batchSize int
+//   number of items inserted at once, 100 when it is not set
+// Returns count int64, err error
+// number of imported items and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) ImportFromReader(correlationId string, r io.Reader, batchSize int) (count int64, err error) {
+	return c.ImportFromReaderWithContext(c.baseContext(), correlationId, r, batchSize)
+}
+
+// ImportFromReaderWithContext is the same as ImportFromReader, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) ImportFromReaderWithContext(ctx context.Context, correlationId string, r io.Reader,
+	batchSize int) (count int64, err error) {
+	timing := c.instrument(correlationId, "import_from_reader")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.importFromReader(ctx, correlationId, r, batchSize, func(item interface{}) interface{} {
+		c.generateId(&item)
+		item = c.Overrides.ConvertFromPublic(item)
+		return c.composeTimestamps(item, true, false)
+	})
+}
+
 // Set is sets a data item. If the data item exists it updates it,
 // otherwise it create a new data item.
+// When soft delete is enabled a soft deleted item is overwritten by the given one
+// and becomes active again. The stored creation time is kept unless the item sets it.
 // Parameters:
 //   - correlation_id string
 //   (optional) transaction id to Trace execution through call chain.
@@ -227,24 +773,42 @@ func (c *IdentifiableMongoDbPersistence) Create(correlationId string, item inter
 // Returns result interface{}, err error
 // updated item and error, if they occured
 func (c *IdentifiableMongoDbPersistence) Set(correlationId string, item interface{}) (result interface{}, err error) {
+	return c.SetWithContext(c.baseContext(), correlationId, item)
+}
+
+// SetWithContext is the same as Set, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) SetWithContext(ctx context.Context, correlationId string, item interface{}) (result interface{}, err error) {
+	timing := c.instrument(correlationId, "set")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
 	if item == nil {
 		return nil, nil
 	}
 	var newItem interface{}
 	newItem = cmpersist.CloneObject(item, c.Prototype)
 	// Assign unique id if not exist
-	cmpersist.GenerateObjectId(&newItem)
-	id := cmpersist.GetObjectId(newItem)
-	c.Overrides.ConvertFromPublic(&newItem)
-	filter := bson.M{"_id": id}
+	c.generateId(&newItem)
+	id := c.getObjectId(newItem)
+	newItem = c.Overrides.ConvertFromPublic(newItem)
+	newItem = c.composeTimestamps(newItem, false, true)
+	// Soft deleted items are matched too, so the replacement revives them
+	filter := bson.M{"_id": c.composeId(id)}
+	if newItem, err = c.keepCreateTime(ctx, correlationId, filter, newItem); err != nil {
+		return nil, err
+	}
 	var options mngoptions.FindOneAndReplaceOptions
 	retDoc := mngoptions.After
 	options.ReturnDocument = &retDoc
 	upsert := true
 	options.Upsert = &upsert
-	frRes := c.Collection.FindOneAndReplace(c.Connection.Ctx, filter, newItem, &options)
+	frRes := c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+		return c.collectionFor(ctx).FindOneAndReplace(ctx, filter, newItem, &options)
+	})
 	if frRes.Err() != nil {
-		return nil, frRes.Err()
+		return nil, c.convertError(correlationId, frRes.Err())
 	}
 	c.Logger.Trace(correlationId, "Set in %s with id = %s", c.CollectionName, id)
 	docPointer := c.NewObjectByPrototype()
@@ -260,7 +824,130 @@ func (c *IdentifiableMongoDbPersistence) Set(correlationId string, item interfac
 	return item, nil
 }
 
+// CreateIfAbsent is creates a data item only if an item with the same id doesn't exist.
+// An existing item is left untouched and no error is returned, that makes repeated calls idempotent.
+// When soft delete is enabled a soft deleted item is treated as absent
+// and overwritten by the given one.
+// Parameters:
+//   - correlation_id string
+//   (optional) transaction id to Trace execution through call chain.
+//   - item interface{}
+//   an item to be created.
+// Returns result interface{}, err error
+// the stored item, which is the existing one when it was already present, and error, if they occured
+func (c *IdentifiableMongoDbPersistence) CreateIfAbsent(correlationId string, item interface{}) (result interface{}, err error) {
+	return c.CreateIfAbsentWithContext(c.baseContext(), correlationId, item)
+}
+
+// CreateIfAbsentWithContext is the same as CreateIfAbsent, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) CreateIfAbsentWithContext(ctx context.Context, correlationId string, item interface{}) (result interface{}, err error) {
+	timing := c.instrument(correlationId, "create_if_absent")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if item == nil {
+		return nil, nil
+	}
+	var newItem interface{}
+	newItem = cmpersist.CloneObject(item, c.Prototype)
+	// Assign unique id if not exist
+	c.generateId(&newItem)
+	id := c.getObjectId(newItem)
+	newItem = c.Overrides.ConvertFromPublic(newItem)
+	newItem = c.composeTimestamps(newItem, true, true)
+	var fuRes *mongo.SingleResult
+	if c.softDelete {
+		fuRes = c.reviveDeleted(ctx, correlationId, id, newItem)
+	}
+	if fuRes == nil || fuRes.Err() == mongo.ErrNoDocuments {
+		filter := bson.M{"_id": c.composeId(id)}
+		update := bson.D{{"$setOnInsert", newItem}}
+		var options mngoptions.FindOneAndUpdateOptions
+		retDoc := mngoptions.After
+		options.ReturnDocument = &retDoc
+		upsert := true
+		options.Upsert = &upsert
+		fuRes = c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+			return c.collectionFor(ctx).FindOneAndUpdate(ctx, filter, update, &options)
+		})
+	}
+	if fuRes.Err() != nil {
+		return nil, c.convertError(correlationId, fuRes.Err())
+	}
+	c.Logger.Trace(correlationId, "Created if absent in %s with id = %s", c.CollectionName, id)
+	docPointer := c.NewObjectByPrototype()
+	err = fuRes.Decode(docPointer.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	item = c.Overrides.ConvertToPublic(docPointer)
+	return item, nil
+}
+
+// ReplaceById is replaces a whole data item with a given one.
+// Unlike Update, that sets only the fields present in the item,
+// it replaces the stored document, so fields missing in the item are removed.
+// The item is not created if it doesn't exist or it is soft deleted.
+// The stored creation time is kept unless the item sets it.
+// Parameters:
+//   - correlation_id string
+//   (optional) transaction id to Trace execution through call chain.
+//   - item  interface{}
+//   an item to be replaced.
+// Returns result interface{}, err error
+// replaced item or nil if it was not found and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) ReplaceById(correlationId string, item interface{}) (result interface{}, err error) {
+	return c.ReplaceByIdWithContext(c.baseContext(), correlationId, item)
+}
+
+// ReplaceByIdWithContext is the same as ReplaceById, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) ReplaceByIdWithContext(ctx context.Context, correlationId string, item interface{}) (result interface{}, err error) {
+	timing := c.instrument(correlationId, "replace_by_id")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if item == nil {
+		return nil, nil
+	}
+	newItem := cmpersist.CloneObject(item, c.Prototype)
+	id := c.getObjectId(newItem)
+	newItem = c.Overrides.ConvertFromPublic(newItem)
+	newItem = c.composeTimestamps(newItem, false, true)
+	filter := c.composeNotDeletedFilter(bson.M{"_id": c.composeId(id)})
+	if newItem, err = c.keepCreateTime(ctx, correlationId, filter, newItem); err != nil {
+		return nil, err
+	}
+	var options mngoptions.FindOneAndReplaceOptions
+	retDoc := mngoptions.After
+	options.ReturnDocument = &retDoc
+	frRes := c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+		return c.collectionFor(ctx).FindOneAndReplace(ctx, filter, newItem, &options)
+	})
+	if frRes.Err() != nil {
+		if frRes.Err() == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, c.convertError(correlationId, frRes.Err())
+	}
+	c.Logger.Trace(correlationId, "Replaced in %s with id = %s", c.CollectionName, id)
+	docPointer := c.NewObjectByPrototype()
+	err = frRes.Decode(docPointer.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	item = c.Overrides.ConvertToPublic(docPointer)
+	return item, nil
+}
+
 // Update is updates a data item.
+// Only fields present in the item are set, other stored fields are kept.
+// Use ReplaceById to replace the whole document. Soft deleted items are not updated.
 // Parameters:
 //   - correlation_id string
 //   (optional) transaction id to Trace execution through call chain.
@@ -269,27 +956,69 @@ func (c *IdentifiableMongoDbPersistence) Set(correlationId string, item interfac
 // Returns result interface{}, err error
 // updated item and error, if theq are occured
 func (c *IdentifiableMongoDbPersistence) Update(correlationId string, item interface{}) (result interface{}, err error) {
+	return c.UpdateWithContext(c.baseContext(), correlationId, item)
+}
+
+// UpdateWithContext is the same as Update, but runs within a given context.
+// Pass a mongo.SessionContext to update the item within a transaction.
+func (c *IdentifiableMongoDbPersistence) UpdateWithContext(ctx context.Context, correlationId string, item interface{}) (result interface{}, err error) {
+	timing := c.instrument(correlationId, "update")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.update(ctx, correlationId, item, mngoptions.After)
+}
+
+// UpdateReturnBefore is the same as Update, but returns the item
+// as it was stored before the update, e.g. to compute changes.
+// Parameters:
+//   - correlation_id string
+//   (optional) transaction id to Trace execution through call chain.
+//   - item  interface{}
+//   an item to be updated.
+// Returns result interface{}, err error
+// item before the update or nil if it was not found and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) UpdateReturnBefore(correlationId string, item interface{}) (result interface{}, err error) {
+	return c.UpdateReturnBeforeWithContext(c.baseContext(), correlationId, item)
+}
+
+// UpdateReturnBeforeWithContext is the same as UpdateReturnBefore, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) UpdateReturnBeforeWithContext(ctx context.Context, correlationId string, item interface{}) (result interface{}, err error) {
+	timing := c.instrument(correlationId, "update_return_before")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.update(ctx, correlationId, item, mngoptions.Before)
+}
+
+// update sets fields of a data item and returns the item as it was before or after the update.
+func (c *IdentifiableMongoDbPersistence) update(ctx context.Context, correlationId string, item interface{},
+	retDoc mngoptions.ReturnDocument) (result interface{}, err error) {
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
 	if item == nil { //|| item.id == nil
 		return nil, nil
 	}
 	newItem := cmpersist.CloneObject(item, c.Prototype)
-	id := cmpersist.GetObjectId(newItem)
-	filter := bson.M{"_id": id}
+	id := c.getObjectId(newItem)
+	newItem = c.Overrides.ConvertFromPublic(newItem)
+	newItem = c.composeTimestamps(newItem, false, true)
+	filter := c.composeNotDeletedFilter(bson.M{"_id": c.composeId(id)})
 	update := bson.D{{"$set", newItem}}
 	var options mngoptions.FindOneAndUpdateOptions
-	retDoc := mngoptions.After
 	options.ReturnDocument = &retDoc
-	fuRes := c.Collection.FindOneAndUpdate(c.Connection.Ctx, filter, update, &options)
+	fuRes := c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+		return c.collectionFor(ctx).FindOneAndUpdate(ctx, filter, update, &options)
+	})
 	if fuRes.Err() != nil {
-		return nil, fuRes.Err()
+		if fuRes.Err() == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, c.convertError(correlationId, fuRes.Err())
 	}
 	c.Logger.Trace(correlationId, "Updated in %s with id = %s", c.CollectionName, id)
 	docPointer := c.NewObjectByPrototype()
 	err = fuRes.Decode(docPointer.Interface())
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return nil, nil
-		}
 		return nil, err
 	}
 
@@ -298,6 +1027,7 @@ func (c *IdentifiableMongoDbPersistence) Update(correlationId string, item inter
 }
 
 // UpdatePartially is updates only few selected fields in a data item.
+// Soft deleted items are not updated.
 // Parameters:
 //   - correlation_id string
 //   (optional) transaction id to Trace execution through call chain.
@@ -308,29 +1038,222 @@ func (c *IdentifiableMongoDbPersistence) Update(correlationId string, item inter
 // Returns item interface{}, err error
 // updated item and error, if they are occured
 func (c *IdentifiableMongoDbPersistence) UpdatePartially(correlationId string, id interface{}, data *cdata.AnyValueMap) (item interface{}, err error) {
+	return c.UpdatePartiallyWithContext(c.baseContext(), correlationId, id, data)
+}
+
+// UpdatePartiallyWithContext is the same as UpdatePartially, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) UpdatePartiallyWithContext(ctx context.Context, correlationId string, id interface{}, data *cdata.AnyValueMap) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "update_partially")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.updatePartially(ctx, correlationId, id, data, false, mngoptions.After)
+}
+
+// UpdatePartiallyReturnBefore is the same as UpdatePartially, but returns the item
+// as it was stored before the update, e.g. to compute changes.
+// Parameters:
+//   - correlation_id string
+//   (optional) transaction id to Trace execution through call chain.
+//   - id interface{}
+//   an id of data item to be updated.
+//   - data  cdata.AnyValueMap
+//   a map with fields to be updated.
+// Returns item interface{}, err error
+// item before the update or nil if it was not found and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) UpdatePartiallyReturnBefore(correlationId string, id interface{}, data *cdata.AnyValueMap) (item interface{}, err error) {
+	return c.UpdatePartiallyReturnBeforeWithContext(c.baseContext(), correlationId, id, data)
+}
+
+// UpdatePartiallyReturnBeforeWithContext is the same as UpdatePartiallyReturnBefore, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) UpdatePartiallyReturnBeforeWithContext(ctx context.Context, correlationId string, id interface{}, data *cdata.AnyValueMap) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "update_partially_return_before")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.updatePartially(ctx, correlationId, id, data, false, mngoptions.Before)
+}
+
+// UpsertPartially is updates only few selected fields in a data item
+// or creates a new data item with these fields and a given id, if it doesn't exist.
+// When soft delete is enabled a soft deleted item is updated and becomes active again.
+// Parameters:
+//   - correlation_id string
+//   (optional) transaction id to Trace execution through call chain.
+//   - id interface{}
+//   an id of data item to be updated or created.
+//   - data  cdata.AnyValueMap
+//   a map with fields to be set.
+// Returns item interface{}, err error
+// updated or created item and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) UpsertPartially(correlationId string, id interface{}, data *cdata.AnyValueMap) (item interface{}, err error) {
+	return c.UpsertPartiallyWithContext(c.baseContext(), correlationId, id, data)
+}
+
+// UpsertPartiallyWithContext is the same as UpsertPartially, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) UpsertPartiallyWithContext(ctx context.Context, correlationId string, id interface{}, data *cdata.AnyValueMap) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "upsert_partially")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.updatePartially(ctx, correlationId, id, data, true, mngoptions.After)
+}
+
+// updatePartially sets selected fields in a data item with a given id.
+// When upsert is true the item is created if it doesn't exist and gets id from the filter.
+// Depending on retDoc the item is returned as it was before or after the update.
+func (c *IdentifiableMongoDbPersistence) updatePartially(ctx context.Context, correlationId string, id interface{}, data *cdata.AnyValueMap,
+	upsert bool, retDoc mngoptions.ReturnDocument) (item interface{}, err error) {
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
 	if id == nil { //data == nil ||
 		return nil, nil
 	}
-	newItem := bson.M{}
+	newItem := map[string]interface{}{}
 	for k, v := range data.Value() {
 		newItem[k] = v
 	}
-	filter := bson.M{"_id": id}
-	update := bson.D{{"$set", newItem}}
+	filter := c.composeNotDeletedFilter(bson.M{"_id": c.composeId(id)})
+	if upsert {
+		// Soft deleted items are matched too and revived by the update
+		filter = bson.M{"_id": c.composeId(id)}
+	}
+	update := bson.D{{"$set", c.Overrides.ConvertFromPublicPartial(newItem)}}
+	if set, ok := c.composeTimestamps(update[0].Value, false, true).(bson.D); ok {
+		update = bson.D{{"$set", set}}
+		// Upserted items get creation time unless it is set explicitly
+		if upsert && !hasDocField(set, c.createTimeField) {
+			update = append(update, bson.E{Key: "$setOnInsert", Value: bson.M{c.createTimeField: time.Now().UTC()}})
+		}
+	}
+	if upsert && c.softDelete {
+		update = append(update, bson.E{Key: "$unset", Value: bson.M{"deleted": "", "deleted_time": ""}})
+	}
 	var options mngoptions.FindOneAndUpdateOptions
-	retDoc := mngoptions.After
 	options.ReturnDocument = &retDoc
-	fuRes := c.Collection.FindOneAndUpdate(c.Connection.Ctx, filter, update, &options)
+	options.Upsert = &upsert
+	fuRes := c.retrySingleResult(ctx, correlationId, func() *mongo.SingleResult {
+		return c.collectionFor(ctx).FindOneAndUpdate(ctx, filter, update, &options)
+	})
 	if fuRes.Err() != nil {
-		return nil, fuRes.Err()
+		if fuRes.Err() == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, c.convertError(correlationId, fuRes.Err())
 	}
-	c.Logger.Trace(correlationId, "Updated partially in %s with id = %s", c.Collection, id)
+	c.Logger.Trace(correlationId, "Updated partially in %s with id = %s", c.CollectionName, id)
 	docPointer := c.NewObjectByPrototype()
 	err = fuRes.Decode(docPointer.Interface())
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	item = c.Overrides.ConvertToPublic(docPointer)
+	return item, nil
+}
+
+// UpdateManyByFilter is updates selected fields in all data items that match to a given filter.
+// Items are updated on the server side without loading them.
+// When soft delete is enabled deleted items are not updated.
+// When timestamps are tracked the modification time is set to the current time.
+// Parameters:
+//   - correlation_id string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+//   - update *cdata.AnyValueMap
+//   a map with fields to be updated.
+// Returns count int64, err error
+// number of modified items and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) UpdateManyByFilter(correlationId string, filter interface{}, update *cdata.AnyValueMap) (count int64, err error) {
+	return c.UpdateManyByFilterWithContext(c.baseContext(), correlationId, filter, update)
+}
+
+// UpdateManyByFilterWithContext is the same as UpdateManyByFilter, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) UpdateManyByFilterWithContext(ctx context.Context, correlationId string, filter interface{}, update *cdata.AnyValueMap) (count int64, err error) {
+	timing := c.instrument(correlationId, "update_many_by_filter")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	if update == nil || len(update.Value()) == 0 {
+		return 0, cerror.NewBadRequestError(correlationId, "EMPTY_UPDATE", "Update fields are not defined")
+	}
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	newItem := bson.M{}
+	for k, v := range update.Value() {
+		newItem[k] = v
+	}
+	if c.trackTimestamps {
+		newItem[c.updateTimeField] = time.Now().UTC()
+	}
+	upd := bson.D{{"$set", newItem}}
+	var umRes *mongo.UpdateResult
+	umErr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		umRes, err = c.collectionFor(ctx).UpdateMany(ctx, filter, upd)
+		return err
+	})
+	if umErr != nil {
+		return 0, c.convertError(correlationId, umErr)
+	}
+	c.Logger.Trace(correlationId, "Updated %d items in %s", umRes.ModifiedCount, c.CollectionName)
+	return umRes.ModifiedCount, nil
+}
+
+// ModifyById is atomically modifies a data item by its unique id using update operators
+// like $inc, $push or $unset. It allows to change the item without read-modify-write races.
+// When timestamps are tracked the modification time is set unless the update changes it.
+// Parameters:
+//   - correlation_id string
+//   (optional) transaction id to Trace execution through call chain.
+//   - id interface{}
+//   an id of data item to be modified.
+//   - update bson.M
+//   an update document where all keys are update operators.
+// Returns item interface{}, err error
+// modified item, nil if it was not found, and error, if they are occured
+func (c *IdentifiableMongoDbPersistence) ModifyById(correlationId string, id interface{}, update bson.M) (item interface{}, err error) {
+	return c.ModifyByIdWithContext(c.baseContext(), correlationId, id, update)
+}
+
+// ModifyByIdWithContext is the same as ModifyById, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) ModifyByIdWithContext(ctx context.Context, correlationId string, id interface{}, update bson.M) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "modify_by_id")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	if len(update) == 0 {
+		return nil, cerror.NewBadRequestError(correlationId, "EMPTY_UPDATE", "Update operators are not defined")
+	}
+	for key := range update {
+		if !strings.HasPrefix(key, "$") {
+			return nil, cerror.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Update key "+key+" is not an update operator").WithDetails("key", key)
+		}
+	}
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if id == nil {
+		return nil, nil
+	}
+	filter := c.composeNotDeletedFilter(bson.M{"_id": c.composeId(id)})
+	update = c.composeUpdateTime(update)
+	options := mngoptions.FindOneAndUpdate().SetReturnDocument(mngoptions.After)
+	fuRes := c.collectionFor(ctx).FindOneAndUpdate(ctx, filter, update, options)
+	if fuRes.Err() != nil {
+		if fuRes.Err() == mongo.ErrNoDocuments {
 			return nil, nil
 		}
+		return nil, c.convertError(correlationId, fuRes.Err())
+	}
+	c.Logger.Trace(correlationId, "Modified in %s with id = %s", c.CollectionName, id)
+	docPointer := c.NewObjectByPrototype()
+	err = fuRes.Decode(docPointer.Interface())
+	if err != nil {
 		return nil, err
 	}
 
@@ -339,18 +1262,39 @@ func (c *IdentifiableMongoDbPersistence) UpdatePartially(correlationId string, i
 }
 
 // DeleteById is deleted a data item by it"s unique id.
+// When soft delete is enabled the item is only marked as deleted.
 // Parameters:
 //   - correlation_id string
 //   (optional) transaction id to Trace execution through call chain.
 //   - id  interface{}
 //   an id of the item to be deleted
 // Returns item interface{}, err error
-// deleted item and error, if they are occured
+// deleted item, nil if it was not found, and error, if they are occured
 func (c *IdentifiableMongoDbPersistence) DeleteById(correlationId string, id interface{}) (item interface{}, err error) {
-	filter := bson.M{"_id": id}
-	fdRes := c.Collection.FindOneAndDelete(c.Connection.Ctx, filter)
+	return c.DeleteByIdWithContext(c.baseContext(), correlationId, id)
+}
+
+// DeleteByIdWithContext is the same as DeleteById, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) DeleteByIdWithContext(ctx context.Context, correlationId string, id interface{}) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "delete_by_id")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	filter := bson.M{"_id": c.composeId(id)}
+	var fdRes *mongo.SingleResult
+	if c.softDelete {
+		options := mngoptions.FindOneAndUpdate().SetReturnDocument(mngoptions.After)
+		fdRes = c.collectionFor(ctx).FindOneAndUpdate(ctx, c.composeNotDeletedFilter(filter), c.composeSoftDeleteUpdate(), options)
+	} else {
+		fdRes = c.collectionFor(ctx).FindOneAndDelete(ctx, filter)
+	}
 	if fdRes.Err() != nil {
-		return nil, fdRes.Err()
+		if errors.Is(fdRes.Err(), mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, c.convertError(correlationId, fdRes.Err())
 	}
 	c.Logger.Trace(correlationId, "Deleted from %s with id = %s", c.CollectionName, id)
 	docPointer := c.NewObjectByPrototype()
@@ -371,11 +1315,17 @@ func (c *IdentifiableMongoDbPersistence) DeleteById(correlationId string, id int
 //   (optional) transaction id to Trace execution through call chain.
 //   - ids  []interface{}
 //   ids of data items to be deleted.
-// Retrun error
-// error or nil for success.
-func (c *IdentifiableMongoDbPersistence) DeleteByIds(correlationId string, ids []interface{}) error {
+// Retrun count int64, err error
+// number of actually deleted items and error or nil for success.
+// Ids of missing items are not counted.
+func (c *IdentifiableMongoDbPersistence) DeleteByIds(correlationId string, ids []interface{}) (count int64, err error) {
+	return c.DeleteByIdsWithContext(c.baseContext(), correlationId, ids)
+}
+
+// DeleteByIdsWithContext is the same as DeleteByIds, but runs within a given context.
+func (c *IdentifiableMongoDbPersistence) DeleteByIdsWithContext(ctx context.Context, correlationId string, ids []interface{}) (count int64, err error) {
 	filter := bson.M{
-		"_id": bson.M{"$in": ids},
+		"_id": bson.M{"$in": c.composeIds(ids)},
 	}
-	return c.DeleteByFilter(correlationId, filter)
+	return c.DeleteCountByFilterWithContext(ctx, correlationId, filter)
 }
@@ -0,0 +1,32 @@
+package persistence
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IndexField is a field of a compound index with its sort direction.
+type IndexField struct {
+	// A name of the indexed field
+	Name string
+	// 1 for ascending or -1 for descending order, 0 is treated as ascending
+	Direction int
+}
+
+// ComposeIndexKeys converts index fields into ordered index keys.
+// Unlike bson.M, the keys keep the order of fields, that defines which queries can use a compound index.
+// Parameters:
+//   - fields []IndexField
+//   index fields in the order of significance
+// Returns bson.D
+// ordered index keys
+func ComposeIndexKeys(fields []IndexField) bson.D {
+	keys := make(bson.D, 0, len(fields))
+	for _, field := range fields {
+		direction := 1
+		if field.Direction < 0 {
+			direction = -1
+		}
+		keys = append(keys, bson.E{Key: field.Name, Value: direction})
+	}
+	return keys
+}
@@ -0,0 +1,72 @@
+package persistence
+
+import (
+	ccount "github.com/pip-services3-go/pip-services3-components-go/count"
+	ctrace "github.com/pip-services3-go/pip-services3-components-go/trace"
+)
+
+// InstrumentTiming measures execution of a single persistence operation.
+// It is created by MongoDbPersistence when operation starts and shall be
+// ended by EndTiming when operation completes.
+// Traces are recorded with component, operation and correlation id,
+// the only attributes supported by Pip.Services tracers.
+type InstrumentTiming struct {
+	correlationId string
+	operation     string
+	name          string
+	counters      *ccount.CompositeCounters
+	endTiming     func()
+	traceTiming   *ctrace.TraceTiming
+}
+
+// NewInstrumentTiming creates a new instance of the operation timing.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to trace execution through call chain.
+//   - component string
+//   a name of the traced component, e.g. mongodb.<collection>.
+//   - operation string
+//   a name of the operation.
+//   - counters *ccount.CompositeCounters
+//   (optional) counters to record the operation metrics.
+//   - tracer *ctrace.CompositeTracer
+//   (optional) tracer to record the operation trace.
+// Returns *InstrumentTiming
+// started operation timing
+func NewInstrumentTiming(correlationId string, component string, operation string,
+	counters *ccount.CompositeCounters, tracer *ctrace.CompositeTracer) *InstrumentTiming {
+	c := InstrumentTiming{
+		correlationId: correlationId,
+		operation:     operation,
+		name:          component + "." + operation,
+		counters:      counters,
+	}
+	if counters != nil {
+		counters.IncrementOne(c.name + ".exec_count")
+		c.endTiming = counters.BeginTiming(c.name + ".exec_time").EndTiming
+	}
+	if tracer != nil {
+		c.traceTiming = tracer.BeginTrace(correlationId, component, operation)
+	}
+	return &c
+}
+
+// EndTiming completes measurement of the operation.
+// Parameters:
+//   - err error
+//   an error returned by the operation or nil for success.
+func (c *InstrumentTiming) EndTiming(err error) {
+	if c.endTiming != nil {
+		c.endTiming()
+	}
+	if err != nil && c.counters != nil {
+		c.counters.IncrementOne(c.name + ".exec_errors")
+	}
+	if c.traceTiming != nil {
+		if err != nil {
+			c.traceTiming.EndFailure(err)
+		} else {
+			c.traceTiming.EndTrace()
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package persistence
+
+import (
+	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
+)
+
+/*
+MongoDbError is an application error caused by an error of MongoDB driver.
+ApplicationError keeps only the message of its cause, so the original driver error
+is kept here to be checked with errors.Is and errors.As.
+errors.As also extracts the wrapped *cerror.ApplicationError with its code and details.
+
+Example:
+
+  _, err := persistence.Create("123", item)
+  var writeErr mongo.WriteException
+  if errors.As(err, &writeErr) {
+    ...
+  }
+  var appErr *cerror.ApplicationError
+  if errors.As(err, &appErr) && appErr.Code == "DUPLICATE_KEY" {
+    ...
+  }
+*/
+type MongoDbError struct {
+	*cerror.ApplicationError
+	cause error
+}
+
+// NewMongoDbError creates a new application error that keeps the original driver error.
+// Parameters:
+//   - appErr *cerror.ApplicationError
+//   an application error with the cause message
+//   - cause error
+//   an original error returned by MongoDB driver
+// Returns *MongoDbError
+// created error
+func NewMongoDbError(appErr *cerror.ApplicationError, cause error) *MongoDbError {
+	return &MongoDbError{
+		ApplicationError: appErr,
+		cause:            cause,
+	}
+}
+
+// Unwrap returns the original error returned by MongoDB driver.
+func (e *MongoDbError) Unwrap() error {
+	return e.cause
+}
+
+// As sets the wrapped application error into a target of *cerror.ApplicationError type.
+// It is called by errors.As.
+func (e *MongoDbError) As(target interface{}) bool {
+	if appErr, ok := target.(**cerror.ApplicationError); ok {
+		*appErr = e.ApplicationError
+		return true
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
+	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
+	crefer "github.com/pip-services3-go/pip-services3-commons-go/refer"
+	clog "github.com/pip-services3-go/pip-services3-components-go/log"
+	conn "github.com/pip-services3-go/pip-services3-mongodb-go/connect"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	mngoptions "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+MongoDbGridFsPersistence persistence component that stores binary files in MongoDB GridFS bucket.
+It can share MongoDbConnection with document persistence components to keep
+attachments in the same database as the documents that refer to them.
+
+Configuration parameters:
+
+  - bucket:                      (optional) GridFS bucket name (default: fs)
+  - connection(s):
+    - discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+    - host:                      host name or IP address
+    - port:                      port number (default: 27017)
+    - database:                  database name
+    - uri:                       resource URI or connection string with all parameters in it
+  - credential(s):
+    - store_key:                 (optional) a key to retrieve the credentials from ICredentialStore
+    - username:                  (optional) user name
+    - password:                  (optional) user password
+  - options:
+    - chunk_size:                (optional) size of file chunks in bytes (default: 255 KB)
+    - operation_timeout:         (optional) timeout for a single upload, download or delete in milliseconds, 0 for no timeout (default: 0)
+    - other connection options supported by MongoDbConnection
+
+ References:
+
+ - *:logger:*:*:1.0           (optional) ILogger components to pass log messages
+ - *:connection:mongodb:*:1.0 (optional) Shared MongoDB connection
+ - *:discovery:*:*:1.0        (optional) IDiscovery services
+ - *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+
+Example:
+
+  persistence := NewMongoDbGridFsPersistence("attachments")
+  persistence.Configure(cconf.NewConfigParamsFromTuples(
+      "connection.host", "localhost",
+      "connection.port", "27017",
+      "connection.database", "test",
+  ))
+  err := persistence.Open("123")
+  ...
+  fileId, err := persistence.Upload("123", "report.pdf", file, bson.M{"owner": "user1"})
+  ...
+  var buffer bytes.Buffer
+  err = persistence.Download("123", fileId, &buffer)
+*/
+type MongoDbGridFsPersistence struct {
+	defaultConfig    cconf.ConfigParams
+	config           cconf.ConfigParams
+	references       crefer.IReferences
+	opened           bool
+	operationTimeout time.Duration
+	chunkSize        int32
+
+	// The dependency resolver.
+	DependencyResolver crefer.DependencyResolver
+	// The logger.
+	Logger clog.CompositeLogger
+	// The MongoDB connection component.
+	Connection *conn.MongoDbConnection
+	// The MongoDB connection object.
+	Client *mongodrv.Client
+	// The MongoDb database object.
+	Db *mongodrv.Database
+	// The GridFS bucket name.
+	BucketName string
+}
+
+// NewMongoDbGridFsPersistence creates a new instance of the GridFS persistence component.
+// Parameters:
+//   - bucket string
+//   (optional) a bucket name, fs when empty
+// Return *MongoDbGridFsPersistence
+// new created MongoDbGridFsPersistence component
+func NewMongoDbGridFsPersistence(bucket string) *MongoDbGridFsPersistence {
+	if bucket == "" {
+		bucket = mngoptions.DefaultName
+	}
+	c := MongoDbGridFsPersistence{
+		BucketName: bucket,
+	}
+	c.defaultConfig = *cconf.NewConfigParamsFromTuples(
+		"bucket", "",
+		"dependencies.connection", "*:connection:mongodb:*:1.0",
+		"options.max_pool_size", "2",
+		"options.keep_alive", "1000",
+		"options.connect_timeout", "5000",
+		"options.auto_reconnect", "true",
+		"options.debug", "true",
+	)
+	c.DependencyResolver = *crefer.NewDependencyResolverWithParams(&c.defaultConfig, c.references)
+	c.Logger = *clog.NewCompositeLogger()
+	c.config = *cconf.NewEmptyConfigParams()
+	return &c
+}
+
+// Configure method is configures component by passing configuration parameters.
+// Parameters:
+//   - config  *cconf.ConfigParams
+//   configuration parameters to be set.
+func (c *MongoDbGridFsPersistence) Configure(config *cconf.ConfigParams) {
+	config = config.SetDefaults(&c.defaultConfig)
+	c.config = *config
+	c.DependencyResolver.Configure(config)
+	c.BucketName = config.GetAsStringWithDefault("bucket", c.BucketName)
+	c.chunkSize = (int32)(config.GetAsIntegerWithDefault("options.chunk_size", 0))
+	operationTimeout := config.GetAsIntegerWithDefault("options.operation_timeout", 0)
+	c.operationTimeout = (time.Duration)(operationTimeout) * time.Millisecond
+}
+
+// SetReferences method are sets references to dependent components.
+// Parameters:
+//   - references crefer.IReferences
+//   references to locate the component dependencies.
+func (c *MongoDbGridFsPersistence) SetReferences(references crefer.IReferences) {
+	c.references = references
+	c.Logger.SetReferences(references)
+
+	// Get connection
+	c.DependencyResolver.SetReferences(references)
+	con, _ := c.DependencyResolver.GetOneOptional("connection").(*conn.MongoDbConnection)
+	if con != nil {
+		c.Connection = con
+	}
+}
+
+// UnsetReferences method is unsets (clears) previously set references to dependent components.
+func (c *MongoDbGridFsPersistence) UnsetReferences() {
+	c.Connection = nil
+}
+
+// IsOpen method is checks if the component is opened.
+// Returns true if the component has been opened and false otherwise.
+func (c *MongoDbGridFsPersistence) IsOpen() bool {
+	return c.opened
+}
+
+// Open method is opens the component.
+// Parameters:
+//   - correlationId  string
+//   (optional) transaction id to trace execution through call chain.
+// Return error
+// error or nil when no errors occured.
+func (c *MongoDbGridFsPersistence) Open(correlationId string) error {
+	if c.opened {
+		return nil
+	}
+	if c.Connection == nil {
+		c.Connection = conn.NewMongoDbConnection()
+		c.Connection.Configure(&c.config)
+		if c.references != nil {
+			c.Connection.SetReferences(c.references)
+		}
+	}
+	err := c.Connection.Open(correlationId)
+	if err != nil {
+		return err
+	}
+	if !c.Connection.IsOpen() {
+		return cerror.NewConnectionError(correlationId, "CONNECT_FAILED", "MongoDB connection is not opened")
+	}
+	c.Client = c.Connection.GetConnection()
+	c.Db = c.Connection.GetDatabase()
+	c.opened = true
+	c.Logger.Debug(correlationId, "Connected to mongodb database %s, bucket %s", c.Connection.GetDatabaseName(), c.BucketName)
+	return nil
+}
+
+// Close methos closes component and frees used resources.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to trace execution through call chain.
+// Return error
+// error or nil when no errors occured.
+func (c *MongoDbGridFsPersistence) Close(correlationId string) error {
+	if !c.opened {
+		return nil
+	}
+	if c.Connection == nil {
+		return cerror.NewInvalidStateError(correlationId, "NO_CONNECTION", "MongoDb connection is missing")
+	}
+	err := c.Connection.Close(correlationId)
+	if err != nil {
+		return err
+	}
+	c.opened = false
+	c.Client = nil
+	c.Db = nil
+	return nil
+}
+
+// openBucket creates a bucket for a single operation.
+// Buckets keep operation deadlines, so they are not shared between concurrent operations.
+func (c *MongoDbGridFsPersistence) openBucket(correlationId string) (*gridfs.Bucket, error) {
+	if !c.opened || c.Db == nil {
+		return nil, cerror.NewInvalidStateError(correlationId, "NOT_OPENED", "GridFS persistence is not opened")
+	}
+	options := mngoptions.GridFSBucket().SetName(c.BucketName)
+	if c.chunkSize > 0 {
+		options.SetChunkSizeBytes(c.chunkSize)
+	}
+	bucket, err := gridfs.NewBucket(c.Db, options)
+	if err != nil {
+		return nil, c.wrapError(correlationId, "open_bucket", err)
+	}
+	if c.operationTimeout > 0 {
+		deadline := time.Now().Add(c.operationTimeout)
+		bucket.SetReadDeadline(deadline)
+		bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+// wrapError wraps an error returned by MongoDB driver into an application error
+// with correlation id, operation and bucket name.
+func (c *MongoDbGridFsPersistence) wrapError(correlationId string, operation string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if appErr, ok := err.(*cerror.ApplicationError); ok {
+		return appErr
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return cerror.NewError("Operation "+operation+" on bucket "+c.BucketName+" failed: "+err.Error()).
+		WithCorrelationId(correlationId).
+		WithDetails("operation", operation).
+		WithDetails("bucket", c.BucketName).
+		WithCause(err)
+}
+
+// Upload stores a file read from a given reader in the bucket.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to trace execution through call chain.
+//   - filename string
+//   a name of the file
+//   - r io.Reader
+//   a reader with the file content
+//   - metadata bson.M
+//   (optional) metadata stored with the file
+// Returns fileId interface{}, err error
+// id of the stored file and error, if they are occured
+func (c *MongoDbGridFsPersistence) Upload(correlationId string, filename string, r io.Reader, metadata bson.M) (fileId interface{}, err error) {
+	bucket, err := c.openBucket(correlationId)
+	if err != nil {
+		return nil, err
+	}
+	options := mngoptions.GridFSUpload()
+	if metadata != nil {
+		options.SetMetadata(metadata)
+	}
+	id, err := bucket.UploadFromStream(filename, r, options)
+	if err != nil {
+		return nil, c.wrapError(correlationId, "upload", err)
+	}
+	c.Logger.Trace(correlationId, "Uploaded file %s to %s with id = %s", filename, c.BucketName, id.Hex())
+	return id, nil
+}
+
+// Download writes content of a file with a given id into a writer.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to trace execution through call chain.
+//   - fileId interface{}
+//   an id of the file returned by Upload
+//   - w io.Writer
+//   a writer to receive the file content
+// Return error
+// NotFoundError when the file does not exist or error, if they are occured
+func (c *MongoDbGridFsPersistence) Download(correlationId string, fileId interface{}, w io.Writer) error {
+	bucket, err := c.openBucket(correlationId)
+	if err != nil {
+		return err
+	}
+	size, err := bucket.DownloadToStream(fileId, w)
+	if err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return cerror.NewNotFoundError(correlationId, "FILE_NOT_FOUND",
+				"File is not found in "+c.BucketName).WithDetails("file_id", fileId)
+		}
+		return c.wrapError(correlationId, "download", err)
+	}
+	c.Logger.Trace(correlationId, "Downloaded %d bytes from %s with id = %v", size, c.BucketName, fileId)
+	return nil
+}
+
+// Delete removes a file with a given id and all its chunks.
+// Deleting a missing file is not an error.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to trace execution through call chain.
+//   - fileId interface{}
+//   an id of the file returned by Upload
+// Return error
+// error or nil when no errors occured.
+func (c *MongoDbGridFsPersistence) Delete(correlationId string, fileId interface{}) error {
+	bucket, err := c.openBucket(correlationId)
+	if err != nil {
+		return err
+	}
+	err = bucket.Delete(fileId)
+	if err != nil {
+		if err == gridfs.ErrFileNotFound {
+			return nil
+		}
+		return c.wrapError(correlationId, "delete", err)
+	}
+	c.Logger.Trace(correlationId, "Deleted file from %s with id = %v", c.BucketName, fileId)
+	return nil
+}
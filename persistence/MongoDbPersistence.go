@@ -1,20 +1,33 @@
 package persistence
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
 	"math/rand"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
 	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
 	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
 	crefer "github.com/pip-services3-go/pip-services3-commons-go/refer"
+	ccount "github.com/pip-services3-go/pip-services3-components-go/count"
 	clog "github.com/pip-services3-go/pip-services3-components-go/log"
+	ctrace "github.com/pip-services3-go/pip-services3-components-go/trace"
 	cmpersist "github.com/pip-services3-go/pip-services3-data-go/persistence"
 	conn "github.com/pip-services3-go/pip-services3-mongodb-go/connect"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongodrv "go.mongodb.org/mongo-driver/mongo"
 	mngoptions "go.mongodb.org/mongo-driver/mongo/options"
 	mongoopt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 type IMongoDbPersistenceOverrides interface {
@@ -37,8 +50,9 @@ Configuration parameters:
   - collection:                  (optional) MongoDB collection name
   - connection(s):
     - discovery_key:             (optional) a key to retrieve the connection from IDiscovery
+    - protocol:                  (optional) connection protocol: mongodb or mongodb+srv (default: mongodb)
     - host:                      host name or IP address
-    - port:                      port number (default: 27017)
+    - port:                      port number (default: 27017), not used in mongodb+srv mode
     - database:                  database name
     - uri:                       resource URI or connection string with all parameters in it
   - credential(s):
@@ -47,15 +61,58 @@ Configuration parameters:
     - password:                  (optional) user password
   - options:
     - max_pool_size:             (optional) maximum connection pool size (default: 2)
+    - min_pool_size:             (optional) minimum number of connections kept in the pool (default: 0)
+    - max_connecting:            (optional) maximum number of connections established concurrently (default: 2)
+    - wait_queue_timeout:        (optional) connection wait queue timeout in milliseconds (not used, limited by operation_timeout)
     - keep_alive:                (optional) enable connection keep alive (default: true)
     - connect_timeout:           (optional) connection timeout in milliseconds (default: 5000)
     - socket_timeout:            (optional) socket timeout in milliseconds (default: 360000)
-    - auto_reconnect:            (optional) enable auto reconnection (default: true) (not used)
-    - reconnect_interval:        (optional) reconnection interval in milliseconds (default: 1000) (not used)
+    - auto_reconnect:            (optional) enable auto reconnection when connection is lost (default: true)
+    - reconnect_interval:        (optional) maximum interval between reconnection attempts in milliseconds (default: 1000)
+    - reconnect_attempts:        (optional) maximum number of reconnection attempts (default: 3)
     - max_page_size:             (optional) maximum page size (default: 100)
+    - id_type:                   (optional) type of generated ids: string, objectid or uuid (default: string).
+                                 With objectid the ids are stored as native ObjectIDs and exposed as hex strings
+    - id_field:                  (optional) name of the public id field of data items, stored as _id (default: Id)
+    - batch_size:                (optional) number of documents returned by a cursor in one batch (default: driver default)
+    - index_build_async:         (optional) build indexes in background without blocking Open (default: false)
+    - ignore_index_errors:       (optional) don't return an error from Open when indexes can't be created (default: false)
+    - collation_locale:          (optional) collation locale for queries and sorts, e.g. en (default: simple binary comparison)
+    - collation_strength:        (optional) collation strength from 1 to 5, 2 for case-insensitive comparison
+    - operation_timeout:         (optional) timeout for a single database operation in milliseconds, 0 for no timeout (default: 0)
+    - operation_retries:         (optional) number of retries of queries and idempotent writes after transient network errors (default: 0)
+    - strict_decode:             (optional) true to fail queries on documents that don't match the prototype instead of skipping them with a warning (default: false)
+    - slow_query_threshold:      (optional) duration in milliseconds after which queries are logged as warnings, 0 to disable (default: 0)
+    - max_time_ms:               (optional) maximum execution time of find queries on the server in milliseconds, 0 for no limit (default: 0).
+                                 Queries exceeding it fail with QUERY_TIMEOUT error
+    - soft_delete:               (optional) mark items as deleted instead of removing them (default: false)
+    - track_timestamps:          (optional) set creation and modification time of items when they are written (default: false)
+    - create_time_field:         (optional) name of the creation time field (default: create_time)
+    - update_time_field:         (optional) name of the modification time field (default: update_time)
+    - clear_mode:                (optional) drop to drop the collection with indexes or delete to delete all documents on clear (default: drop)
+    - convert_nested_ids:        (optional) rename ids in nested documents of map items between Id and _id (default: false)
+    - estimate_total:            (optional) use estimated count of the whole collection for page totals without filters (default: false)
     - replica_set:               (optional) name of replica set
-    - ssl:                       (optional) enable SSL connection (default: false) (not implements in this release)
+    - write_concern:             (optional) write acknowledgement: number of nodes or majority
+    - journal:                   (optional) wait until writes are committed to the journal
+    - write_concern_timeout:     (optional) write concern timeout in milliseconds
+    - read_concern:              (optional) read isolation level: local, available, majority, linearizable or snapshot
+    - retry_writes:              (optional) retry writes once after transient errors, requires replica set (default: true)
+    - retry_reads:               (optional) retry reads once after transient errors (default: true)
+    - compressors:               (optional) comma separated list of wire compressors: zstd, snappy, zlib
+    - zlib_level:                (optional) zlib compression level from -1 to 9
+    - srv:                       (optional) use DNS seedlist (mongodb+srv) connection format (default: false)
+    - ssl:                       (optional) enable SSL connection (default: false)
+    - tls_ca_file:               (optional) path to PEM file with CA certificates (default: system cert pool)
+    - tls_cert_file:             (optional) path to PEM file with client certificate
+    - tls_key_file:              (optional) path to PEM file with client private key (default: tls_cert_file)
     - auth_source:               (optional) authentication source
+    - auth_user:                 (optional) authentication user name
+    - auth_password:             (optional) authentication user password
+    - auth_mechanism:            (optional) authentication mechanism: SCRAM-SHA-1, SCRAM-SHA-256, MONGODB-X509, etc.
+    - auth_mechanism_properties: (optional) authentication mechanism properties as comma separated key:value pairs
+    - app_name:                  (optional) application name reported to the server (default: context name)
+    - monitor:                   (optional) log connection pool and command events at debug level (default: false)
     - debug:                     (optional) enable debug output (default: false). (not used)
 
  References:
@@ -63,6 +120,9 @@ Configuration parameters:
  - *:logger:*:*:1.0           (optional) ILogger components to pass log messages
  - *:discovery:*:*:1.0        (optional) IDiscovery services
  - *:credential-store:*:*:1.0 (optional) Credential stores to resolve credentials
+ - *:context-info:*:*:1.0     (optional) ContextInfo to get default application name
+ - *:counters:*:*:1.0         (optional) ICounters components to record operation metrics
+ - *:tracer:*:*:1.0           (optional) ITracer components to record operation traces
 
 Example:
 
@@ -77,19 +137,7 @@ Example:
   }
 
   func (c * MyMongoDbPersistence) GetByName(correlationId string, name string) (item interface{}, err error) {
-    filter := bson.M{"name": name}
-    docPointer := NewObjectByPrototype(c.Prototype)
-    foRes := c.Collection.FindOne(context.TODO(), filter)
-    ferr := foRes.Decode(docPointer.Interface())
-    if ferr != nil {
-        if ferr == mongo.ErrNoDocuments {
-           return nil, nil
-        }
-        return nil, ferr
-    }
-    item = docPointer.Elem().Interface()
-    c.Overrides.ConvertToPublic(&item)
-    return item, nil
+    return c.GetOneByFilter(correlationId, bson.M{"name": name}, nil)
   }
 
     func (c * MyMongoDbPersistence) Set(correlatonId string, item MyData) (result interface{}, err error) {
@@ -159,18 +207,42 @@ type MongoDbPersistence struct {
 	Overrides IMongoDbPersistenceOverrides
 	Prototype reflect.Type
 
-	defaultConfig   cconf.ConfigParams
-	config          cconf.ConfigParams
-	references      crefer.IReferences
-	opened          bool
-	localConnection bool
-	indexes         []mongodrv.IndexModel
-	maxPageSize     int32
+	defaultConfig    cconf.ConfigParams
+	config           cconf.ConfigParams
+	references       crefer.IReferences
+	opened           bool
+	indexes          []mongodrv.IndexModel
+	collectionOpts   *mngoptions.CreateCollectionOptions
+	maxPageSize      int32
+	operationTimeout time.Duration
+	slowQueryTime    time.Duration
+	maxTime          time.Duration
+	softDelete       bool
+	estimateTotal    bool
+	convertNestedIds bool
+	batchSize        int32
+	collation        *mngoptions.Collation
+	idType           string
+	indexBuildAsync  bool
+	ignoreIdxErrors  bool
+	trackTimestamps  bool
+	createTimeField  string
+	updateTimeField  string
+	clearMode        string
+	idField          string
+	operationRetries int
+	strictDecode     bool
+	// Guards Client, Db and Collection that are replaced on reconnect
+	connLock sync.RWMutex
 
 	// The dependency resolver.
 	DependencyResolver crefer.DependencyResolver
 	// The logger.
 	Logger clog.CompositeLogger
+	// The performance counters.
+	Counters ccount.CompositeCounters
+	// The tracer.
+	Tracer ctrace.CompositeTracer
 	// The MongoDB connection component.
 	Connection *conn.MongoDbConnection
 	// The MongoDB connection object.
@@ -182,18 +254,23 @@ type MongoDbPersistence struct {
 	//  The MongoDb database object.
 	Db *mongodrv.Database
 	// The MongoDb collection object.
+	// Client, Db and Collection are replaced under a lock when the connection is re-established.
 	Collection *mongodrv.Collection
 }
 
 // InheritMongoDbPersistence are creates a new instance of the persistence component.
 // Parameters:
 //   - proto reflect.Type
-//   type of saved data, need for correct decode from DB
+//   type of saved data, need for correct decode from DB,
+//   nil to work with documents as map[string]interface{}
 //   - collection  string
 //   a collection name.
 // Return *MongoDbPersistence
 // new created MongoDbPersistence component
 func InheritMongoDbPersistence(overrides IMongoDbPersistenceOverrides, proto reflect.Type, collection string) *MongoDbPersistence {
+	if proto == nil {
+		proto = reflect.TypeOf(map[string]interface{}{})
+	}
 	c := MongoDbPersistence{
 		Overrides: overrides,
 		Prototype: proto,
@@ -210,9 +287,13 @@ func InheritMongoDbPersistence(overrides IMongoDbPersistenceOverrides, proto ref
 	)
 	c.DependencyResolver = *crefer.NewDependencyResolverWithParams(&c.defaultConfig, c.references)
 	c.Logger = *clog.NewCompositeLogger()
+	c.Counters = *ccount.NewCompositeCounters()
+	c.Tracer = *ctrace.NewCompositeTracer(nil)
 	c.CollectionName = collection
 	c.indexes = make([]mongodrv.IndexModel, 0, 10)
 	c.config = *cconf.NewEmptyConfigParams()
+	c.maxPageSize = 100
+	c.idField = "Id"
 
 	return &c
 }
@@ -226,28 +307,59 @@ func (c *MongoDbPersistence) Configure(config *cconf.ConfigParams) {
 	c.config = *config
 	c.DependencyResolver.Configure(config)
 	c.CollectionName = config.GetAsStringWithDefault("collection", c.CollectionName)
+	c.maxPageSize = (int32)(config.GetAsIntegerWithDefault("options.max_page_size", (int)(c.maxPageSize)))
+	operationTimeout := config.GetAsIntegerWithDefault("options.operation_timeout", 0)
+	c.operationTimeout = (time.Duration)(operationTimeout) * time.Millisecond
+	slowQueryTime := config.GetAsIntegerWithDefault("options.slow_query_threshold", 0)
+	c.slowQueryTime = (time.Duration)(slowQueryTime) * time.Millisecond
+	maxTime := config.GetAsIntegerWithDefault("options.max_time_ms", 0)
+	c.maxTime = (time.Duration)(maxTime) * time.Millisecond
+	c.softDelete = config.GetAsBooleanWithDefault("options.soft_delete", false)
+	c.estimateTotal = config.GetAsBooleanWithDefault("options.estimate_total", false)
+	c.convertNestedIds = config.GetAsBooleanWithDefault("options.convert_nested_ids", false)
+	c.batchSize = (int32)(config.GetAsIntegerWithDefault("options.batch_size", 0))
+	c.idType = strings.ToLower(config.GetAsStringWithDefault("options.id_type", "string"))
+	c.idField = config.GetAsStringWithDefault("options.id_field", "Id")
+	c.operationRetries = config.GetAsIntegerWithDefault("options.operation_retries", 0)
+	c.strictDecode = config.GetAsBooleanWithDefault("options.strict_decode", false)
+	c.indexBuildAsync = config.GetAsBooleanWithDefault("options.index_build_async", false)
+	c.ignoreIdxErrors = config.GetAsBooleanWithDefault("options.ignore_index_errors", false)
+	c.trackTimestamps = config.GetAsBooleanWithDefault("options.track_timestamps", false)
+	c.createTimeField = config.GetAsStringWithDefault("options.create_time_field", "create_time")
+	c.updateTimeField = config.GetAsStringWithDefault("options.update_time_field", "update_time")
+	c.clearMode = strings.ToLower(config.GetAsStringWithDefault("options.clear_mode", "drop"))
+	c.collation = nil
+	collationLocale := config.GetAsString("options.collation_locale")
+	if collationLocale != "" {
+		c.collation = &mngoptions.Collation{
+			Locale:   collationLocale,
+			Strength: config.GetAsIntegerWithDefault("options.collation_strength", 0),
+		}
+	}
 }
 
 // SetReferences method are sets references to dependent components.
+// A MongoDbConnection registered as *:connection:mongodb:*:1.0 is shared by all persistence components
+// that reference it, otherwise the component creates its own local connection.
 // Parameters:
 //   - references crefer.IReferences
 //   references to locate the component dependencies.
 func (c *MongoDbPersistence) SetReferences(references crefer.IReferences) {
 	c.references = references
 	c.Logger.SetReferences(references)
+	c.Counters.SetReferences(references)
+	c.Tracer.SetReferences(references)
 
 	// Get connection
 	c.DependencyResolver.SetReferences(references)
-	con := c.DependencyResolver.GetOneOptional("connection").(*conn.MongoDbConnection)
+	// Missing connection or component of another type is not a shared connection
+	con, _ := c.DependencyResolver.GetOneOptional("connection").(*conn.MongoDbConnection)
 	if con != nil {
 		c.Connection = con
 	}
 	// Or create a local one
 	if c.Connection == nil {
 		c.Connection = c.createConnection()
-		c.localConnection = true
-	} else {
-		c.localConnection = false
 	}
 }
 
@@ -265,12 +377,414 @@ func (c *MongoDbPersistence) createConnection() *conn.MongoDbConnection {
 	return connection
 }
 
+// baseContext returns the connection context or background context when connection is not opened.
+func (c *MongoDbPersistence) baseContext() context.Context {
+	if c.Connection == nil || c.Connection.Ctx == nil {
+		return context.Background()
+	}
+	return c.Connection.Ctx
+}
+
+// newContext creates a context for a single database operation derived from the connection context.
+// When operation timeout is configured the context is bound by it.
+func (c *MongoDbPersistence) newContext() (context.Context, context.CancelFunc) {
+	return c.newContextFrom(c.baseContext())
+}
+
+// newContextFrom creates a context for a single database operation derived from a given context.
+// Values of the parent context, like a transaction session, are kept in the new context.
+func (c *MongoDbPersistence) newContextFrom(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.operationTimeout > 0 {
+		return context.WithTimeout(ctx, c.operationTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// convertError converts MongoDB driver errors into application errors.
+// Duplicate key errors are converted into ConflictError with DUPLICATE_KEY code,
+// other errors are returned unchanged.
+// Converted errors are MongoDbError, so the driver error can be still checked with errors.As.
+func (c *MongoDbPersistence) convertError(correlationId string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if mongodrv.IsDuplicateKeyError(err) {
+		return NewMongoDbError(cerror.NewConflictError(correlationId, "DUPLICATE_KEY",
+			"Item with the same key already exists in "+c.CollectionName).WithCause(err), err)
+	}
+	// IndexNotFound is returned when text search runs without text index
+	if serr, ok := err.(mongodrv.ServerError); ok && serr.HasErrorCode(27) {
+		return NewMongoDbError(cerror.NewInvalidStateError(correlationId, "NO_TEXT_INDEX",
+			"Text index is required to search in "+c.CollectionName).WithCause(err), err)
+	}
+	// MaxTimeMSExpired is returned when a query runs longer than max_time_ms
+	if serr, ok := err.(mongodrv.ServerError); ok && serr.HasErrorCode(50) {
+		return NewMongoDbError(cerror.NewError("Query in "+c.CollectionName+" exceeded the maximum execution time").
+			WithCode("QUERY_TIMEOUT").WithCorrelationId(correlationId).WithCause(err), err)
+	}
+	// DocumentValidationFailure is returned when a written document doesn't match the collection validator
+	if serr, ok := err.(mongodrv.ServerError); ok && serr.HasErrorCode(121) {
+		appErr := cerror.NewBadRequestError(correlationId, "VALIDATION_FAILED",
+			"Item doesn't match the schema of "+c.CollectionName).WithCause(err)
+		if details := validationDetails(err); details != nil {
+			appErr = appErr.WithDetails("validation", details)
+		}
+		return NewMongoDbError(appErr, err)
+	}
+	return err
+}
+
+// validationDetails extracts the description of failed rules from a document validation error.
+// Returns nil when the server didn't report the details.
+func validationDetails(err error) interface{} {
+	var raw bson.Raw
+	switch e := err.(type) {
+	case mongodrv.WriteException:
+		for _, writeErr := range e.WriteErrors {
+			if writeErr.Code == 121 {
+				raw = writeErr.Details
+				break
+			}
+		}
+	case mongodrv.CommandError:
+		if e.Raw != nil {
+			if value, lookupErr := e.Raw.LookupErr("errInfo"); lookupErr == nil {
+				raw, _ = value.DocumentOK()
+			}
+		}
+	}
+	if raw == nil {
+		return nil
+	}
+	var details bson.M
+	if bson.Unmarshal(raw, &details) != nil {
+		return nil
+	}
+	return details
+}
+
+// instrument starts measurement of an operation with a given name.
+// Counters are named as mongodb.<collection>.<name>.exec_time, exec_count and exec_errors.
+// Traces are recorded for mongodb.<collection> component and <name> operation.
+func (c *MongoDbPersistence) instrument(correlationId string, name string) *InstrumentTiming {
+	return NewInstrumentTiming(correlationId, "mongodb."+c.CollectionName, name, &c.Counters, &c.Tracer)
+}
+
+// traceQuery logs completion of a query started at a given time.
+// Queries that took longer than the slow query threshold are logged
+// as warnings with their filter and duration to catch performance regressions.
+func (c *MongoDbPersistence) traceQuery(correlationId string, start time.Time, filter interface{}, message string, args ...interface{}) {
+	elapsed := time.Since(start)
+	if c.slowQueryTime > 0 && elapsed >= c.slowQueryTime {
+		c.Logger.Warn(correlationId, "Slow query in %s took %d ms with filter %v", c.CollectionName, elapsed.Milliseconds(), filter)
+		return
+	}
+	c.Logger.Trace(correlationId, message, args...)
+}
+
+// NewFindOptions creates options for find operations with configured cursor batch size,
+// maximum execution time and collation.
+// When they are not set the driver defaults are used.
+// Returns *mngoptions.FindOptions
+// created find options
+func (c *MongoDbPersistence) NewFindOptions() *mngoptions.FindOptions {
+	options := mngoptions.Find()
+	if c.batchSize > 0 {
+		options.SetBatchSize(c.batchSize)
+	}
+	if c.maxTime > 0 {
+		options.SetMaxTime(c.maxTime)
+	}
+	if c.collation != nil {
+		options.SetCollation(c.collation)
+	}
+	return options
+}
+
+// WithHint creates find options that force a query to use a given index.
+// Pass the options to GetPageByFilterWithOptions or GetListByFilterWithOptions.
+// When the index does not exist the query fails with the driver error.
+// Parameters:
+//   - hint interface{}
+//   an index name string, index keys BSON object or *SortParams
+// Returns *mngoptions.FindOptions
+// find options with the index hint
+func WithHint(hint interface{}) *mngoptions.FindOptions {
+	if sortParams, ok := hint.(*SortParams); ok && sortParams != nil {
+		hint = sortParams.ToBson()
+	}
+	return mngoptions.Find().SetHint(hint)
+}
+
+// writeConcernKey is a context key to keep a write concern for a single operation.
+type writeConcernKey struct{}
+
+// WithWriteConcern creates a context that overrides the connection write concern
+// for write operations called with it, e.g. to require majority acknowledgement for critical writes.
+// Pass the context to CreateWithContext, UpdateWithContext, DeleteByIdWithContext and other write methods.
+// Operations within transactions shall not set write concern, it is defined by the transaction.
+// Parameters:
+//   - ctx context.Context
+//   a parent context
+//   - wc *writeconcern.WriteConcern
+//   a write concern for operations, e.g. writeconcern.New(writeconcern.WMajority())
+// Returns context.Context
+// a context with the write concern
+func WithWriteConcern(ctx context.Context, wc *writeconcern.WriteConcern) context.Context {
+	return context.WithValue(ctx, writeConcernKey{}, wc)
+}
+
+// collectionFor returns the collection to write within a given context.
+// When the context has a write concern set by WithWriteConcern the collection is cloned with it,
+// otherwise the write concern of the connection is used.
+func (c *MongoDbPersistence) collectionFor(ctx context.Context) *mongodrv.Collection {
+	collection := c.getCollection()
+	wc, ok := ctx.Value(writeConcernKey{}).(*writeconcern.WriteConcern)
+	if !ok || wc == nil {
+		return collection
+	}
+	clone, err := collection.Clone(mngoptions.Collection().SetWriteConcern(wc))
+	if err != nil {
+		return collection
+	}
+	return clone
+}
+
+// getClient returns the current client, it is safe to call while the connection is re-established.
+func (c *MongoDbPersistence) getClient() *mongodrv.Client {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+	return c.Client
+}
+
+// getDatabase returns the current database, it is safe to call while the connection is re-established.
+func (c *MongoDbPersistence) getDatabase() *mongodrv.Database {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+	return c.Db
+}
+
+// getCollection returns the current collection, it is safe to call while the connection is re-established.
+func (c *MongoDbPersistence) getCollection() *mongodrv.Collection {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+	return c.Collection
+}
+
+// setConnection replaces client, database and collection objects under the lock.
+func (c *MongoDbPersistence) setConnection(client *mongodrv.Client, db *mongodrv.Database, collection *mongodrv.Collection) {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	c.Client = client
+	c.Db = db
+	c.Collection = collection
+}
+
+// retryBackoff is a delay before the first retry of an operation, it grows with every attempt
+const retryBackoff = 100 * time.Millisecond
+
+// isTransientError checks if an operation failed because of a transient network or server error,
+// so it can succeed when it is repeated. Logical errors, like duplicate keys, are not transient.
+func isTransientError(err error) bool {
+	if err == nil || mongodrv.IsDuplicateKeyError(err) {
+		return false
+	}
+	if mongodrv.IsNetworkError(err) {
+		return true
+	}
+	if serr, ok := err.(mongodrv.ServerError); ok {
+		return serr.HasErrorLabel("RetryableWriteError") || serr.HasErrorLabel("NetworkError")
+	}
+	return false
+}
+
+// RunWithRetries runs a database operation and repeats it after transient network errors
+// up to the number of times set by options.operation_retries with a growing delay.
+// Child components can use it for custom idempotent operations over c.Collection.
+// Operations within transactions are not retried, the whole transaction shall be retried instead.
+// Parameters:
+//   - ctx context.Context
+//   operation context, retries stop when it is done
+//   - correlationId string
+//   (optional) transaction id to trace execution through call chain.
+//   - fn func() error
+//   an operation to run
+// Return error
+// error of the last attempt or nil when the operation succeeded
+func (c *MongoDbPersistence) RunWithRetries(ctx context.Context, correlationId string, fn func() error) error {
+	err := fn()
+	if c.operationRetries <= 0 || mongodrv.SessionFromContext(ctx) != nil {
+		return err
+	}
+	for attempt := 1; attempt <= c.operationRetries && isTransientError(err); attempt++ {
+		c.Logger.Debug(correlationId, "Retrying operation in %s after transient error (attempt %d): %v",
+			c.CollectionName, attempt, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After((time.Duration)(attempt) * retryBackoff):
+		}
+		err = fn()
+	}
+	return err
+}
+
+// retrySingleResult runs an operation that returns a single result with RunWithRetries.
+func (c *MongoDbPersistence) retrySingleResult(ctx context.Context, correlationId string,
+	fn func() *mongodrv.SingleResult) *mongodrv.SingleResult {
+	var result *mongodrv.SingleResult
+	_ = c.RunWithRetries(ctx, correlationId, func() error {
+		result = fn()
+		return result.Err()
+	})
+	return result
+}
+
+// handleDecodeError processes a stored document that can't be decoded into the prototype.
+// When options.strict_decode is set it returns an error that aborts the query,
+// otherwise the document is logged and skipped.
+func (c *MongoDbPersistence) handleDecodeError(correlationId string, doc bson.Raw, err error) error {
+	if c.strictDecode {
+		return cerror.NewInternalError(correlationId, "DECODE_FAILED",
+			"Failed to decode document from "+c.CollectionName+": "+err.Error()).
+			WithDetails("id", doc.Lookup("_id").String()).
+			WithCause(err)
+	}
+	c.Logger.Warn(correlationId, "Skipped document with id %v in %s that doesn't match the prototype: %v",
+		doc.Lookup("_id"), c.CollectionName, err)
+	return nil
+}
+
+// endTiming completes measurement of an operation. When the operation failed
+// because connection to MongoDB was lost and auto reconnection is enabled,
+// it re-establishes the connection, so the following operations can succeed.
+// Returns the operation error wrapped with the operation context.
+func (c *MongoDbPersistence) endTiming(timing *InstrumentTiming, err error) error {
+	timing.EndTiming(err)
+
+	if err != nil && c.Connection != nil && c.Connection.IsAutoReconnect() && conn.IsDisconnectError(err) {
+		c.Logger.Warn(timing.correlationId, "Connection to mongodb was lost in %s, reconnecting", c.CollectionName)
+		rerr := c.Connection.Reconnect(timing.correlationId, c.getClient())
+		if rerr != nil {
+			c.Logger.Error(timing.correlationId, rerr, "Failed to reconnect %s to mongodb", c.CollectionName)
+		} else {
+			c.refreshConnection()
+		}
+	}
+	return c.wrapError(timing.correlationId, timing.operation, err)
+}
+
+// wrapError wraps an error returned by MongoDB driver into an application error
+// with correlation id, operation and collection name to simplify troubleshooting.
+// The original error is kept in MongoDbError and can be checked with errors.Is and errors.As.
+// Application errors get the correlation id if it is missing.
+// ErrNoDocuments, context and transaction errors are returned unchanged, so callers can
+// compare them directly, detect cancellation and the driver can retry transactions.
+func (c *MongoDbPersistence) wrapError(correlationId string, operation string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var appErr *cerror.ApplicationError
+	if errors.As(err, &appErr) {
+		if appErr.CorrelationId == "" {
+			appErr.CorrelationId = correlationId
+		}
+		return err
+	}
+	if err == mongodrv.ErrNoDocuments {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	// Transaction errors are checked by the driver to retry transactions
+	if serr, ok := err.(mongodrv.ServerError); ok &&
+		(serr.HasErrorLabel("TransientTransactionError") || serr.HasErrorLabel("UnknownTransactionCommitResult")) {
+		return err
+	}
+	appErr = cerror.NewError("Operation "+operation+" on collection "+c.CollectionName+" failed: "+err.Error()).
+		WithCorrelationId(correlationId).
+		WithDetails("operation", operation).
+		WithDetails("collection", c.CollectionName).
+		WithCause(err)
+	return NewMongoDbError(appErr, err)
+}
+
+// refreshConnection updates client, database and collection objects
+// after the connection was re-established.
+func (c *MongoDbPersistence) refreshConnection() {
+	if !c.opened || c.Connection == nil || c.Connection.GetConnection() == nil {
+		return
+	}
+	db := c.Connection.GetDatabase()
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+	c.Client = c.Connection.GetConnection()
+	c.Db = db
+	c.Collection = db.Collection(c.CollectionName)
+}
+
+// composeSort converts sort order into BSON object accepted by MongoDB driver.
+// Sort order can be defined as SortParams or as raw BSON object.
+func (c *MongoDbPersistence) composeSort(sort interface{}) interface{} {
+	if sortParams, ok := sort.(*SortParams); ok {
+		if sortParams == nil {
+			return nil
+		}
+		return sortParams.ToBson()
+	}
+	return sort
+}
+
+// composeProjection converts projection into BSON object accepted by MongoDB driver.
+// Projection can be defined as ProjectionParams or as raw BSON object.
+func (c *MongoDbPersistence) composeProjection(sel interface{}) (interface{}, error) {
+	if projection, ok := sel.(*ProjectionParams); ok {
+		if projection == nil {
+			return nil, nil
+		}
+		return projection.ToBson()
+	}
+	return sel, nil
+}
+
+// composeNotDeletedFilter adds a condition to skip soft deleted items to a given filter.
+// When soft delete is disabled the filter is returned unchanged.
+func (c *MongoDbPersistence) composeNotDeletedFilter(filter interface{}) interface{} {
+	if !c.softDelete {
+		return filter
+	}
+	notDeleted := bson.M{"deleted": bson.M{"$ne": true}}
+	if filter == nil {
+		return notDeleted
+	}
+	return bson.M{"$and": bson.A{filter, notDeleted}}
+}
+
+// composeSoftDeleteUpdate creates an update that marks items as deleted.
+func (c *MongoDbPersistence) composeSoftDeleteUpdate() interface{} {
+	return bson.M{"$set": bson.M{
+		"deleted":      true,
+		"deleted_time": time.Now().UTC(),
+	}}
+}
+
 // Defines schema for the collection.
 // This method shall be overloaded in child classes
 func (c *MongoDbPersistence) DefineSchema() {
 	// Overload this implementation in child classes
 }
 
+// EnsureCollection method adds definition of the collection to create it on opening.
+// It allows to create capped collections or collections with JSON schema validators.
+// Existing collection is not changed.
+// Parameters:
+//   - opts *mngoptions.CreateCollectionOptions
+//   options of the created collection
+func (c *MongoDbPersistence) EnsureCollection(opts *mngoptions.CreateCollectionOptions) {
+	c.collectionOpts = opts
+}
+
 // EnsureIndex method are adds index definition to create it on opening
 // Parameters:
 //   - keys interface{}
@@ -288,7 +802,238 @@ func (c *MongoDbPersistence) EnsureIndex(keys interface{}, options *mongoopt.Ind
 	c.indexes = append(c.indexes, index)
 }
 
-// ConvertFromPublic method help convert object (map) from public view by replaced "Id" to "_id" field
+// EnsureCompoundIndex method adds definition of compound index to create it on opening.
+// Index keys keep the order of given fields, so ordering mistakes of bson.M keys are avoided.
+// Use ComposeIndexKeys with EnsureIndex to set index options.
+// Parameters:
+//   - fields []IndexField
+//   index fields in the order of significance
+func (c *MongoDbPersistence) EnsureCompoundIndex(fields []IndexField) {
+	if len(fields) == 0 {
+		return
+	}
+	c.EnsureIndex(ComposeIndexKeys(fields), nil)
+}
+
+// EnsureTTLIndex method adds definition of TTL index to create it on opening.
+// MongoDB removes documents automatically when the time in the indexed field
+// is older than expiration period. The field must contain a date (time.Time) value
+// or an array of dates, documents with other values in the field never expire.
+// Parameters:
+//   - field string
+//   a name of the date field
+//   - expireAfter time.Duration
+//   expiration period, it is rounded to seconds
+func (c *MongoDbPersistence) EnsureTTLIndex(field string, expireAfter time.Duration) {
+	if field == "" {
+		return
+	}
+	keys := bson.D{{Key: field, Value: 1}}
+	options := mongoopt.Index().SetExpireAfterSeconds(int32(expireAfter.Seconds()))
+	c.EnsureIndex(keys, options)
+}
+
+// EnsureUniqueIndex method adds definition of unique index to create it on opening.
+// Writes that violate the index fail with ConflictError with DUPLICATE_KEY code.
+// Parameters:
+//   - keys interface{}
+//   index keys (fields)
+func (c *MongoDbPersistence) EnsureUniqueIndex(keys interface{}) {
+	c.EnsureIndex(keys, mongoopt.Index().SetUnique(true))
+}
+
+// EnsureTextIndex method adds definition of text index to create it on opening.
+// The text index is required for full-text search with SearchByText.
+// A collection can have only one text index, so all searched fields shall be listed here.
+// Parameters:
+//   - fields ...string
+//   names of the string fields to search in
+func (c *MongoDbPersistence) EnsureTextIndex(fields ...string) {
+	if len(fields) == 0 {
+		return
+	}
+	keys := bson.D{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: field, Value: "text"})
+	}
+	c.EnsureIndex(keys, nil)
+}
+
+// EnsureGeoIndex method adds definition of 2dsphere index to create it on opening.
+// The index is required for GetNearByFilter queries. The field must contain
+// GeoJSON objects like {type: "Point", coordinates: [longitude, latitude]}.
+// Parameters:
+//   - field string
+//   a name of the location field
+func (c *MongoDbPersistence) EnsureGeoIndex(field string) {
+	if field == "" {
+		return
+	}
+	c.EnsureIndex(bson.D{{Key: field, Value: "2dsphere"}}, nil)
+}
+
+// EnsurePartialIndex method adds definition of partial index to create it on opening.
+// The index contains only documents that match a given filter, so a unique
+// index can be applied to a subset of documents, e.g. only to not deleted items.
+// Queries use the index only when their filter includes the partial filter.
+// Parameters:
+//   - keys interface{}
+//   index keys (fields)
+//   - partialFilter bson.M
+//   a filter that selects indexed documents
+//   - unique bool
+//   true to reject documents with duplicate keys that match the filter
+func (c *MongoDbPersistence) EnsurePartialIndex(keys interface{}, partialFilter bson.M, unique bool) {
+	options := mongoopt.Index().SetPartialFilterExpression(partialFilter)
+	if unique {
+		options.SetUnique(true)
+	}
+	c.EnsureIndex(keys, options)
+}
+
+// ListIndexes method gets specifications of all indexes defined in the collection.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+// Returns indexes []bson.M, err error
+// index specifications and error, if they are occured
+func (c *MongoDbPersistence) ListIndexes(correlationId string) (indexes []bson.M, err error) {
+	ctx, cancel := c.newContext()
+	defer cancel()
+
+	cursor, err := c.getCollection().Indexes().List(ctx)
+	if err != nil {
+		return nil, c.wrapError(correlationId, "list_indexes", err)
+	}
+	defer cursor.Close(ctx)
+
+	indexes = make([]bson.M, 0)
+	for cursor.Next(ctx) {
+		index := bson.M{}
+		err = cursor.Decode(&index)
+		if err != nil {
+			return nil, c.wrapError(correlationId, "list_indexes", err)
+		}
+		indexes = append(indexes, index)
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, c.wrapError(correlationId, "list_indexes", err)
+	}
+	c.Logger.Trace(correlationId, "Retrieved %d indexes from %s", len(indexes), c.CollectionName)
+	return indexes, nil
+}
+
+// DropIndex method removes an index from the collection by its name.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - name string
+//   a name of the index to be removed
+// Return error
+// error or nil for success.
+func (c *MongoDbPersistence) DropIndex(correlationId string, name string) error {
+	ctx, cancel := c.newContext()
+	defer cancel()
+
+	_, err := c.getCollection().Indexes().DropOne(ctx, name)
+	if err != nil {
+		return c.wrapError(correlationId, "drop_index", err)
+	}
+	c.Logger.Debug(correlationId, "Dropped index %s from collection %s", name, c.CollectionName)
+	return nil
+}
+
+// RenameCollection method renames the collection within the same database.
+// On success the persistence continues to work with the renamed collection.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - newName string
+//   a new name of the collection
+//   - dropTarget bool
+//   true to drop existing collection with the new name, otherwise renaming fails
+// Return error
+// error or nil for success.
+func (c *MongoDbPersistence) RenameCollection(correlationId string, newName string, dropTarget bool) error {
+	if !c.opened || c.getClient() == nil {
+		return cerror.NewInvalidStateError(correlationId, "NOT_OPENED", "Persistence is not opened")
+	}
+	if c.DatabaseName == "" {
+		return cerror.NewInvalidStateError(correlationId, "NO_DATABASE", "Database name is not defined")
+	}
+	if newName == "" {
+		return cerror.NewBadRequestError(correlationId, "NO_COLLECTION", "New collection name is not defined")
+	}
+
+	ctx, cancel := c.newContext()
+	defer cancel()
+
+	command := bson.D{
+		{Key: "renameCollection", Value: c.DatabaseName + "." + c.CollectionName},
+		{Key: "to", Value: c.DatabaseName + "." + newName},
+		{Key: "dropTarget", Value: dropTarget},
+	}
+	err := c.getClient().Database("admin").RunCommand(ctx, command).Err()
+	if err != nil {
+		return cerror.NewInternalError(correlationId, "RENAME_FAILED",
+			"Rename collection "+c.CollectionName+" to "+newName+" failed").WithCause(err)
+	}
+
+	c.Logger.Debug(correlationId, "Renamed collection %s to %s", c.CollectionName, newName)
+	c.connLock.Lock()
+	c.CollectionName = newName
+	c.Collection = c.Db.Collection(newName)
+	c.connLock.Unlock()
+	return nil
+}
+
+// SetCollection method switches the opened persistence to another collection
+// in the same database, e.g. to keep data of different tenants separately.
+// Declared indexes are created in the new collection.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - name string
+//   a name of the collection to work with
+// Return error
+// error or nil for success.
+func (c *MongoDbPersistence) SetCollection(correlationId string, name string) error {
+	if !c.opened || c.getDatabase() == nil {
+		return cerror.NewInvalidStateError(correlationId, "NOT_OPENED", "Persistence is not opened")
+	}
+	if name == "" {
+		return cerror.NewBadRequestError(correlationId, "NO_COLLECTION", "Collection name is not defined")
+	}
+
+	c.connLock.Lock()
+	c.CollectionName = name
+	c.Collection = c.Db.Collection(name)
+	collection := c.Collection
+	c.connLock.Unlock()
+
+	if len(c.indexes) > 0 && c.indexBuildAsync {
+		go c.createIndexesAsync(correlationId, collection, c.indexes)
+	} else if len(c.indexes) > 0 {
+		ctx, cancel := c.newContext()
+		keys, err := collection.Indexes().CreateMany(ctx, c.indexes, mongoopt.CreateIndexes())
+		cancel()
+		if err != nil {
+			c.Logger.Error(correlationId, err, "Failed to create indexes for collection %s", name)
+			if !c.ignoreIdxErrors {
+				return cerror.NewConnectionError(correlationId, "CREATE_IDX_FAILED", "Recreate indexes failed").WithCause(err)
+			}
+		}
+		for _, v := range keys {
+			c.Logger.Debug(correlationId, "Created index %s for collection %s", v, name)
+		}
+	}
+
+	c.Logger.Debug(correlationId, "Switched to collection %s", name)
+	return nil
+}
+
+// ConvertFromPublic method help convert object (map) from public view by replaced "Id" to "_id" field.
+// The public id field name is set by options.id_field.
 // Parameters:
 //  - item *interface{}
 //  converted item
@@ -307,25 +1052,77 @@ func (c *MongoDbPersistence) ConvertFromPublic(item interface{}) interface{} {
 
 	if t.Kind() == reflect.Map {
 		m, ok := value.(map[string]interface{})
+		if bm, isBson := value.(bson.M); isBson {
+			m, ok = bm, true
+		}
 		if ok {
-			m["_id"] = m["Id"]
-			delete(m, "Id")
+			// Partial updates may not contain id
+			if id, ok := m[c.idField]; ok {
+				m["_id"] = c.toStorageId(id)
+				delete(m, c.idField)
+			}
+			if c.convertNestedIds {
+				for _, v := range m {
+					convertNestedIds(v, c.idField, "_id")
+				}
+			}
+		}
+	}
 
+	// String ids in structs are stored as ObjectIDs, so they are converted into documents
+	if t.Kind() == reflect.Struct && c.idType == "objectid" {
+		data, err := bson.Marshal(value)
+		if err != nil {
+			return item
 		}
+		var doc bson.D
+		if err = bson.Unmarshal(data, &doc); err != nil {
+			return item
+		}
+		for i := range doc {
+			if doc[i].Key == "_id" {
+				doc[i].Value = c.toStorageId(doc[i].Value)
+			}
+		}
+		return doc
 	}
 
 	return item
 }
 
+// toStorageId converts a public id into the type stored in the database.
+// When id_type is objectid, hex strings are converted into ObjectIDs.
+func (c *MongoDbPersistence) toStorageId(id interface{}) interface{} {
+	if c.idType != "objectid" {
+		return id
+	}
+	if hex, ok := id.(string); ok {
+		if objectId, err := primitive.ObjectIDFromHex(hex); err == nil {
+			return objectId
+		}
+	}
+	return id
+}
+
+// toPublicId converts an id stored in the database into its public form.
+// ObjectIDs are converted into hex strings.
+func (c *MongoDbPersistence) toPublicId(id interface{}) interface{} {
+	if objectId, ok := id.(primitive.ObjectID); ok {
+		return objectId.Hex()
+	}
+	return id
+}
+
 // ConvertFromPublicPartial method help convert object (map) from public view by replaced "Id" to "_id" field
 // Parameters:
 //  - item *interface{}
 //  converted item
 func (c *MongoDbPersistence) ConvertFromPublicPartial(item interface{}) interface{} {
-	return c.ConvertFromPublic(item)
+	return c.Overrides.ConvertFromPublic(item)
 }
 
-// ConvertToPublic method is convert object (map) to public view by replaced "_id" to "Id" field
+// ConvertToPublic method is convert object (map) to public view by replaced "_id" to "Id" field.
+// The public id field name is set by options.id_field.
 // Parameters:
 //  - item *interface{}
 //  converted item
@@ -341,7 +1138,12 @@ func (c *MongoDbPersistence) ConvertToPublic(value interface{}) interface{} {
 		} else {
 			docPointer = reflect.New(c.Prototype)
 		}
-		docPointer.Elem().Set(reflect.ValueOf(value))
+		if reflect.TypeOf(value).AssignableTo(docPointer.Elem().Type()) {
+			docPointer.Elem().Set(reflect.ValueOf(value))
+		} else if data, err := bson.Marshal(value); err == nil {
+			// Stored documents are decoded into the prototype
+			_ = bson.Unmarshal(data, docPointer.Interface())
+		}
 	}
 
 	item := docPointer.Elem().Interface()
@@ -349,8 +1151,13 @@ func (c *MongoDbPersistence) ConvertToPublic(value interface{}) interface{} {
 	if reflect.TypeOf(item).Kind() == reflect.Map {
 		m, ok := item.(map[string]interface{})
 		if ok {
-			m["Id"] = m["_id"]
+			m[c.idField] = c.toPublicId(m["_id"])
 			delete(m, "_id")
+			if c.convertNestedIds {
+				for _, v := range m {
+					convertNestedIds(v, "_id", c.idField)
+				}
+			}
 		}
 
 	}
@@ -361,6 +1168,44 @@ func (c *MongoDbPersistence) ConvertToPublic(value interface{}) interface{} {
 	return item
 }
 
+// convertNestedIds renames id keys in nested documents and arrays of documents.
+func convertNestedIds(value interface{}, from string, to string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		renameKey(v, from, to)
+		for _, item := range v {
+			convertNestedIds(item, from, to)
+		}
+	case bson.M:
+		renameKey(v, from, to)
+		for _, item := range v {
+			convertNestedIds(item, from, to)
+		}
+	case bson.D:
+		for i := range v {
+			if v[i].Key == from {
+				v[i].Key = to
+			}
+			convertNestedIds(v[i].Value, from, to)
+		}
+	case []interface{}:
+		for _, item := range v {
+			convertNestedIds(item, from, to)
+		}
+	case bson.A:
+		for _, item := range v {
+			convertNestedIds(item, from, to)
+		}
+	}
+}
+
+func renameKey(m map[string]interface{}, from string, to string) {
+	if value, ok := m[from]; ok {
+		m[to] = value
+		delete(m, from)
+	}
+}
+
 // IsOpen method is checks if the component is opened.
 // Returns true if the component has been opened and false otherwise.
 func (c *MongoDbPersistence) IsOpen() bool {
@@ -368,6 +1213,9 @@ func (c *MongoDbPersistence) IsOpen() bool {
 }
 
 // Open method is opens the component.
+// When connection or collection creation fails, the connection is released and the component stays closed.
+// When indexes can't be created, the component is still opened, so it can be used and closed,
+// and the error is returned unless options.ignore_index_errors is set.
 // Parameters:
 //   - correlationId  string
 //   (optional) transaction id to trace execution through call chain.
@@ -382,25 +1230,22 @@ func (c *MongoDbPersistence) Open(correlationId string) error {
 	}
 	if c.Connection == nil {
 		c.Connection = c.createConnection()
-		c.localConnection = true
 	}
 	c.opened = false
-	if c.localConnection {
-		err = c.Connection.Open(correlationId)
-	}
-	if err == nil && c.Connection == nil {
-		return cerror.NewInvalidStateError(correlationId, "NO_CONNECTION", "MongoDB connection is missing")
+	// Shared connections count their users and stay opened until the last one closes them
+	err = c.Connection.Open(correlationId)
+	if err != nil {
+		return err
 	}
-	if err == nil && !c.Connection.IsOpen() {
+	if !c.Connection.IsOpen() {
+		c.releaseConnection(correlationId)
 		return cerror.NewConnectionError(correlationId, "CONNECT_FAILED", "MongoDB connection is not opened")
 	}
-	c.Client = c.Connection.GetConnection()
-	c.Db = c.Connection.GetDatabase()
+	db := c.Connection.GetDatabase()
 	c.DatabaseName = c.Connection.GetDatabaseName()
-	c.Collection = c.Db.Collection(c.CollectionName)
-	if c.Collection == nil {
-		c.Db = nil
-		c.Client = nil
+	c.setConnection(c.Connection.GetConnection(), db, db.Collection(c.CollectionName))
+	if c.getCollection() == nil {
+		c.releaseConnection(correlationId)
 		return cerror.NewConnectionError(correlationId, "CONNECT_FAILED", "Connection to mongodb failed").WithCause(err)
 	}
 	//ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
@@ -409,13 +1254,35 @@ func (c *MongoDbPersistence) Open(correlationId string) error {
 	// Define database schema
 	c.Overrides.DefineSchema()
 
+	// Create collection with options
+	if c.collectionOpts != nil {
+		ctx, cancel := c.newContext()
+		errCollection := c.getDatabase().CreateCollection(ctx, c.CollectionName, c.collectionOpts)
+		cancel()
+		// Error 48 (NamespaceExists) means that collection was already created
+		if serr, ok := errCollection.(mongodrv.ServerError); errCollection != nil && !(ok && serr.HasErrorCode(48)) {
+			c.releaseConnection(correlationId)
+			return cerror.NewConnectionError(correlationId, "CREATE_COLL_FAILED", "Create collection failed").WithCause(errCollection)
+		}
+		if errCollection == nil {
+			c.Logger.Debug(correlationId, "Created collection %s", c.CollectionName)
+		}
+	}
+
 	// Recreate indexes
-	if len(c.indexes) > 0 {
-		keys, errIndexes := c.Collection.Indexes().CreateMany(c.Connection.Ctx, c.indexes, mongoopt.CreateIndexes())
+	if len(c.indexes) > 0 && c.indexBuildAsync {
+		go c.createIndexesAsync(correlationId, c.getCollection(), c.indexes)
+	} else if len(c.indexes) > 0 {
+		ctx, cancel := c.newContext()
+		keys, errIndexes := c.getCollection().Indexes().CreateMany(ctx, c.indexes, mongoopt.CreateIndexes())
+		cancel()
 		if errIndexes != nil {
-			c.Db = nil
-			c.Client = nil
-			return cerror.NewConnectionError(correlationId, "CREATE_IDX_FAILED", "Recreate indexes failed").WithCause(err)
+			// Connection is still usable, so the component is opened and can be closed as usual
+			c.Logger.Error(correlationId, errIndexes, "Failed to create indexes for collection %s", c.CollectionName)
+			if !c.ignoreIdxErrors {
+				c.opened = true
+				return cerror.NewConnectionError(correlationId, "CREATE_IDX_FAILED", "Recreate indexes failed").WithCause(errIndexes)
+			}
 		}
 		for _, v := range keys {
 			c.Logger.Debug(correlationId, "Created index %s for collection %s", v, c.CollectionName)
@@ -426,6 +1293,29 @@ func (c *MongoDbPersistence) Open(correlationId string) error {
 	return nil
 }
 
+// releaseConnection releases the connection when opening failed,
+// so a shared connection is not kept opened by this component.
+func (c *MongoDbPersistence) releaseConnection(correlationId string) {
+	if err := c.Connection.Close(correlationId); err != nil {
+		c.Logger.Error(correlationId, err, "Failed to release connection to mongodb")
+	}
+	c.setConnection(nil, nil, nil)
+}
+
+// createIndexesAsync creates indexes in background after the component was opened.
+// The operation timeout is not applied, because index builds on large collections may take long.
+func (c *MongoDbPersistence) createIndexesAsync(correlationId string, collection *mongodrv.Collection, indexes []mongodrv.IndexModel) {
+	c.Logger.Debug(correlationId, "Started building %d indexes for collection %s", len(indexes), c.CollectionName)
+	keys, err := collection.Indexes().CreateMany(c.baseContext(), indexes, mongoopt.CreateIndexes())
+	if err != nil {
+		c.Logger.Error(correlationId, err, "Failed to build indexes for collection %s", c.CollectionName)
+		return
+	}
+	for _, v := range keys {
+		c.Logger.Debug(correlationId, "Created index %s for collection %s", v, c.CollectionName)
+	}
+}
+
 // Close methos closes component and frees used resources.
 // Parameters:
 //   - correlationId string
@@ -441,32 +1331,42 @@ func (c *MongoDbPersistence) Close(correlationId string) error {
 	if c.Connection == nil {
 		return cerror.NewInvalidStateError(correlationId, "NO_CONNECTION", "MongoDb connection is missing")
 	}
-	if c.localConnection {
-		err = c.Connection.Close(correlationId)
-	}
+	err = c.Connection.Close(correlationId)
 	if err != nil {
 		return err
 	}
 	c.opened = false
-	c.Client = nil
-	c.Db = nil
-	c.Collection = nil
+	c.setConnection(nil, nil, nil)
 	return nil
 }
 
 // Clear method are clears component state.
+// By default the collection is dropped together with its indexes.
+// When options.clear_mode is "delete" all documents are deleted and indexes are kept.
 // Parameters:
 //  - correlationId string
 //  (optional) transaction id to trace execution through call chain.
 // Returns error
 // error or nil when no errors occured.
 func (c *MongoDbPersistence) Clear(correlationId string) error {
+	ctx, cancel := c.newContext()
+	defer cancel()
+
 	// Return error if collection is not set
 	if c.CollectionName == "" {
 		return cerror.NewError("Collection name is not defined")
 	}
 
-	err := c.Collection.Drop(c.Connection.Ctx)
+	var err error
+	if c.clearMode == "delete" {
+		_, err = c.getCollection().DeleteMany(ctx, bson.M{})
+	} else {
+		err = c.getCollection().Drop(ctx)
+		// Error 26 (NamespaceNotFound) means that there is nothing to drop
+		if serr, ok := err.(mongodrv.ServerError); ok && serr.HasErrorCode(26) {
+			err = nil
+		}
+	}
 	if err != nil {
 		return cerror.NewConnectionError(correlationId, "CLEAR_FAILED", "Clear collection failed.").WithCause(err)
 	}
@@ -484,55 +1384,226 @@ func (c *MongoDbPersistence) Clear(correlationId string) error {
 //   - paging *cdata.PagingParams
 //   (optional) paging parameters
 //   - sort interface{}
-//   (optional) sorting BSON object
+//   (optional) sorting BSON object or *SortParams
 //   - select  interface{}
-//   (optional) projection BSON object
+//   (optional) projection BSON object or *ProjectionParams
 // Returns page cdata.DataPage, err error
 // a data page or error, if they are occured
 func (c *MongoDbPersistence) GetPageByFilter(correlationId string, filter interface{}, paging *cdata.PagingParams,
 	sort interface{}, sel interface{}) (page *cdata.DataPage, err error) {
+	return c.GetPageByFilterWithContext(c.baseContext(), correlationId, filter, paging, sort, sel)
+}
+
+// GetPageByFilterWithContext is the same as GetPageByFilter, but runs within a given context.
+// Pass a mongo.SessionContext to read within a transaction.
+func (c *MongoDbPersistence) GetPageByFilterWithContext(ctx context.Context, correlationId string, filter interface{}, paging *cdata.PagingParams,
+	sort interface{}, sel interface{}) (page *cdata.DataPage, err error) {
+	return c.GetPageByFilterWithOptions(ctx, correlationId, filter, paging, sort, sel, nil)
+}
+
+// GetPageByFilterWithOptions is the same as GetPageByFilterWithContext, but accepts additional find options
+// like a collation for a single query. The options override configured defaults.
+// Skip, limit, sort and projection are always taken from paging, sort and select parameters.
+func (c *MongoDbPersistence) GetPageByFilterWithOptions(ctx context.Context, correlationId string, filter interface{}, paging *cdata.PagingParams,
+	sort interface{}, sel interface{}, opts *mngoptions.FindOptions) (page *cdata.DataPage, err error) {
+	timing := c.instrument(correlationId, "get_page_by_filter")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.getPageByFilter(ctx, correlationId, filter, paging, sort, sel, opts, false)
+}
+
+// GetPageByFilterEx is the same as GetPageByFilter, but returns a page with pagination metadata:
+// effective skip and take, page number and a flag that tells if there are more items.
+// When total is not requested in paging, more items are detected with a count limited to one item after the page.
+// Parameters:
+//   - correlationId  string
+//    (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter JSON object
+//   - paging *cdata.PagingParams
+//   (optional) paging parameters
+//   - sort interface{}
+//   (optional) sorting BSON object or *SortParams
+//   - select  interface{}
+//   (optional) projection BSON object or *ProjectionParams
+// Returns page *DataPageEx, err error
+// a data page with metadata or error, if they are occured
+func (c *MongoDbPersistence) GetPageByFilterEx(correlationId string, filter interface{}, paging *cdata.PagingParams,
+	sort interface{}, sel interface{}) (page *DataPageEx, err error) {
+	return c.GetPageByFilterExWithContext(c.baseContext(), correlationId, filter, paging, sort, sel)
+}
+
+// GetPageByFilterExWithContext is the same as GetPageByFilterEx, but runs within a given context.
+func (c *MongoDbPersistence) GetPageByFilterExWithContext(ctx context.Context, correlationId string, filter interface{}, paging *cdata.PagingParams,
+	sort interface{}, sel interface{}) (page *DataPageEx, err error) {
+	timing := c.instrument(correlationId, "get_page_by_filter_ex")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	if paging == nil {
+		paging = cdata.NewEmptyPagingParams()
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	dataPage, err := c.getPageByFilter(ctx, correlationId, filter, paging, sort, sel, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	skip, take := c.composePaging(correlationId, paging)
+	if skip < 0 {
+		skip = 0
+	}
+	next := skip + (int64)(len(dataPage.Data))
+	var total *int64
+	var hasMore bool
+	if paging.Total {
+		total = dataPage.Total
+		hasMore = total != nil && next < *total
+	} else {
+		count, err := c.countByFilter(ctx, correlationId, filter, next+1)
+		if err != nil {
+			return nil, err
+		}
+		hasMore = next < count
+	}
+	return NewDataPageEx(dataPage.Data, total, skip, take, hasMore), nil
+}
+
+// composePaging gets skip and take from paging parameters.
+// Skip is -1 when it is not set and take is limited by max_page_size.
+func (c *MongoDbPersistence) composePaging(correlationId string, paging *cdata.PagingParams) (skip int64, take int64) {
+	skip = paging.GetSkip(-1)
+	take = paging.GetTake((int64)(c.maxPageSize))
 	// Adjust max item count based on configuration
+	if c.maxPageSize > 0 && take > (int64)(c.maxPageSize) {
+		c.Logger.Trace(correlationId, "Requested page size %d is limited to %d in %s", take, c.maxPageSize, c.CollectionName)
+		take = (int64)(c.maxPageSize)
+	}
+	return skip, take
+}
+
+// GetPageByFilterRaw is the same as GetPageByFilter, but returns stored documents as bson.M
+// without decoding them into the prototype. Documents that don't match the prototype,
+// e.g. while a schema migration is in progress, are returned instead of being skipped.
+// Parameters:
+//   - correlationId  string
+//    (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter JSON object
+//   - paging *cdata.PagingParams
+//   (optional) paging parameters
+//   - sort interface{}
+//   (optional) sorting BSON object or *SortParams
+//   - select  interface{}
+//   (optional) projection BSON object or *ProjectionParams
+// Returns page cdata.DataPage, err error
+// a data page with bson.M documents or error, if they are occured
+func (c *MongoDbPersistence) GetPageByFilterRaw(correlationId string, filter interface{}, paging *cdata.PagingParams,
+	sort interface{}, sel interface{}) (page *cdata.DataPage, err error) {
+	return c.GetPageByFilterRawWithContext(c.baseContext(), correlationId, filter, paging, sort, sel)
+}
+
+// GetPageByFilterRawWithContext is the same as GetPageByFilterRaw, but runs within a given context.
+func (c *MongoDbPersistence) GetPageByFilterRawWithContext(ctx context.Context, correlationId string, filter interface{}, paging *cdata.PagingParams,
+	sort interface{}, sel interface{}) (page *cdata.DataPage, err error) {
+	timing := c.instrument(correlationId, "get_page_by_filter_raw")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.getPageByFilter(ctx, correlationId, filter, paging, sort, sel, nil, true)
+}
+
+// getPageByFilter retrieves a page of data items decoded into the prototype
+// or, when raw is true, a page of stored bson.M documents.
+func (c *MongoDbPersistence) getPageByFilter(ctx context.Context, correlationId string, filter interface{}, paging *cdata.PagingParams,
+	sort interface{}, sel interface{}, opts *mngoptions.FindOptions, raw bool) (page *cdata.DataPage, err error) {
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
 	if paging == nil {
 		paging = cdata.NewEmptyPagingParams()
 	}
-	skip := paging.GetSkip(-1)
-	take := paging.GetTake((int64)(c.maxPageSize))
+	skip, take := c.composePaging(correlationId, paging)
 	pagingEnabled := paging.Total
 	// Configure options
-	var options mngoptions.FindOptions
+	options := mngoptions.MergeFindOptions(c.NewFindOptions(), opts)
 	if skip >= 0 {
 		options.Skip = &skip
 	}
 	options.Limit = &take
 	if sort != nil {
-		options.Sort = sort
+		options.Sort = c.composeSort(sort)
 	}
 	if sel != nil {
-		options.Projection = sel
+		options.Projection, err = c.composeProjection(sel)
+		if err != nil {
+			return nil, err
+		}
 	}
-	cursor, ferr := c.Collection.Find(c.Connection.Ctx, filter, &options)
-	defer cursor.Close(c.Connection.Ctx)
+	filter = c.composeNotDeletedFilter(filter)
+	start := time.Now()
+	var cursor *mongodrv.Cursor
+	ferr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		cursor, err = c.getCollection().Find(ctx, filter, options)
+		return err
+	})
 	items := make([]interface{}, 0, 1)
 	if ferr != nil {
 		var total int64 = 0
 		page = cdata.NewDataPage(&total, items)
-		return page, ferr
+		return page, c.convertError(correlationId, ferr)
 	}
-	for cursor.Next(c.Connection.Ctx) {
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if raw {
+			var doc bson.M
+			if curErr := cursor.Decode(&doc); curErr != nil {
+				return nil, curErr
+			}
+			items = append(items, doc)
+			continue
+		}
+
 		docPointer := c.NewObjectByPrototype()
 		curErr := cursor.Decode(docPointer.Interface())
 		if curErr != nil {
+			if curErr = c.handleDecodeError(correlationId, cursor.Current, curErr); curErr != nil {
+				return nil, curErr
+			}
 			continue
 		}
 
 		item := c.Overrides.ConvertToPublic(docPointer)
 		items = append(items, item)
 	}
+	if cursor.Err() != nil {
+		return nil, c.convertError(correlationId, cursor.Err())
+	}
 	if items != nil {
-		c.Logger.Trace(correlationId, "Retrieved %d from %s", len(items), c.CollectionName)
+		c.traceQuery(correlationId, start, filter, "Retrieved %d from %s", len(items), c.CollectionName)
 	}
 	if pagingEnabled {
-		docCount, _ := c.Collection.CountDocuments(c.Connection.Ctx, filter)
+		var docCount int64
+		var cntErr error
+		// Estimated count ignores filters, so it is used only for the whole collection
+		if c.estimateTotal && !c.softDelete && isEmptyFilter(filter) {
+			docCount, cntErr = c.getCollection().EstimatedDocumentCount(ctx)
+		} else {
+			countOptions := mngoptions.Count()
+			if options.Collation != nil {
+				countOptions.SetCollation(options.Collation)
+			}
+			if options.MaxTime != nil {
+				countOptions.SetMaxTime(*options.MaxTime)
+			}
+			if options.Hint != nil {
+				countOptions.SetHint(options.Hint)
+			}
+			docCount, cntErr = c.getCollection().CountDocuments(ctx, filter, countOptions)
+		}
+		if cntErr != nil {
+			return nil, c.convertError(correlationId, cntErr)
+		}
 		page = cdata.NewDataPage(&docCount, items)
 	} else {
 		var total int64 = 0
@@ -541,6 +1612,262 @@ func (c *MongoDbPersistence) GetPageByFilter(correlationId string, filter interf
 	return page, nil
 }
 
+// GetPageByFilterWithCursor is gets a page of data items using keyset pagination.
+// Instead of skipping items it retrieves items with ids greater than a given one,
+// so every page is read in constant time regardless of its position.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+//   - afterId interface{}
+//   (optional) public id of the last item on the previous page or nil to get the first page
+//   - limit int64
+//   maximum number of items on the page, limited by max_page_size
+//   - sort interface{}
+//   (optional) sorting BSON object or *SortParams. Pages are split by _id, so only
+//   ascending sort by _id is accepted and other orders return BadRequestError (default: sorted by _id)
+// Returns page *CursorPage, err error
+// a page with data items and the public id of the last item to get the next page, and error, if they are occured
+func (c *MongoDbPersistence) GetPageByFilterWithCursor(correlationId string, filter interface{}, afterId interface{},
+	limit int64, sort interface{}) (page *CursorPage, err error) {
+	return c.GetPageByFilterWithCursorWithContext(c.baseContext(), correlationId, filter, afterId, limit, sort)
+}
+
+// GetPageByFilterWithCursorWithContext is the same as GetPageByFilterWithCursor, but runs within a given context.
+func (c *MongoDbPersistence) GetPageByFilterWithCursorWithContext(ctx context.Context, correlationId string, filter interface{}, afterId interface{},
+	limit int64, sort interface{}) (page *CursorPage, err error) {
+	timing := c.instrument(correlationId, "get_page_by_filter_with_cursor")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if limit <= 0 || (c.maxPageSize > 0 && limit > (int64)(c.maxPageSize)) {
+		limit = (int64)(c.maxPageSize)
+	}
+
+	if sort != nil {
+		if sort = c.composeSort(sort); sort != nil && !isIdAscendingSort(sort) {
+			return nil, cerror.NewBadRequestError(correlationId, "INVALID_SORT",
+				"Cursor paging requires items sorted by _id in ascending order").WithDetails("sort", sort)
+		}
+	}
+
+	// Read one extra item to know if there is a next page
+	options := c.NewFindOptions()
+	options.SetLimit(limit + 1)
+	options.SetSort(bson.D{{"_id", 1}})
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	if afterId != nil {
+		filter = bson.M{"$and": bson.A{filter, bson.M{"_id": bson.M{"$gt": c.toStorageId(afterId)}}}}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	start := time.Now()
+	var cursor *mongodrv.Cursor
+	err = c.RunWithRetries(ctx, correlationId, func() (err error) {
+		cursor, err = c.getCollection().Find(ctx, filter, options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]interface{}, 0)
+	var lastId interface{}
+	hasMore := false
+	// Skipped documents are counted and move the token, so paging doesn't stop on them
+	var read int64
+	for cursor.Next(ctx) {
+		if read >= limit {
+			hasMore = true
+			break
+		}
+		read++
+		_ = cursor.Current.Lookup("_id").Unmarshal(&lastId)
+
+		docPointer := c.NewObjectByPrototype()
+		curErr := cursor.Decode(docPointer.Interface())
+		if curErr != nil {
+			if curErr = c.handleDecodeError(correlationId, cursor.Current, curErr); curErr != nil {
+				return nil, curErr
+			}
+			continue
+		}
+
+		item := c.Overrides.ConvertToPublic(docPointer)
+		items = append(items, item)
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	c.traceQuery(correlationId, start, filter, "Retrieved %d from %s", len(items), c.CollectionName)
+	if !hasMore {
+		lastId = nil
+	}
+	return NewCursorPage(items, c.toPublicId(lastId)), nil
+}
+
+// isIdAscendingSort checks if a sort order sorts items only by _id in ascending order.
+func isIdAscendingSort(sort interface{}) bool {
+	data, err := bson.Marshal(sort)
+	if err != nil {
+		return false
+	}
+	doc := bson.D{}
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	if len(doc) != 1 || doc[0].Key != "_id" {
+		return false
+	}
+	switch v := doc[0].Value.(type) {
+	case int32:
+		return v == 1
+	case int64:
+		return v == 1
+	case float64:
+		return v == 1
+	}
+	return false
+}
+
+// SearchByText is gets a page of data items that contain given words in the fields
+// of the text index. Items are sorted by relevance to the search text.
+// The collection must have a text index defined with EnsureTextIndex.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - searchText string
+//   words or phrases to search for
+//   - paging *cdata.PagingParams
+//   (optional) paging parameters
+// Returns page *cdata.DataPage, err error
+// a data page with found items and error, if they are occured.
+// If the text index is missing the error has NO_TEXT_INDEX code.
+func (c *MongoDbPersistence) SearchByText(correlationId string, searchText string, paging *cdata.PagingParams) (page *cdata.DataPage, err error) {
+	filter := bson.M{"$text": bson.M{"$search": searchText}}
+	score := bson.M{"score": bson.M{"$meta": "textScore"}}
+	return c.GetPageByFilter(correlationId, filter, paging, score, score)
+}
+
+// GetNearByFilter is gets a page of data items located near a given point,
+// sorted by distance from nearest to farthest.
+// The location field must have a 2dsphere index defined with EnsureGeoIndex.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+//   - field string
+//   a name of the location field
+//   - lng float64
+//   longitude of the point from -180 to 180
+//   - lat float64
+//   latitude of the point from -90 to 90
+//   - maxMeters float64
+//   maximum distance from the point in meters, 0 for no limit
+//   - paging *cdata.PagingParams
+//   (optional) paging parameters
+// Returns page *cdata.DataPage, err error
+// a data page with found items and error, if they are occured
+func (c *MongoDbPersistence) GetNearByFilter(correlationId string, filter interface{}, field string,
+	lng float64, lat float64, maxMeters float64, paging *cdata.PagingParams) (page *cdata.DataPage, err error) {
+	return c.GetNearByFilterWithContext(c.baseContext(), correlationId, filter, field, lng, lat, maxMeters, paging)
+}
+
+// GetNearByFilterWithContext is the same as GetNearByFilter, but runs within a given context.
+func (c *MongoDbPersistence) GetNearByFilterWithContext(ctx context.Context, correlationId string, filter interface{}, field string,
+	lng float64, lat float64, maxMeters float64, paging *cdata.PagingParams) (page *cdata.DataPage, err error) {
+	timing := c.instrument(correlationId, "get_near_by_filter")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	if lng < -180 || lng > 180 || lat < -90 || lat > 90 || maxMeters < 0 {
+		return nil, cerror.NewBadRequestError(correlationId, "INVALID_COORDINATES",
+			"Coordinates or distance are out of range").
+			WithDetails("lng", lng).WithDetails("lat", lat).WithDetails("max_meters", maxMeters)
+	}
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if paging == nil {
+		paging = cdata.NewEmptyPagingParams()
+	}
+	skip := paging.GetSkip(-1)
+	take := paging.GetTake((int64)(c.maxPageSize))
+	if c.maxPageSize > 0 && take > (int64)(c.maxPageSize) {
+		take = (int64)(c.maxPageSize)
+	}
+	options := c.NewFindOptions()
+	if skip >= 0 {
+		options.SetSkip(skip)
+	}
+	options.SetLimit(take)
+
+	point := bson.M{"type": "Point", "coordinates": bson.A{lng, lat}}
+	near := bson.M{"$geometry": point}
+	if maxMeters > 0 {
+		near["$maxDistance"] = maxMeters
+	}
+	nearFilter := bson.M{field: bson.M{"$near": near}}
+	if filter != nil {
+		nearFilter = bson.M{"$and": bson.A{filter, nearFilter}}
+	}
+	start := time.Now()
+	var cursor *mongodrv.Cursor
+	err = c.RunWithRetries(ctx, correlationId, func() (err error) {
+		cursor, err = c.getCollection().Find(ctx, c.composeNotDeletedFilter(nearFilter), options)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]interface{}, 0)
+	for cursor.Next(ctx) {
+		docPointer := c.NewObjectByPrototype()
+		curErr := cursor.Decode(docPointer.Interface())
+		if curErr != nil {
+			if curErr = c.handleDecodeError(correlationId, cursor.Current, curErr); curErr != nil {
+				return nil, curErr
+			}
+			continue
+		}
+
+		item := c.Overrides.ConvertToPublic(docPointer)
+		items = append(items, item)
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+	c.traceQuery(correlationId, start, nearFilter, "Retrieved %d from %s", len(items), c.CollectionName)
+
+	var total int64 = 0
+	if paging.Total {
+		// $near is not allowed in counts, so the same area is counted with $geoWithin
+		radius := math.Pi
+		if maxMeters > 0 {
+			radius = maxMeters / 6378100
+		}
+		withinFilter := bson.M{field: bson.M{"$geoWithin": bson.M{"$centerSphere": bson.A{bson.A{lng, lat}, radius}}}}
+		if filter != nil {
+			withinFilter = bson.M{"$and": bson.A{filter, withinFilter}}
+		}
+		total, err = c.getCollection().CountDocuments(ctx, c.composeNotDeletedFilter(withinFilter))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cdata.NewDataPage(&total, items), nil
+}
+
 // GetListByFilter is gets a list of data items retrieved by a given filter and sorted according to sort parameters.
 // This method shall be called by a func (c *IdentifiableMongoDbPersistence) GetListByFilter method from child type that
 // receives FilterParams and converts them into a filter function.
@@ -550,93 +1877,937 @@ func (c *MongoDbPersistence) GetPageByFilter(correlationId string, filter interf
 //   - filter interface{}
 //   (optional) a filter BSON object
 //   - sort interface{}
-//   (optional) sorting BSON object
+//   (optional) sorting BSON object or *SortParams
 //   - select interface{}
-//   (optional) projection BSON object
+//   (optional) projection BSON object or *ProjectionParams
 // Returns items []interface{}, err error
 // data list and error, if they are ocurred
 func (c *MongoDbPersistence) GetListByFilter(correlationId string, filter interface{}, sort interface{}, sel interface{}) (items []interface{}, err error) {
+	return c.GetListByFilterWithContext(c.baseContext(), correlationId, filter, sort, sel)
+}
+
+// GetListByFilterWithContext is the same as GetListByFilter, but runs within a given context.
+func (c *MongoDbPersistence) GetListByFilterWithContext(ctx context.Context, correlationId string, filter interface{}, sort interface{}, sel interface{}) (items []interface{}, err error) {
+	return c.GetListByFilterWithOptions(ctx, correlationId, filter, sort, sel, nil)
+}
+
+// GetListByFilterWithLimit is the same as GetListByFilter, but returns not more than a given number of items.
+// It protects from loading the whole collection into memory when the filter is too broad.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+//   - sort interface{}
+//   (optional) sorting BSON object or *SortParams
+//   - select interface{}
+//   (optional) projection BSON object or *ProjectionParams
+//   - limit int64
+//   maximum number of items to return, 0 to return all items
+// Returns items []interface{}, err error
+// data list and error, if they are ocurred
+func (c *MongoDbPersistence) GetListByFilterWithLimit(correlationId string, filter interface{}, sort interface{}, sel interface{},
+	limit int64) (items []interface{}, err error) {
+	return c.GetListByFilterWithLimitWithContext(c.baseContext(), correlationId, filter, sort, sel, limit)
+}
+
+// GetListByFilterWithLimitWithContext is the same as GetListByFilterWithLimit, but runs within a given context.
+func (c *MongoDbPersistence) GetListByFilterWithLimitWithContext(ctx context.Context, correlationId string, filter interface{}, sort interface{}, sel interface{},
+	limit int64) (items []interface{}, err error) {
+	var opts *mngoptions.FindOptions
+	if limit > 0 {
+		opts = mngoptions.Find().SetLimit(limit)
+	}
+	return c.GetListByFilterWithOptions(ctx, correlationId, filter, sort, sel, opts)
+}
+
+// GetListByFilterWithOptions is the same as GetListByFilterWithContext, but accepts additional find options
+// like a collation for a single query. The options override configured defaults.
+func (c *MongoDbPersistence) GetListByFilterWithOptions(ctx context.Context, correlationId string, filter interface{}, sort interface{}, sel interface{},
+	opts *mngoptions.FindOptions) (items []interface{}, err error) {
+	timing := c.instrument(correlationId, "get_list_by_filter")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
 
 	// Configure options
-	var options mngoptions.FindOptions
+	options := mngoptions.MergeFindOptions(c.NewFindOptions(), opts)
 
 	if sort != nil {
-		options.Sort = sort
+		options.Sort = c.composeSort(sort)
 	}
 	if sel != nil {
-		options.Projection = sel
+		options.Projection, err = c.composeProjection(sel)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	cursor, ferr := c.Collection.Find(c.Connection.Ctx, filter, &options)
-	defer cursor.Close(c.Connection.Ctx)
+	filter = c.composeNotDeletedFilter(filter)
+	start := time.Now()
+	var cursor *mongodrv.Cursor
+	ferr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		cursor, err = c.getCollection().Find(ctx, filter, options)
+		return err
+	})
 	if ferr != nil {
-		return nil, ferr
+		return nil, c.convertError(correlationId, ferr)
 	}
+	defer cursor.Close(ctx)
 
 	items = make([]interface{}, 0)
 
-	for cursor.Next(c.Connection.Ctx) {
+	for cursor.Next(ctx) {
 		docPointer := c.NewObjectByPrototype()
 		curErr := cursor.Decode(docPointer.Interface())
 		if curErr != nil {
+			if curErr = c.handleDecodeError(correlationId, cursor.Current, curErr); curErr != nil {
+				return nil, curErr
+			}
 			continue
 		}
 
 		item := c.Overrides.ConvertToPublic(docPointer)
 		items = append(items, item)
 	}
+	if cursor.Err() != nil {
+		return nil, c.convertError(correlationId, cursor.Err())
+	}
 
 	if items != nil {
-		c.Logger.Trace(correlationId, "Retrieved %d from %s", len(items), c.CollectionName)
+		c.traceQuery(correlationId, start, filter, "Retrieved %d from %s", len(items), c.CollectionName)
 	}
 	return items, nil
 }
 
-// GetOneRandom is gets a random item from items that match to a given filter.
-// This method shall be called by a func (c *IdentifiableMongoDbPersistence) getOneRandom method from child class that
-// receives FilterParams and converts them into a filter function.
+// StreamByFilter is reads data items retrieved by a given filter one by one
+// and passes them to a callback function without keeping them in memory.
+// Reading stops at the first error returned by the callback.
 // Parameters:
 //   - correlationId string
 //   (optional) transaction id to Trace execution through call chain.
 //   - filter interface{}
 //   (optional) a filter BSON object
-// Returns: item interface{}, err error
-// random item and error, if theq are occured
-func (c *MongoDbPersistence) GetOneRandom(correlationId string, filter interface{}) (item interface{}, err error) {
+//   - sort interface{}
+//   (optional) sorting BSON object or *SortParams
+//   - select interface{}
+//   (optional) projection BSON object or *ProjectionParams
+//   - fn func(item interface{}) error
+//   a function called for every item
+// Return error
+// error returned by the callback or error, if reading failed
+func (c *MongoDbPersistence) StreamByFilter(correlationId string, filter interface{}, sort interface{}, sel interface{},
+	fn func(item interface{}) error) (err error) {
+	return c.StreamByFilterWithContext(c.baseContext(), correlationId, filter, sort, sel, fn)
+}
 
-	docCount, cntErr := c.Collection.CountDocuments(c.Connection.Ctx, filter)
-	if cntErr != nil {
-		return nil, cntErr
+// StreamByFilterWithContext is the same as StreamByFilter, but runs within a given context.
+func (c *MongoDbPersistence) StreamByFilterWithContext(ctx context.Context, correlationId string, filter interface{},
+	sort interface{}, sel interface{}, fn func(item interface{}) error) (err error) {
+	timing := c.instrument(correlationId, "stream_by_filter")
+	// Errors returned by the callback are passed to the caller as is
+	var fnErr error
+	defer func() {
+		wrapped := c.endTiming(timing, err)
+		if err != fnErr {
+			err = wrapped
+		}
+	}()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	options := c.NewFindOptions()
+	if sort != nil {
+		options.SetSort(c.composeSort(sort))
+	}
+	if sel != nil {
+		projection, err := c.composeProjection(sel)
+		if err != nil {
+			return err
+		}
+		options.SetProjection(projection)
 	}
-	var options mngoptions.FindOptions
-	rand.Seed(time.Now().UnixNano())
-	var itemNum int64 = rand.Int63n(docCount)
-	var itemLim int64 = 1
 
-	if itemNum < 0 {
-		itemNum = 0
+	if filter == nil {
+		filter = bson.M{}
 	}
-	options.Skip = &itemNum
-	options.Limit = &itemLim
-	cursor, fndErr := c.Collection.Find(c.Connection.Ctx, filter, &options)
-	defer cursor.Close(c.Connection.Ctx)
+	filter = c.composeNotDeletedFilter(filter)
+	start := time.Now()
+	var cursor *mongodrv.Cursor
+	err = c.RunWithRetries(ctx, correlationId, func() (err error) {
+		cursor, err = c.getCollection().Find(ctx, filter, options)
+		return err
+	})
+	if err != nil {
+		return c.convertError(correlationId, err)
+	}
+	defer cursor.Close(ctx)
 
-	if fndErr != nil {
-		return nil, fndErr
+	count := 0
+	for cursor.Next(ctx) {
+		docPointer := c.NewObjectByPrototype()
+		curErr := cursor.Decode(docPointer.Interface())
+		if curErr != nil {
+			if curErr = c.handleDecodeError(correlationId, cursor.Current, curErr); curErr != nil {
+				return curErr
+			}
+			continue
+		}
+
+		item := c.Overrides.ConvertToPublic(docPointer)
+		if fnErr = fn(item); fnErr != nil {
+			return fnErr
+		}
+		count++
+	}
+	if err = cursor.Err(); err != nil {
+		return c.convertError(correlationId, err)
 	}
 
-	docPointer := c.NewObjectByPrototype()
-	cursor.Next(c.Connection.Ctx)
-	err = cursor.Decode(docPointer.Interface())
+	c.traceQuery(correlationId, start, filter, "Streamed %d from %s", count, c.CollectionName)
+	return nil
+}
+
+// ExportToWriter is writes data items retrieved by a given filter into a writer
+// as newline-delimited JSON, one item per line. Items are read one by one,
+// so the whole collection can be exported without loading it in memory.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+//   - w io.Writer
+//   a writer to write exported items to
+// Returns count int64, err error
+// number of exported items and error, if they are occured
+func (c *MongoDbPersistence) ExportToWriter(correlationId string, filter interface{}, w io.Writer) (count int64, err error) {
+	return c.ExportToWriterWithContext(c.baseContext(), correlationId, filter, w)
+}
+
+// ExportToWriterWithContext is the same as ExportToWriter, but runs within a given context.
+func (c *MongoDbPersistence) ExportToWriterWithContext(ctx context.Context, correlationId string, filter interface{},
+	w io.Writer) (count int64, err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	// Encoder terminates every item with a new line
+	err = c.StreamByFilterWithContext(ctx, correlationId, filter, nil, nil, func(item interface{}) error {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return count, err
 	}
 
-	item = c.Overrides.ConvertToPublic(docPointer)
-	return item, nil
+	c.Logger.Trace(correlationId, "Exported %d from %s", count, c.CollectionName)
+	return count, nil
 }
 
-// Create was creates a data item.
+// ImportFromReader is reads data items from newline-delimited JSON, one item per line,
+// and inserts them into the collection in batches. Malformed lines are logged and skipped.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - r io.Reader
+//   a reader to read imported items from
+//   - batchSize int
+//   number of items inserted at once, 100 when it is not set
+// Returns count int64, err error
+// number of imported items and error, if they are occured
+func (c *MongoDbPersistence) ImportFromReader(correlationId string, r io.Reader, batchSize int) (count int64, err error) {
+	return c.ImportFromReaderWithContext(c.baseContext(), correlationId, r, batchSize)
+}
+
+// ImportFromReaderWithContext is the same as ImportFromReader, but runs within a given context.
+func (c *MongoDbPersistence) ImportFromReaderWithContext(ctx context.Context, correlationId string, r io.Reader,
+	batchSize int) (count int64, err error) {
+	timing := c.instrument(correlationId, "import_from_reader")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.importFromReader(ctx, correlationId, r, batchSize, c.Overrides.ConvertFromPublic)
+}
+
+// importFromReader reads data items from newline-delimited JSON and inserts them in batches.
+// Every item is converted into a stored document by a given convert function.
+// Batches are inserted in order, so on error the count includes the items inserted before the failed one.
+func (c *MongoDbPersistence) importFromReader(ctx context.Context, correlationId string, r io.Reader, batchSize int,
+	convert func(item interface{}) interface{}) (count int64, err error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	batch := make([]interface{}, 0, batchSize)
+	insertBatch := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		ctx, cancel := c.newContextFrom(ctx)
+		defer cancel()
+
+		_, insErr := c.collectionFor(ctx).InsertMany(ctx, batch)
+		if insErr == nil {
+			count += int64(len(batch))
+		} else if bwErr, ok := insErr.(mongodrv.BulkWriteException); ok && len(bwErr.WriteErrors) > 0 {
+			// Ordered insert stops at the first failed item
+			count += int64(bwErr.WriteErrors[0].Index)
+		}
+		batch = batch[:0]
+		return c.convertError(correlationId, insErr)
+	}
+
+	scanner := bufio.NewScanner(r)
+	// Lines may hold documents up to the maximum BSON document size
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		docPointer := c.NewObjectByPrototype()
+		if jsonErr := json.Unmarshal(data, docPointer.Interface()); jsonErr != nil {
+			c.Logger.Warn(correlationId, "Skipped malformed line %d importing into %s: %s", line, c.CollectionName, jsonErr.Error())
+			continue
+		}
+		var item interface{} = docPointer.Elem().Interface()
+		if c.Prototype.Kind() == reflect.Ptr {
+			item = docPointer.Interface()
+		}
+		batch = append(batch, convert(item))
+
+		if len(batch) >= batchSize {
+			if err = insertBatch(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return count, err
+	}
+	if err = insertBatch(); err != nil {
+		return count, err
+	}
+
+	c.Logger.Trace(correlationId, "Imported %d into %s", count, c.CollectionName)
+	return count, nil
+}
+
+// IterateByFilter is reads data items retrieved by a given filter in a separate goroutine
+// and sends them into a returned channel.
+// The items channel is unbuffered, so the cursor reads the next item only after
+// the previous one was received by a consumer. Several consumers may read from
+// the channel concurrently. When all items are read the items channel is closed and
+// the error channel returns nil or an error, if reading failed.
+// The operation timeout is not applied to the iteration. To stop reading before the end
+// use IterateByFilterWithContext and cancel the context, the cursor is closed then.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+//   - sort interface{}
+//   (optional) sorting BSON object or *SortParams
+// Returns items <-chan interface{}, errs <-chan error
+// channel with data items and channel with a reading error
+func (c *MongoDbPersistence) IterateByFilter(correlationId string, filter interface{}, sort interface{}) (<-chan interface{}, <-chan error) {
+	return c.IterateByFilterWithContext(c.baseContext(), correlationId, filter, sort)
+}
+
+// IterateByFilterWithContext is the same as IterateByFilter, but reads items within a given context.
+// Cancellation of the context stops reading and closes the cursor.
+func (c *MongoDbPersistence) IterateByFilterWithContext(ctx context.Context, correlationId string,
+	filter interface{}, sort interface{}) (<-chan interface{}, <-chan error) {
+	items := make(chan interface{})
+	errs := make(chan error, 1)
+
+	go func() {
+		var err error
+		timing := c.instrument(correlationId, "iterate_by_filter")
+		defer func() { c.endTiming(timing, err) }()
+		defer close(items)
+		defer func() {
+			if err != nil {
+				errs <- c.wrapError(correlationId, timing.operation, err)
+			}
+			close(errs)
+		}()
+
+		options := c.NewFindOptions()
+		if sort != nil {
+			options.SetSort(c.composeSort(sort))
+		}
+		if filter == nil {
+			filter = bson.M{}
+		}
+		filter = c.composeNotDeletedFilter(filter)
+		var cursor *mongodrv.Cursor
+		err = c.RunWithRetries(ctx, correlationId, func() (err error) {
+			cursor, err = c.getCollection().Find(ctx, filter, options)
+			return err
+		})
+		if err != nil {
+			return
+		}
+		// The context may be already canceled, so the cursor is closed with a new one
+		defer cursor.Close(context.Background())
+
+		count := 0
+		for cursor.Next(ctx) {
+			docPointer := c.NewObjectByPrototype()
+			curErr := cursor.Decode(docPointer.Interface())
+			if curErr != nil {
+				if err = c.handleDecodeError(correlationId, cursor.Current, curErr); err != nil {
+					return
+				}
+				continue
+			}
+
+			select {
+			case items <- c.Overrides.ConvertToPublic(docPointer):
+				count++
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+		}
+		err = cursor.Err()
+		if err == nil {
+			c.Logger.Trace(correlationId, "Iterated %d from %s", count, c.CollectionName)
+		}
+	}()
+
+	return items, errs
+}
+
+// Aggregate is runs an aggregation pipeline on the collection.
+// Result documents that match the prototype are decoded into it and converted to public view,
+// others (for instance results of $group or $facet stages) are returned as bson.M.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - pipeline []bson.M
+//   aggregation pipeline stages
+//   - opts *mngoptions.AggregateOptions
+//   (optional) aggregation options
+// Returns items []interface{}, err error
+// aggregated documents and error, if they are ocurred
+func (c *MongoDbPersistence) Aggregate(correlationId string, pipeline []bson.M, opts *mngoptions.AggregateOptions) (items []interface{}, err error) {
+	return c.AggregateWithContext(c.baseContext(), correlationId, pipeline, opts)
+}
+
+// AggregateWithContext is the same as Aggregate, but runs within a given context.
+func (c *MongoDbPersistence) AggregateWithContext(ctx context.Context, correlationId string, pipeline []bson.M, opts *mngoptions.AggregateOptions) (items []interface{}, err error) {
+	timing := c.instrument(correlationId, "aggregate")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if opts == nil {
+		opts = mngoptions.Aggregate()
+	}
+	start := time.Now()
+	var cursor *mongodrv.Cursor
+	aggErr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		cursor, err = c.getCollection().Aggregate(ctx, pipeline, opts)
+		return err
+	})
+	if aggErr != nil {
+		return nil, aggErr
+	}
+	defer cursor.Close(ctx)
+
+	items = make([]interface{}, 0)
+	for cursor.Next(ctx) {
+		if c.matchesPrototype(cursor.Current) {
+			docPointer := c.NewObjectByPrototype()
+			curErr := cursor.Decode(docPointer.Interface())
+			if curErr == nil {
+				items = append(items, c.Overrides.ConvertToPublic(docPointer))
+				continue
+			}
+		}
+
+		var doc bson.M
+		curErr := cursor.Decode(&doc)
+		if curErr != nil {
+			return nil, curErr
+		}
+		items = append(items, doc)
+	}
+	if cursor.Err() != nil {
+		return nil, cursor.Err()
+	}
+
+	c.traceQuery(correlationId, start, pipeline, "Aggregated %d from %s", len(items), c.CollectionName)
+	return items, nil
+}
+
+// matchesPrototype checks if all fields of the document are defined in the prototype
+func (c *MongoDbPersistence) matchesPrototype(doc bson.Raw) bool {
+	proto := c.Prototype
+	if proto.Kind() == reflect.Ptr {
+		proto = proto.Elem()
+	}
+	if proto.Kind() != reflect.Struct {
+		return true
+	}
+
+	fields := make(map[string]bool)
+	for i := 0; i < proto.NumField(); i++ {
+		field := proto.Field(i)
+		name := strings.ToLower(field.Name)
+		if tag, ok := field.Tag.Lookup("bson"); ok {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		fields[name] = true
+	}
+
+	elements, err := doc.Elements()
+	if err != nil {
+		return false
+	}
+	for _, element := range elements {
+		if !fields[element.Key()] {
+			return false
+		}
+	}
+	return true
+}
+
+// GetDistinct is gets unique values of a field in data items that match to a given filter.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - fieldName string
+//   a name of the field to get values of
+//   - filter interface{}
+//   (optional) a filter BSON object
+// Returns values []interface{}, err error
+// unique field values and error, if they are ocurred
+func (c *MongoDbPersistence) GetDistinct(correlationId string, fieldName string, filter interface{}) (values []interface{}, err error) {
+	return c.GetDistinctWithContext(c.baseContext(), correlationId, fieldName, filter)
+}
+
+// GetDistinctWithContext is the same as GetDistinct, but runs within a given context.
+func (c *MongoDbPersistence) GetDistinctWithContext(ctx context.Context, correlationId string, fieldName string, filter interface{}) (values []interface{}, err error) {
+	timing := c.instrument(correlationId, "get_distinct")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	err = c.RunWithRetries(ctx, correlationId, func() (err error) {
+		values, err = c.getCollection().Distinct(ctx, fieldName, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.Logger.Trace(correlationId, "Retrieved %d distinct values of %s from %s", len(values), fieldName, c.CollectionName)
+	return values, nil
+}
+
+// GetDistinctCount is gets a number of unique values of a field in data items that match to a given filter.
+// The number is calculated on the server, so values are not transferred to the client.
+// As in GetDistinct, elements of array fields are counted as separate values.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - fieldName string
+//   a name of the field to count values of
+//   - filter interface{}
+//   (optional) a filter BSON object
+// Returns count int64, err error
+// a number of unique field values and error, if they are ocurred
+func (c *MongoDbPersistence) GetDistinctCount(correlationId string, fieldName string, filter interface{}) (count int64, err error) {
+	return c.GetDistinctCountWithContext(c.baseContext(), correlationId, fieldName, filter)
+}
+
+// GetDistinctCountWithContext is the same as GetDistinctCount, but runs within a given context.
+func (c *MongoDbPersistence) GetDistinctCountWithContext(ctx context.Context, correlationId string, fieldName string, filter interface{}) (count int64, err error) {
+	timing := c.instrument(correlationId, "get_distinct_count")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = bson.M{"$and": bson.A{
+		c.composeNotDeletedFilter(filter),
+		bson.M{fieldName: bson.M{"$exists": true}},
+	}}
+	pipeline := bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$unwind": bson.M{"path": "$" + fieldName, "preserveNullAndEmptyArrays": true}},
+		bson.M{"$group": bson.M{"_id": "$" + fieldName}},
+		bson.M{"$count": "count"},
+	}
+
+	var result struct {
+		Count int64 `bson:"count"`
+	}
+	err = c.RunWithRetries(ctx, correlationId, func() error {
+		result.Count = 0
+		cursor, aggErr := c.getCollection().Aggregate(ctx, pipeline)
+		if aggErr != nil {
+			return aggErr
+		}
+		defer cursor.Close(ctx)
+		// $count stage returns no documents when nothing matches the filter
+		if cursor.Next(ctx) {
+			if decErr := cursor.Decode(&result); decErr != nil {
+				return decErr
+			}
+		}
+		return cursor.Err()
+	})
+	if err != nil {
+		return 0, err
+	}
+	c.Logger.Trace(correlationId, "Counted %d distinct values of %s in %s", result.Count, fieldName, c.CollectionName)
+	return result.Count, nil
+}
+
+// GetOneByFilter is gets the first item from items that match to a given filter.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+//   - sort interface{}
+//   (optional) sorting BSON object or *SortParams to select the first item
+// Returns: item interface{}, err error
+// found item or nil if nothing was found and error, if they are occured
+func (c *MongoDbPersistence) GetOneByFilter(correlationId string, filter interface{}, sort interface{}) (item interface{}, err error) {
+	return c.GetOneByFilterWithContext(c.baseContext(), correlationId, filter, sort)
+}
+
+// GetOneByFilterWithContext is the same as GetOneByFilter, but runs within a given context.
+func (c *MongoDbPersistence) GetOneByFilterWithContext(ctx context.Context, correlationId string, filter interface{}, sort interface{}) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "get_one_by_filter")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	options := mngoptions.FindOne()
+	if sort != nil {
+		options.SetSort(c.composeSort(sort))
+	}
+
+	docPointer := c.NewObjectByPrototype()
+	start := time.Now()
+	foRes := c.retrySingleResult(ctx, correlationId, func() *mongodrv.SingleResult {
+		return c.getCollection().FindOne(ctx, filter, options)
+	})
+	ferr := foRes.Decode(docPointer.Interface())
+	if ferr != nil {
+		if ferr == mongodrv.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, ferr
+	}
+	c.traceQuery(correlationId, start, filter, "Retrieved one by filter from %s", c.CollectionName)
+
+	item = c.Overrides.ConvertToPublic(docPointer)
+	return item, nil
+}
+
+// Exists is checks if there is at least one item that matches to a given filter.
+// It stops at the first found document and retrieves only its id.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+// Returns: exists bool, err error
+// true if matching item exists and error, if they are occured
+func (c *MongoDbPersistence) Exists(correlationId string, filter interface{}) (exists bool, err error) {
+	return c.ExistsWithContext(c.baseContext(), correlationId, filter)
+}
+
+// ExistsWithContext is the same as Exists, but runs within a given context.
+func (c *MongoDbPersistence) ExistsWithContext(ctx context.Context, correlationId string, filter interface{}) (exists bool, err error) {
+	timing := c.instrument(correlationId, "exists")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	options := mngoptions.FindOne().SetProjection(bson.M{"_id": 1})
+	foRes := c.retrySingleResult(ctx, correlationId, func() *mongodrv.SingleResult {
+		return c.getCollection().FindOne(ctx, filter, options)
+	})
+	err = foRes.Err()
+	if err != nil {
+		if err == mongodrv.ErrNoDocuments {
+			return false, nil
+		}
+		return false, err
+	}
+	c.Logger.Trace(correlationId, "Checked existence in %s", c.CollectionName)
+	return true, nil
+}
+
+// Explain runs the explain command for a find query with a given filter
+// and returns the raw explain output to diagnose slow queries.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+//   - verbosity string
+//   (optional) explain verbosity: queryPlanner, executionStats or allPlansExecution (default: queryPlanner)
+// Returns result bson.M, err error
+// explain output and error, if they are occured
+func (c *MongoDbPersistence) Explain(correlationId string, filter interface{}, verbosity string) (result bson.M, err error) {
+	return c.ExplainWithContext(c.baseContext(), correlationId, filter, verbosity)
+}
+
+// ExplainWithContext is the same as Explain, but runs within a given context.
+func (c *MongoDbPersistence) ExplainWithContext(ctx context.Context, correlationId string, filter interface{}, verbosity string) (result bson.M, err error) {
+	timing := c.instrument(correlationId, "explain")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	if verbosity == "" {
+		verbosity = "queryPlanner"
+	}
+	if verbosity != "queryPlanner" && verbosity != "executionStats" && verbosity != "allPlansExecution" {
+		return nil, cerror.NewBadRequestError(correlationId, "INVALID_VERBOSITY",
+			"Invalid explain verbosity "+verbosity+", expected queryPlanner, executionStats or allPlansExecution").
+			WithDetails("verbosity", verbosity)
+	}
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	command := bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "find", Value: c.CollectionName},
+			{Key: "filter", Value: filter},
+		}},
+		{Key: "verbosity", Value: verbosity},
+	}
+	result = bson.M{}
+	rcRes := c.retrySingleResult(ctx, correlationId, func() *mongodrv.SingleResult {
+		return c.getDatabase().RunCommand(ctx, command)
+	})
+	err = rcRes.Decode(&result)
+	if err != nil {
+		return nil, c.convertError(correlationId, err)
+	}
+	c.Logger.Trace(correlationId, "Explained query in %s with verbosity %s", c.CollectionName, verbosity)
+	return result, nil
+}
+
+// Watch opens a change stream on the collection.
+// The stream is not bound by the operation timeout and shall be closed by the caller.
+// Change streams require MongoDB replica set or sharded cluster.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - pipeline []bson.M
+//   (optional) aggregation stages to filter or modify change events
+//   - opts *mngoptions.ChangeStreamOptions
+//   (optional) change stream options
+// Returns stream *mongodrv.ChangeStream, err error
+// opened change stream and error, if they are occured
+func (c *MongoDbPersistence) Watch(correlationId string, pipeline []bson.M, opts *mngoptions.ChangeStreamOptions) (stream *mongodrv.ChangeStream, err error) {
+	if pipeline == nil {
+		pipeline = []bson.M{}
+	}
+	if opts == nil {
+		opts = mngoptions.ChangeStream()
+	}
+	stream, err = c.getCollection().Watch(c.baseContext(), pipeline, opts)
+	if err != nil {
+		return nil, c.wrapError(correlationId, "watch", err)
+	}
+	c.Logger.Trace(correlationId, "Opened change stream on %s", c.CollectionName)
+	return stream, nil
+}
+
+// WatchChanges listens to changes in the collection and invokes the handler for every change event.
+// Events are processed in a separate goroutine. When event contains fullDocument field
+// it is converted into public format. Updated documents are looked up, so update events contain
+// the whole document as well. After transient errors the stream is resumed from the last received event.
+// Listening stops when the handler returns an error or the returned stop function is called.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - handler func(changeEvent bson.M) error
+//   a function to be called for every change event
+// Returns stop func(), err error
+// function to stop listening and error, if change stream cannot be opened
+func (c *MongoDbPersistence) WatchChanges(correlationId string, handler func(changeEvent bson.M) error) (stop func(), err error) {
+	opts := mngoptions.ChangeStream().SetFullDocument(mngoptions.UpdateLookup)
+	stream, err := c.Watch(correlationId, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(c.baseContext())
+	go func() {
+		// Close the latest stream, it is replaced on resume
+		defer func() {
+			stream.Close(context.Background())
+		}()
+		for {
+			for stream.Next(ctx) {
+				event := bson.M{}
+				if err := stream.Decode(&event); err != nil {
+					c.Logger.Error(correlationId, err, "Failed to decode change event from %s", c.CollectionName)
+					continue
+				}
+				fullDocument := stream.Current.Lookup("fullDocument")
+				if fullDocument.Type == bson.TypeEmbeddedDocument {
+					docPointer := c.NewObjectByPrototype()
+					if err := fullDocument.Unmarshal(docPointer.Interface()); err == nil {
+						event["fullDocument"] = c.Overrides.ConvertToPublic(docPointer)
+					}
+				}
+				if err := handler(event); err != nil {
+					c.Logger.Debug(correlationId, "Stopped watching changes on %s: %s", c.CollectionName, err.Error())
+					cancel()
+					return
+				}
+			}
+
+			err := stream.Err()
+			if ctx.Err() != nil || err == nil || !isResumableError(err) {
+				if ctx.Err() == nil && err != nil {
+					c.Logger.Error(correlationId, err, "Change stream on %s failed", c.CollectionName)
+				}
+				cancel()
+				return
+			}
+
+			// Resume after the last processed event
+			c.Logger.Debug(correlationId, "Resuming change stream on %s after error: %s", c.CollectionName, err.Error())
+			resumeOpts := mngoptions.ChangeStream().SetFullDocument(mngoptions.UpdateLookup)
+			if token := stream.ResumeToken(); token != nil {
+				resumeOpts.SetResumeAfter(token)
+			}
+			resumed, err := c.getCollection().Watch(ctx, []bson.M{}, resumeOpts)
+			if err != nil {
+				c.Logger.Error(correlationId, err, "Failed to resume change stream on %s", c.CollectionName)
+				cancel()
+				return
+			}
+			stream.Close(context.Background())
+			stream = resumed
+		}
+	}()
+
+	return cancel, nil
+}
+
+// isResumableError checks if change stream can be resumed after the error.
+func isResumableError(err error) bool {
+	if mongodrv.IsNetworkError(err) || mongodrv.IsTimeout(err) {
+		return true
+	}
+	if serverErr, ok := err.(mongodrv.ServerError); ok {
+		return serverErr.HasErrorLabel("ResumableChangeStreamError")
+	}
+	return false
+}
+
+// GetOneRandom is gets a random item from items that match to a given filter.
+// This method shall be called by a func (c *IdentifiableMongoDbPersistence) getOneRandom method from child class that
+// receives FilterParams and converts them into a filter function.
+// Parameters:
+//   - correlationId string
+//   (optional) transaction id to Trace execution through call chain.
+//   - filter interface{}
+//   (optional) a filter BSON object
+// Returns: item interface{}, err error
+// random item and error, if theq are occured
+func (c *MongoDbPersistence) GetOneRandom(correlationId string, filter interface{}) (item interface{}, err error) {
+	return c.GetOneRandomWithContext(c.baseContext(), correlationId, filter)
+}
+
+// GetOneRandomWithContext is the same as GetOneRandom, but runs within a given context.
+func (c *MongoDbPersistence) GetOneRandomWithContext(ctx context.Context, correlationId string, filter interface{}) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "get_one_random")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	filter = c.composeNotDeletedFilter(filter)
+	var docCount int64
+	cntErr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		docCount, err = c.getCollection().CountDocuments(ctx, filter)
+		return err
+	})
+	if cntErr != nil {
+		return nil, cntErr
+	}
+	var options mngoptions.FindOptions
+	rand.Seed(time.Now().UnixNano())
+	var itemNum int64 = rand.Int63n(docCount)
+	var itemLim int64 = 1
+
+	if itemNum < 0 {
+		itemNum = 0
+	}
+	options.Skip = &itemNum
+	options.Limit = &itemLim
+	var cursor *mongodrv.Cursor
+	fndErr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		cursor, err = c.getCollection().Find(ctx, filter, &options)
+		return err
+	})
+	if fndErr != nil {
+		return nil, fndErr
+	}
+	defer cursor.Close(ctx)
+
+	docPointer := c.NewObjectByPrototype()
+	cursor.Next(ctx)
+	err = cursor.Decode(docPointer.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	item = c.Overrides.ConvertToPublic(docPointer)
+	return item, nil
+}
+
+// Create was creates a data item.
 // Parameters:
 //  - correlation_id string
 //  (optional) transaction id to Trace execution through call chain.
@@ -645,25 +2816,205 @@ func (c *MongoDbPersistence) GetOneRandom(correlationId string, filter interface
 // Returns result interface{}, err error
 // created item and error, if they are occured
 func (c *MongoDbPersistence) Create(correlationId string, item interface{}) (result interface{}, err error) {
+	return c.CreateWithContext(c.baseContext(), correlationId, item)
+}
+
+// CreateWithContext is the same as Create, but runs within a given context.
+// Pass a mongo.SessionContext to create the item within a transaction.
+func (c *MongoDbPersistence) CreateWithContext(ctx context.Context, correlationId string, item interface{}) (result interface{}, err error) {
+	timing := c.instrument(correlationId, "create")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
 	if item == nil {
 		return nil, nil
 	}
 	var newItem interface{}
 	newItem = cmpersist.CloneObject(item, c.Prototype)
 	newItem = c.Overrides.ConvertFromPublic(newItem)
-	insRes, insErr := c.Collection.InsertOne(c.Connection.Ctx, newItem)
+	insRes, insErr := c.collectionFor(ctx).InsertOne(ctx, newItem)
 	newItem = c.Overrides.ConvertToPublic(newItem)
 
 	if insErr != nil {
-		return nil, insErr
+		return nil, c.convertError(correlationId, insErr)
 	}
-	c.Logger.Trace(correlationId, "Created in %s with id = %s", c.Collection, insRes.InsertedID)
+	c.Logger.Trace(correlationId, "Created in %s with id = %s", c.CollectionName, insRes.InsertedID)
 	return newItem, nil
 }
 
+// ReplaceByFilter replaces the first data item that matches to a given filter.
+// It can be used for data items without unique ids, like singletons identified by name.
+// Parameters:
+//  - correlation_id string
+//  (optional) transaction id to Trace execution through call chain.
+//  - filter interface{}
+//  a filter BSON object
+//  - item interface{}
+//  a new data item that replaces the found one
+//  - upsert bool
+//  true to insert the item when nothing matches to the filter
+// Returns result interface{}, err error
+// replaced or inserted item, nil if nothing was found and not inserted, and error, if they are occured
+func (c *MongoDbPersistence) ReplaceByFilter(correlationId string, filter interface{}, item interface{}, upsert bool) (result interface{}, err error) {
+	return c.ReplaceByFilterWithContext(c.baseContext(), correlationId, filter, item, upsert)
+}
+
+// ReplaceByFilterWithContext is the same as ReplaceByFilter, but runs within a given context.
+func (c *MongoDbPersistence) ReplaceByFilterWithContext(ctx context.Context, correlationId string, filter interface{}, item interface{}, upsert bool) (result interface{}, err error) {
+	timing := c.instrument(correlationId, "replace_by_filter")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if item == nil {
+		return nil, nil
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	var newItem interface{}
+	newItem = cmpersist.CloneObject(item, c.Prototype)
+	newItem = c.Overrides.ConvertFromPublic(newItem)
+	options := mngoptions.FindOneAndReplace().
+		SetReturnDocument(mngoptions.After).
+		SetUpsert(upsert)
+	frRes := c.retrySingleResult(ctx, correlationId, func() *mongodrv.SingleResult {
+		return c.collectionFor(ctx).FindOneAndReplace(ctx, filter, newItem, options)
+	})
+	if frRes.Err() != nil {
+		if frRes.Err() == mongodrv.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, c.convertError(correlationId, frRes.Err())
+	}
+	docPointer := c.NewObjectByPrototype()
+	err = frRes.Decode(docPointer.Interface())
+	if err != nil {
+		return nil, err
+	}
+	c.Logger.Trace(correlationId, "Replaced in %s by filter", c.CollectionName)
+
+	result = c.Overrides.ConvertToPublic(docPointer)
+	return result, nil
+}
+
+// ClaimNext atomically finds the first data item that matches to a given filter
+// and applies a claim update to it, e.g. sets status, owner and lease time.
+// It allows to use a collection as a job queue: competing workers never claim the same item,
+// as long as the claim update makes the item not to match the filter anymore.
+// Parameters:
+//  - correlation_id string
+//  (optional) transaction id to Trace execution through call chain.
+//  - filter interface{}
+//  (optional) a filter BSON object to select claimable items
+//  - claimUpdate bson.M
+//  an update document where all keys are update operators, e.g. bson.M{"$set": bson.M{"status": "processing"}}
+//  - sort interface{}
+//  (optional) sorting BSON object to define which item is claimed first
+// Returns item interface{}, err error
+// claimed item after the update, nil if there is nothing to claim, and error, if they are occured
+func (c *MongoDbPersistence) ClaimNext(correlationId string, filter interface{}, claimUpdate bson.M, sort interface{}) (item interface{}, err error) {
+	return c.ClaimNextWithContext(c.baseContext(), correlationId, filter, claimUpdate, sort)
+}
+
+// ClaimNextWithContext is the same as ClaimNext, but runs within a given context.
+func (c *MongoDbPersistence) ClaimNextWithContext(ctx context.Context, correlationId string, filter interface{}, claimUpdate bson.M, sort interface{}) (item interface{}, err error) {
+	timing := c.instrument(correlationId, "claim_next")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	if len(claimUpdate) == 0 {
+		return nil, cerror.NewBadRequestError(correlationId, "EMPTY_UPDATE", "Claim update operators are not defined")
+	}
+	for key := range claimUpdate {
+		if !strings.HasPrefix(key, "$") {
+			return nil, cerror.NewBadRequestError(correlationId, "INVALID_UPDATE",
+				"Update key "+key+" is not an update operator").WithDetails("key", key)
+		}
+	}
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	options := mngoptions.FindOneAndUpdate().SetReturnDocument(mngoptions.After)
+	if sort != nil {
+		options.SetSort(c.composeSort(sort))
+	}
+	fuRes := c.collectionFor(ctx).FindOneAndUpdate(ctx, filter, claimUpdate, options)
+	if fuRes.Err() != nil {
+		if fuRes.Err() == mongodrv.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, c.convertError(correlationId, fuRes.Err())
+	}
+	docPointer := c.NewObjectByPrototype()
+	err = fuRes.Decode(docPointer.Interface())
+	if err != nil {
+		return nil, err
+	}
+	c.Logger.Trace(correlationId, "Claimed next item in %s", c.CollectionName)
+
+	item = c.Overrides.ConvertToPublic(docPointer)
+	return item, nil
+}
+
+// BulkWrite performs mixed insert, update and delete operations in a single round-trip.
+// Write models shall contain documents in database format, so public items
+// shall be converted with ConvertFromPublic before they are passed in:
+//
+//   item := c.Overrides.ConvertFromPublic(cmpersist.CloneObject(myItem, c.Prototype))
+//   operations := []mongodrv.WriteModel{
+//     mongodrv.NewInsertOneModel().SetDocument(item),
+//     mongodrv.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(bson.M{"$set": bson.M{"name": "ABC"}}),
+//     mongodrv.NewDeleteOneModel().SetFilter(bson.M{"_id": id2}),
+//   }
+//
+// Parameters:
+//  - correlationId  string
+//  (optional) transaction id to Trace execution through call chain.
+//  - operations []mongodrv.WriteModel
+//  write models to be executed.
+//  - ordered bool
+//  true to stop on the first error, false to execute all operations.
+// Returns result *mongodrv.BulkWriteResult, err error
+// counts of affected documents and error, if they are occured
+func (c *MongoDbPersistence) BulkWrite(correlationId string, operations []mongodrv.WriteModel, ordered bool) (result *mongodrv.BulkWriteResult, err error) {
+	return c.BulkWriteWithContext(c.baseContext(), correlationId, operations, ordered)
+}
+
+// BulkWriteWithContext is the same as BulkWrite, but runs within a given context.
+func (c *MongoDbPersistence) BulkWriteWithContext(ctx context.Context, correlationId string, operations []mongodrv.WriteModel, ordered bool) (result *mongodrv.BulkWriteResult, err error) {
+	timing := c.instrument(correlationId, "bulk_write")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	if len(operations) == 0 {
+		return &mongodrv.BulkWriteResult{}, nil
+	}
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	options := mngoptions.BulkWrite().SetOrdered(ordered)
+	result, err = c.collectionFor(ctx).BulkWrite(ctx, operations, options)
+	if err != nil {
+		return result, err
+	}
+	c.Logger.Trace(correlationId, "Bulk written in %s: inserted %d, modified %d, deleted %d, upserted %d",
+		c.CollectionName, result.InsertedCount, result.ModifiedCount, result.DeletedCount, result.UpsertedCount)
+	return result, nil
+}
+
 // DeleteByFilter is deletes data items that match to a given filter.
 // This method shall be called by a func (c *IdentifiableMongoDbPersistence) deleteByFilter method from child class that
 // receives FilterParams and converts them into a filter function.
+// When soft delete is enabled the items are only marked as deleted.
 // Parameters:
 //  - correlationId  string
 //  (optional) transaction id to Trace execution through call chain.
@@ -672,15 +3023,160 @@ func (c *MongoDbPersistence) Create(correlationId string, item interface{}) (res
 // Return error
 // error or nil for success.
 func (c *MongoDbPersistence) DeleteByFilter(correlationId string, filter interface{}) error {
-	delRes, delErr := c.Collection.DeleteMany(c.Connection.Ctx, filter)
-	var count = delRes.DeletedCount
+	return c.DeleteByFilterWithContext(c.baseContext(), correlationId, filter)
+}
+
+// DeleteByFilterWithContext is the same as DeleteByFilter, but runs within a given context.
+func (c *MongoDbPersistence) DeleteByFilterWithContext(ctx context.Context, correlationId string, filter interface{}) (err error) {
+	_, err = c.DeleteCountByFilterWithContext(ctx, correlationId, filter)
+	return err
+}
+
+// DeleteCountByFilter is the same as DeleteByFilter, but returns a number of deleted items.
+// When soft delete is enabled it returns a number of items marked as deleted.
+// Parameters:
+//  - correlationId  string
+//  (optional) transaction id to Trace execution through call chain.
+//  - filter  interface{}
+//  (optional) a filter BSON object.
+// Return count int64, err error
+// number of deleted items and error, if they are occured
+func (c *MongoDbPersistence) DeleteCountByFilter(correlationId string, filter interface{}) (count int64, err error) {
+	return c.DeleteCountByFilterWithContext(c.baseContext(), correlationId, filter)
+}
+
+// DeleteCountByFilterWithContext is the same as DeleteCountByFilter, but runs within a given context.
+func (c *MongoDbPersistence) DeleteCountByFilterWithContext(ctx context.Context, correlationId string, filter interface{}) (count int64, err error) {
+	timing := c.instrument(correlationId, "delete_by_filter")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if c.softDelete {
+		var updRes *mongodrv.UpdateResult
+		updErr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+			updRes, err = c.collectionFor(ctx).UpdateMany(ctx, c.composeNotDeletedFilter(filter), c.composeSoftDeleteUpdate())
+			return err
+		})
+		if updErr != nil {
+			return 0, updErr
+		}
+		c.Logger.Trace(correlationId, "Soft deleted %d items from %s", updRes.ModifiedCount, c.CollectionName)
+		return updRes.ModifiedCount, nil
+	}
+
+	var delRes *mongodrv.DeleteResult
+	delErr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		delRes, err = c.collectionFor(ctx).DeleteMany(ctx, filter)
+		return err
+	})
+	if delErr != nil {
+		return 0, delErr
+	}
+	c.Logger.Trace(correlationId, "Deleted %d items from %s", delRes.DeletedCount, c.CollectionName)
+	return delRes.DeletedCount, nil
+}
+
+// Purge is physically removes data items that match to a given filter
+// including the items that were soft deleted.
+// Parameters:
+//  - correlationId  string
+//  (optional) transaction id to Trace execution through call chain.
+//  - filter  interface{}
+//  (optional) a filter BSON object.
+// Return error
+// error or nil for success.
+func (c *MongoDbPersistence) Purge(correlationId string, filter interface{}) (err error) {
+	return c.PurgeWithContext(c.baseContext(), correlationId, filter)
+}
+
+// PurgeWithContext is the same as Purge, but runs within a given context.
+func (c *MongoDbPersistence) PurgeWithContext(ctx context.Context, correlationId string, filter interface{}) (err error) {
+	timing := c.instrument(correlationId, "purge")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	if filter == nil {
+		filter = bson.M{}
+	}
+	var delRes *mongodrv.DeleteResult
+	delErr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		delRes, err = c.collectionFor(ctx).DeleteMany(ctx, filter)
+		return err
+	})
 	if delErr != nil {
 		return delErr
 	}
-	c.Logger.Trace(correlationId, "Deleted %d items from %s", count, c.Collection)
+	c.Logger.Trace(correlationId, "Purged %d items from %s", delRes.DeletedCount, c.CollectionName)
 	return nil
 }
 
+// GetDeleted is gets a list of soft deleted data items that match to a given filter.
+// Parameters:
+//  - correlationId  string
+//  (optional) transaction id to Trace execution through call chain.
+//  - filter  interface{}
+//  (optional) a filter BSON object.
+//  - sort interface{}
+//  (optional) sorting BSON object or *SortParams
+// Returns items []interface{}, err error
+// list of deleted items and error, if they are occured
+func (c *MongoDbPersistence) GetDeleted(correlationId string, filter interface{}, sort interface{}) (items []interface{}, err error) {
+	return c.GetDeletedWithContext(c.baseContext(), correlationId, filter, sort)
+}
+
+// GetDeletedWithContext is the same as GetDeleted, but runs within a given context.
+func (c *MongoDbPersistence) GetDeletedWithContext(ctx context.Context, correlationId string, filter interface{},
+	sort interface{}) (items []interface{}, err error) {
+	timing := c.instrument(correlationId, "get_deleted")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	deleted := bson.M{"deleted": true}
+	if filter != nil {
+		filter = bson.M{"$and": bson.A{filter, deleted}}
+	} else {
+		filter = deleted
+	}
+	options := mngoptions.Find()
+	if sort != nil {
+		options.SetSort(c.composeSort(sort))
+	}
+
+	var cursor *mongodrv.Cursor
+	ferr := c.RunWithRetries(ctx, correlationId, func() (err error) {
+		cursor, err = c.getCollection().Find(ctx, filter, options)
+		return err
+	})
+	if ferr != nil {
+		return nil, ferr
+	}
+	defer cursor.Close(ctx)
+
+	items = make([]interface{}, 0)
+	for cursor.Next(ctx) {
+		docPointer := c.NewObjectByPrototype()
+		curErr := cursor.Decode(docPointer.Interface())
+		if curErr != nil {
+			if curErr = c.handleDecodeError(correlationId, cursor.Current, curErr); curErr != nil {
+				return nil, curErr
+			}
+			continue
+		}
+		items = append(items, c.Overrides.ConvertToPublic(docPointer))
+	}
+	if err = cursor.Err(); err != nil {
+		return nil, err
+	}
+	c.Logger.Trace(correlationId, "Retrieved %d deleted items from %s", len(items), c.CollectionName)
+	return items, nil
+}
+
 // GetCountByFilter is gets a count of data items retrieved by a given filter.
 // This method shall be called by a func (c *IdentifiableMongoDbPersistence) GetCountByFilter method from child type that
 // receives FilterParams and converts them into a filter function.
@@ -691,15 +3187,109 @@ func (c *MongoDbPersistence) DeleteByFilter(correlationId string, filter interfa
 // Returns count int, err error
 // a data count or error, if they are occured
 func (c *MongoDbPersistence) GetCountByFilter(correlationId string, filter interface{}) (count int64, err error) {
+	return c.GetCountByFilterWithContext(c.baseContext(), correlationId, filter)
+}
+
+// GetCountByFilterWithContext is the same as GetCountByFilter, but runs within a given context.
+func (c *MongoDbPersistence) GetCountByFilterWithContext(ctx context.Context, correlationId string, filter interface{}) (count int64, err error) {
+	timing := c.instrument(correlationId, "get_count_by_filter")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.countByFilter(ctx, correlationId, filter, 0)
+}
+
+// GetCountByFilterWithLimit is gets a count of data items retrieved by a given filter,
+// but stops counting when the limit is reached. It cheaply answers whether there are
+// at least N matching items, e.g. to show "99+" badges, without counting all of them.
+// Parameters:
+//  - correlationId  string
+//  (optional) transaction id to Trace execution through call chain.
+//  - filter interface{}
+//  (optional) a filter BSON object
+//  - limit int64
+//  maximum number of items to count, 0 to count all items
+// Returns count int64, err error
+// a data count not greater than the limit or error, if they are occured
+func (c *MongoDbPersistence) GetCountByFilterWithLimit(correlationId string, filter interface{}, limit int64) (count int64, err error) {
+	return c.GetCountByFilterWithLimitWithContext(c.baseContext(), correlationId, filter, limit)
+}
+
+// GetCountByFilterWithLimitWithContext is the same as GetCountByFilterWithLimit, but runs within a given context.
+func (c *MongoDbPersistence) GetCountByFilterWithLimitWithContext(ctx context.Context, correlationId string, filter interface{}, limit int64) (count int64, err error) {
+	timing := c.instrument(correlationId, "get_count_by_filter_with_limit")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	return c.countByFilter(ctx, correlationId, filter, limit)
+}
+
+// countByFilter counts data items that match to a given filter up to a limit, when it is positive.
+func (c *MongoDbPersistence) countByFilter(ctx context.Context, correlationId string, filter interface{}, limit int64) (count int64, err error) {
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
 
 	// Configure options
-	var options mngoptions.CountOptions
-	count = 0
-	count, err = c.Collection.CountDocuments(c.Connection.Ctx, filter, &options)
+	options := mngoptions.Count()
+	if limit > 0 {
+		options.SetLimit(limit)
+	}
+	if filter == nil {
+		filter = bson.M{}
+	}
+	filter = c.composeNotDeletedFilter(filter)
+	err = c.RunWithRetries(ctx, correlationId, func() (err error) {
+		count, err = c.getCollection().CountDocuments(ctx, filter, options)
+		return err
+	})
 	c.Logger.Trace(correlationId, "Find %d items in %s", count, c.CollectionName)
 	return count, err
 }
 
+// GetEstimatedCount is gets an approximate count of all data items in the collection.
+// The count is taken from the collection metadata without scanning documents,
+// so it is much faster than GetCountByFilter on large collections.
+// Parameters:
+//  - correlationId  string
+//  (optional) transaction id to Trace execution through call chain.
+// Returns count int64, err error
+// an estimated data count or error, if they are occured
+func (c *MongoDbPersistence) GetEstimatedCount(correlationId string) (count int64, err error) {
+	return c.GetEstimatedCountWithContext(c.baseContext(), correlationId)
+}
+
+// GetEstimatedCountWithContext is the same as GetEstimatedCount, but runs within a given context.
+func (c *MongoDbPersistence) GetEstimatedCountWithContext(ctx context.Context, correlationId string) (count int64, err error) {
+	timing := c.instrument(correlationId, "get_estimated_count")
+	defer func() { err = c.endTiming(timing, err) }()
+
+	ctx, cancel := c.newContextFrom(ctx)
+	defer cancel()
+
+	err = c.RunWithRetries(ctx, correlationId, func() (err error) {
+		count, err = c.getCollection().EstimatedDocumentCount(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	c.Logger.Trace(correlationId, "Estimated %d items in %s", count, c.CollectionName)
+	return count, nil
+}
+
+// isEmptyFilter checks if a filter does not contain any conditions.
+func isEmptyFilter(filter interface{}) bool {
+	switch f := filter.(type) {
+	case nil:
+		return true
+	case bson.M:
+		return len(f) == 0
+	case bson.D:
+		return len(f) == 0
+	case map[string]interface{}:
+		return len(f) == 0
+	}
+	return false
+}
+
 // service function for return pointer on new prototype object for unmarshaling
 func (c *MongoDbPersistence) NewObjectByPrototype() reflect.Value {
 	proto := c.Prototype
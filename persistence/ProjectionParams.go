@@ -0,0 +1,88 @@
+package persistence
+
+import (
+	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+ProjectionParams is a builder of MongoDB projections that selects fields returned by queries.
+MongoDB does not allow to mix included and excluded fields in one projection,
+the only exception is _id field that can be excluded from the projection with included fields.
+
+Example:
+
+  projection := NewProjectionParams().Include("name", "content").Exclude("_id")
+  items, err := persistence.GetListByFilter("123", filter, nil, projection)
+*/
+type ProjectionParams struct {
+	fields bson.M
+	mode   int
+	err    error
+}
+
+const (
+	projectionNone    = 0
+	projectionInclude = 1
+	projectionExclude = 2
+)
+
+// NewProjectionParams creates a new empty projection.
+// Returns *ProjectionParams
+// projection that returns all fields
+func NewProjectionParams() *ProjectionParams {
+	return &ProjectionParams{
+		fields: bson.M{},
+	}
+}
+
+// Include adds fields to be returned by queries.
+// Parameters:
+//   - fields ...string
+//   names of included fields
+// Returns *ProjectionParams
+// this projection to chain calls
+func (c *ProjectionParams) Include(fields ...string) *ProjectionParams {
+	for _, field := range fields {
+		c.add(field, 1, projectionInclude)
+	}
+	return c
+}
+
+// Exclude adds fields to be skipped by queries.
+// Parameters:
+//   - fields ...string
+//   names of excluded fields
+// Returns *ProjectionParams
+// this projection to chain calls
+func (c *ProjectionParams) Exclude(fields ...string) *ProjectionParams {
+	for _, field := range fields {
+		c.add(field, 0, projectionExclude)
+	}
+	return c
+}
+
+func (c *ProjectionParams) add(field string, value int, mode int) {
+	if field == "" {
+		return
+	}
+	// _id can be excluded from any projection
+	if field != "_id" {
+		if c.mode != projectionNone && c.mode != mode && c.err == nil {
+			c.err = cerror.NewBadRequestError("", "INVALID_PROJECTION",
+				"Projection cannot mix included and excluded fields").WithDetails("field", field)
+		}
+		c.mode = mode
+	}
+	c.fields[field] = value
+}
+
+// ToBson converts the projection into BSON object accepted by MongoDB driver.
+// Returns projection bson.M, err error
+// projection BSON object and error, if included and excluded fields were mixed
+func (c *ProjectionParams) ToBson() (projection bson.M, err error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return c.fields, nil
+}
@@ -0,0 +1,57 @@
+package persistence
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+/*
+SortParams is a builder of MongoDB sort orders.
+Unlike bson.M it keeps the order of sort fields, which is significant
+when items are sorted by several fields.
+
+Example:
+
+  sort := NewSortParams().Desc("create_time").Asc("name")
+  items, err := persistence.GetListByFilter("123", filter, sort, nil)
+*/
+type SortParams struct {
+	fields bson.D
+}
+
+// NewSortParams creates a new empty sort order.
+// Returns *SortParams
+// sort order without fields
+func NewSortParams() *SortParams {
+	return &SortParams{
+		fields: bson.D{},
+	}
+}
+
+// Asc adds a field sorted in ascending order.
+// Parameters:
+//   - field string
+//   a name of the sort field
+// Returns *SortParams
+// this sort order to chain calls
+func (c *SortParams) Asc(field string) *SortParams {
+	c.fields = append(c.fields, bson.E{Key: field, Value: 1})
+	return c
+}
+
+// Desc adds a field sorted in descending order.
+// Parameters:
+//   - field string
+//   a name of the sort field
+// Returns *SortParams
+// this sort order to chain calls
+func (c *SortParams) Desc(field string) *SortParams {
+	c.fields = append(c.fields, bson.E{Key: field, Value: -1})
+	return c
+}
+
+// ToBson converts the sort order into BSON object accepted by MongoDB driver.
+// Returns bson.D
+// ordered sort fields
+func (c *SortParams) ToBson() bson.D {
+	return c.fields
+}
@@ -0,0 +1,73 @@
+package test_build
+
+import (
+	"testing"
+
+	cref "github.com/pip-services3-go/pip-services3-commons-go/refer"
+	build "github.com/pip-services3-go/pip-services3-mongodb-go/build"
+	conn "github.com/pip-services3-go/pip-services3-mongodb-go/connect"
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+)
+
+type testMongoDbPersistence struct {
+	*persist.MongoDbPersistence
+}
+
+func newTestMongoDbPersistence() *testMongoDbPersistence {
+	c := &testMongoDbPersistence{}
+	c.MongoDbPersistence = persist.InheritMongoDbPersistence(c, nil, "tests")
+	return c
+}
+
+func (c *testMongoDbPersistence) ConvertToPublic(value interface{}) interface{} {
+	return value
+}
+
+func (c *testMongoDbPersistence) ConvertFromPublic(value interface{}) interface{} {
+	return value
+}
+
+func (c *testMongoDbPersistence) ConvertFromPublicPartial(value interface{}) interface{} {
+	return value
+}
+
+func TestDefaultMongoDbFactoryCreateConnection(t *testing.T) {
+	factory := build.NewDefaultMongoDbFactory()
+
+	descriptor := cref.NewDescriptor("pip-services", "connection", "mongodb", "default", "1.0")
+	assert.NotNil(t, factory.CanCreate(descriptor))
+
+	component, err := factory.Create(descriptor)
+	assert.Nil(t, err)
+	_, ok := component.(*conn.MongoDbConnection)
+	assert.True(t, ok)
+}
+
+func TestDefaultMongoDbFactoryConnectionDescriptors(t *testing.T) {
+	factory := build.NewDefaultMongoDbFactory()
+
+	// Connections are created for any name
+	component, err := factory.Create(cref.NewDescriptor("pip-services", "connection", "mongodb", "mydb", "1.0"))
+	assert.Nil(t, err)
+	_, ok := component.(*conn.MongoDbConnection)
+	assert.True(t, ok)
+
+	// Other connection types are not supported
+	assert.Nil(t, factory.CanCreate(cref.NewDescriptor("pip-services", "connection", "postgres", "default", "1.0")))
+}
+
+func TestDefaultMongoDbFactoryRegisterPersistence(t *testing.T) {
+	factory := build.NewDefaultMongoDbFactory()
+
+	descriptor := cref.NewDescriptor("test", "persistence", "mongodb", "default", "1.0")
+	assert.Nil(t, factory.CanCreate(descriptor))
+
+	factory.RegisterPersistence(descriptor, newTestMongoDbPersistence)
+	assert.NotNil(t, factory.CanCreate(descriptor))
+
+	component, err := factory.Create(descriptor)
+	assert.Nil(t, err)
+	_, ok := component.(*testMongoDbPersistence)
+	assert.True(t, ok)
+}
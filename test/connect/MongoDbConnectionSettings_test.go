@@ -0,0 +1,320 @@
+package test_connect
+
+import (
+	"testing"
+	"time"
+
+	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
+	cref "github.com/pip-services3-go/pip-services3-commons-go/refer"
+	cinfo "github.com/pip-services3-go/pip-services3-components-go/info"
+	conn "github.com/pip-services3-go/pip-services3-mongodb-go/connect"
+	"github.com/stretchr/testify/assert"
+	mongoclopt "go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func composeSettings(config *cconf.ConfigParams) (*mongoclopt.ClientOptions, error) {
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(config)
+	settings := mongoclopt.Client()
+	err := connection.ComposeSettings("", settings)
+	return settings, err
+}
+
+func TestMongoDbConnectionTLSSettings(t *testing.T) {
+	// TLS is disabled by default
+	settings, err := composeSettings(cconf.NewEmptyConfigParams())
+	assert.Nil(t, err)
+	assert.Nil(t, settings.TLSConfig)
+
+	// TLS with system cert pool
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.ssl", "true",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.TLSConfig)
+
+	// TLS with missing CA file
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.ssl", "true",
+		"options.tls_ca_file", "./missing-ca.pem",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestMongoDbConnectionAuthSettings(t *testing.T) {
+	// SCRAM-SHA-256 with user and password
+	settings, err := composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.auth_source", "admin",
+		"options.auth_user", "user",
+		"options.auth_password", "pass",
+		"options.auth_mechanism", "SCRAM-SHA-256",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.Auth)
+	assert.Equal(t, "SCRAM-SHA-256", settings.Auth.AuthMechanism)
+	assert.Equal(t, "admin", settings.Auth.AuthSource)
+	assert.Equal(t, "user", settings.Auth.Username)
+	assert.Equal(t, "pass", settings.Auth.Password)
+
+	// MONGODB-X509 without user and password
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.auth_mechanism", "MONGODB-X509",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.Auth)
+	assert.Equal(t, "MONGODB-X509", settings.Auth.AuthMechanism)
+	assert.Equal(t, "", settings.Auth.Username)
+
+	// Mechanism properties
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.auth_mechanism", "GSSAPI",
+		"options.auth_mechanism_properties", "SERVICE_NAME:mongodb,CANONICALIZE_HOST_NAME:true",
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, "mongodb", settings.Auth.AuthMechanismProperties["SERVICE_NAME"])
+	assert.Equal(t, "true", settings.Auth.AuthMechanismProperties["CANONICALIZE_HOST_NAME"])
+
+	// Invalid mechanism properties
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.auth_mechanism", "GSSAPI",
+		"options.auth_mechanism_properties", "SERVICE_NAME",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestMongoDbConnectionWriteConcernSettings(t *testing.T) {
+	// Write concern is not set by default
+	settings, err := composeSettings(cconf.NewEmptyConfigParams())
+	assert.Nil(t, err)
+	assert.Nil(t, settings.WriteConcern)
+
+	// Majority with journal and timeout
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.write_concern", "majority",
+		"options.journal", "true",
+		"options.write_concern_timeout", "3000",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.WriteConcern)
+	assert.Equal(t, "majority", settings.WriteConcern.GetW())
+	assert.True(t, settings.WriteConcern.GetJ())
+	assert.Equal(t, 3*time.Second, settings.WriteConcern.GetWTimeout())
+
+	// Numeric write concern
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.write_concern", "2",
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, settings.WriteConcern.GetW())
+
+	// Invalid write concern
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.write_concern", "all",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestMongoDbConnectionReadConcernSettings(t *testing.T) {
+	// Read concern is not set by default
+	settings, err := composeSettings(cconf.NewEmptyConfigParams())
+	assert.Nil(t, err)
+	assert.Nil(t, settings.ReadConcern)
+
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.read_concern", "snapshot",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.ReadConcern)
+	assert.Equal(t, "snapshot", settings.ReadConcern.GetLevel())
+
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.read_concern", "majority",
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, "majority", settings.ReadConcern.GetLevel())
+
+	// Invalid read concern
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.read_concern", "strong",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestMongoDbConnectionRetrySettings(t *testing.T) {
+	// Retryable writes are enabled by default
+	settings, err := composeSettings(cconf.NewEmptyConfigParams())
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.RetryWrites)
+	assert.True(t, *settings.RetryWrites)
+
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.retry_writes", "false",
+		"options.retry_reads", "false",
+	))
+	assert.Nil(t, err)
+	assert.False(t, *settings.RetryWrites)
+	assert.NotNil(t, settings.RetryReads)
+	assert.False(t, *settings.RetryReads)
+}
+
+func TestMongoDbConnectionCompressionSettings(t *testing.T) {
+	settings, err := composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.compressors", "zstd, snappy,zlib",
+		"options.zlib_level", "6",
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"zstd", "snappy", "zlib"}, settings.Compressors)
+	assert.NotNil(t, settings.ZlibLevel)
+	assert.Equal(t, 6, *settings.ZlibLevel)
+
+	// Unknown compressor
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.compressors", "zstd,lz4",
+	))
+	assert.NotNil(t, err)
+
+	// Invalid zlib level
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.zlib_level", "10",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestMongoDbConnectionPoolSettings(t *testing.T) {
+	settings, err := composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.max_pool_size", "10",
+		"options.min_pool_size", "2",
+		"options.max_connecting", "3",
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), *settings.MaxPoolSize)
+	assert.Equal(t, uint64(2), *settings.MinPoolSize)
+	assert.Equal(t, uint64(3), *settings.MaxConnecting)
+
+	// Minimum pool size cannot exceed maximum
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.max_pool_size", "2",
+		"options.min_pool_size", "5",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestMongoDbConnectionAppNameSettings(t *testing.T) {
+	settings, err := composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.app_name", "my-service",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.AppName)
+	assert.Equal(t, "my-service", *settings.AppName)
+
+	// Default application name from context info
+	contextInfo := cinfo.NewContextInfo()
+	contextInfo.Name = "container-name"
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(cconf.NewEmptyConfigParams())
+	connection.SetReferences(cref.NewReferencesFromTuples(
+		cref.NewDescriptor("pip-services", "context-info", "default", "default", "1.0"), contextInfo,
+	))
+	settings = mongoclopt.Client()
+	err = connection.ComposeSettings("", settings)
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.AppName)
+	assert.Equal(t, "container-name", *settings.AppName)
+}
+
+func TestMongoDbConnectionMonitorSettings(t *testing.T) {
+	// Monitoring is disabled by default
+	settings, err := composeSettings(cconf.NewEmptyConfigParams())
+	assert.Nil(t, err)
+	assert.Nil(t, settings.PoolMonitor)
+	assert.Nil(t, settings.Monitor)
+
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.monitor", "true",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.PoolMonitor)
+	assert.NotNil(t, settings.Monitor)
+}
+
+func TestMongoDbConnectionDirectSettings(t *testing.T) {
+	// Not set by default
+	settings, err := composeSettings(cconf.NewEmptyConfigParams())
+	assert.Nil(t, err)
+	assert.Nil(t, settings.Direct)
+
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.direct_connection", "true",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.Direct)
+	assert.True(t, *settings.Direct)
+
+	// Direct connection is not compatible with replica set
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.direct_connection", "true",
+		"options.replica_set", "rs0",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestMongoDbConnectionLoadBalancedSettings(t *testing.T) {
+	settings, err := composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.load_balanced", "true",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.LoadBalanced)
+	assert.True(t, *settings.LoadBalanced)
+
+	// Load balanced mode is not compatible with replica set
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.load_balanced", "true",
+		"options.replica_set", "rs0",
+	))
+	assert.NotNil(t, err)
+
+	// Load balanced mode is not compatible with direct connection
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.load_balanced", "true",
+		"options.direct_connection", "true",
+	))
+	assert.NotNil(t, err)
+}
+
+func TestMongoDbConnectionReadPreferenceSettings(t *testing.T) {
+	// Not set by default
+	settings, err := composeSettings(cconf.NewEmptyConfigParams())
+	assert.Nil(t, err)
+	assert.Nil(t, settings.ReadPreference)
+
+	settings, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.read_preference", "secondaryPreferred",
+		"options.max_staleness_seconds", "120",
+	))
+	assert.Nil(t, err)
+	assert.NotNil(t, settings.ReadPreference)
+	assert.Equal(t, readpref.SecondaryPreferredMode, settings.ReadPreference.Mode())
+	maxStaleness, ok := settings.ReadPreference.MaxStaleness()
+	assert.True(t, ok)
+	assert.Equal(t, 120*time.Second, maxStaleness)
+
+	// Max staleness below the minimum
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.read_preference", "secondary",
+		"options.max_staleness_seconds", "30",
+	))
+	assert.NotNil(t, err)
+
+	// Max staleness with primary read preference
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.max_staleness_seconds", "120",
+	))
+	assert.NotNil(t, err)
+
+	// Invalid read preference
+	_, err = composeSettings(cconf.NewConfigParamsFromTuples(
+		"options.read_preference", "somewhere",
+	))
+	assert.NotNil(t, err)
+}
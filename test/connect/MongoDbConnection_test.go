@@ -1,39 +1,23 @@
 package test_connect
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
 	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
+	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
 	conn "github.com/pip-services3-go/pip-services3-mongodb-go/connect"
 	"github.com/stretchr/testify/assert"
-	"os"
-	"testing"
+	"go.mongodb.org/mongo-driver/bson"
+	mongodrv "go.mongodb.org/mongo-driver/mongo"
 )
 
 func TestMongoDBConnection(t *testing.T) {
 	var connection conn.MongoDbConnection
 
-	mongoUri := os.Getenv("MONGO_URI")
-	mongoHost := os.Getenv("MONGO_HOST")
-	if mongoHost == "" {
-		mongoHost = "localhost"
-	}
-	mongoPort := os.Getenv("MONGO_PORT")
-	if mongoPort == "" {
-		mongoPort = "27017"
-	}
-	mongoDatabase := os.Getenv("MONGO_DB")
-	if mongoDatabase == "" {
-		mongoDatabase = "test"
-	}
-	if mongoUri == "" && mongoHost == "" {
-		return
-	}
-
-	dbConfig := cconf.NewConfigParamsFromTuples(
-		"connection.uri", mongoUri,
-		"connection.host", mongoHost,
-		"connection.port", mongoPort,
-		"connection.database", mongoDatabase,
-	)
+	dbConfig := getTestConfig(t)
 
 	connection = *conn.NewMongoDbConnection()
 	connection.Configure(dbConfig)
@@ -47,4 +31,182 @@ func TestMongoDBConnection(t *testing.T) {
 	assert.NotNil(t, connection.GetDatabase())
 	assert.NotEqual(t, "", connection.GetDatabaseName())
 
+	//test("Ping")
+	err := connection.Ping("")
+	assert.Nil(t, err)
+
+	connection.Close("")
+	err = connection.Ping("")
+	assert.NotNil(t, err)
+	appErr, ok := err.(*cerror.ApplicationError)
+	assert.True(t, ok)
+	assert.Equal(t, "NOT_CONNECTED", appErr.Code)
+}
+
+func TestMongoDBConnectionDisconnectErrors(t *testing.T) {
+	assert.False(t, conn.IsDisconnectError(nil))
+	assert.False(t, conn.IsDisconnectError(errors.New("Some error")))
+	assert.False(t, conn.IsDisconnectError(mongodrv.ErrNoDocuments))
+	assert.False(t, conn.IsDisconnectError(fmt.Errorf("Find failed: %w", context.Canceled)))
+	assert.True(t, conn.IsDisconnectError(mongodrv.ErrClientDisconnected))
+	assert.True(t, conn.IsDisconnectError(fmt.Errorf("Find failed: %w", mongodrv.ErrClientDisconnected)))
+}
+
+func TestMongoDBConnectionReconnect(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(dbConfig)
+	err := connection.Open("")
+	assert.Nil(t, err)
+	defer connection.Close("")
+
+	reconnects := 0
+	connection.AddReconnectListener(func(correlationId string) {
+		reconnects++
+	})
+
+	client := connection.GetConnection()
+	err = connection.Reconnect("", client)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, reconnects)
+	assert.NotEqual(t, client, connection.GetConnection())
+
+	// Already replaced client is not reconnected again
+	err = connection.Reconnect("", client)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, reconnects)
+
+	err = connection.Ping("")
+	assert.Nil(t, err)
+
+	// Listeners are called when the connection is unlocked
+	connection.AddReconnectListener(func(correlationId string) {
+		_ = connection.Open(correlationId)
+		_ = connection.Close(correlationId)
+	})
+	err = connection.Reconnect("", connection.GetConnection())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, reconnects)
+	assert.True(t, connection.IsOpen())
+
+	// Closed connection is not reconnected
+	err = connection.Close("")
+	assert.Nil(t, err)
+	err = connection.Reconnect("", nil)
+	assert.NotNil(t, err)
+	assert.False(t, connection.IsOpen())
+	assert.Equal(t, 2, reconnects)
+}
+
+func TestMongoDBConnectionGetDatabaseByName(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(dbConfig)
+
+	// Databases are not available before open
+	assert.Nil(t, connection.GetDatabaseByName("test1"))
+
+	err := connection.Open("")
+	assert.Nil(t, err)
+	defer connection.Close("")
+
+	dbName := connection.GetDatabaseName()
+	db1 := connection.GetDatabaseByName(dbName + "_1")
+	db2 := connection.GetDatabaseByName(dbName + "_2")
+	assert.NotNil(t, db1)
+	assert.NotNil(t, db2)
+	assert.Equal(t, dbName+"_1", db1.Name())
+	assert.Equal(t, dbName+"_2", db2.Name())
+	assert.Equal(t, connection.GetConnection(), db1.Client())
+	assert.Equal(t, connection.GetConnection(), db2.Client())
+
+	// Default database stays the same
+	assert.Equal(t, connection.GetDatabaseName(), connection.GetDatabase().Name())
+
+	// Data written to one database is not visible in another
+	ctx := context.Background()
+	defer db1.Drop(ctx)
+	defer db2.Drop(ctx)
+
+	_, err = db1.Collection("items").InsertOne(ctx, bson.M{"_id": "1"})
+	assert.Nil(t, err)
+
+	count, err := db1.Collection("items").CountDocuments(ctx, bson.M{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	count, err = db2.Collection("items").CountDocuments(ctx, bson.M{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestMongoDBConnectionServerInfo(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(dbConfig)
+
+	// Not opened connection
+	_, err := connection.GetServerInfo("")
+	assert.NotNil(t, err)
+
+	err = connection.Open("")
+	assert.Nil(t, err)
+	defer connection.Close("")
+
+	info, err := connection.GetServerInfo("")
+	assert.Nil(t, err)
+	assert.NotNil(t, info)
+	version, ok := info["version"].(string)
+	assert.True(t, ok)
+	assert.NotEqual(t, "", version)
+}
+
+func TestMongoDBConnectionVerifyOnOpen(t *testing.T) {
+	// Nobody listens on the port
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(cconf.NewConfigParamsFromTuples(
+		"connection.host", "127.0.0.1",
+		"connection.port", "1",
+		"connection.database", "test",
+		"options.connect_timeout", "500",
+	))
+	err := connection.Open("")
+	assert.NotNil(t, err)
+	appErr, ok := err.(*cerror.ApplicationError)
+	if assert.True(t, ok) {
+		assert.Equal(t, cerror.NoResponse, appErr.Category)
+	}
+	assert.False(t, connection.IsOpen())
+
+	// Without verification the driver connects lazily
+	connection = conn.NewMongoDbConnection()
+	connection.Configure(cconf.NewConfigParamsFromTuples(
+		"connection.host", "127.0.0.1",
+		"connection.port", "1",
+		"connection.database", "test",
+		"options.connect_timeout", "500",
+		"options.verify_on_open", "false",
+	))
+	err = connection.Open("")
+	assert.Nil(t, err)
+	connection.Close("")
+}
+
+func TestMongoDBConnectionVerifyCredentials(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"credential.username", "unknown_user",
+		"credential.password", "wrong_password",
+	)
+	if dbConfig.GetAsString("connection.uri") != "" {
+		t.Skip("Credentials can't be replaced in a connection string")
+	}
+
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(dbConfig)
+	err := connection.Open("")
+	assert.NotNil(t, err)
+	assert.False(t, connection.IsOpen())
 }
@@ -0,0 +1,42 @@
+package test_connect
+
+import (
+	"os"
+	"testing"
+
+	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
+)
+
+// getTestConfig returns configuration of the test MongoDB server
+// set by MONGO_URI or MONGO_HOST, MONGO_PORT and MONGO_DB environment variables.
+// The test is skipped when the server is not configured.
+// Parameters:
+//   - t *testing.T
+//   the running test
+//   - tuples ...interface{}
+//   (optional) additional configuration parameters as key-value pairs
+// Returns *cconf.ConfigParams
+// configuration parameters for a connection or a persistence
+func getTestConfig(t *testing.T, tuples ...interface{}) *cconf.ConfigParams {
+	mongoUri := os.Getenv("MONGO_URI")
+	mongoHost := os.Getenv("MONGO_HOST")
+	if mongoUri == "" && mongoHost == "" {
+		t.Skip("MongoDB server is not configured, set MONGO_URI or MONGO_HOST")
+	}
+	mongoPort := os.Getenv("MONGO_PORT")
+	if mongoPort == "" {
+		mongoPort = "27017"
+	}
+	mongoDatabase := os.Getenv("MONGO_DB")
+	if mongoDatabase == "" {
+		mongoDatabase = "test"
+	}
+
+	config := []interface{}{
+		"connection.uri", mongoUri,
+		"connection.host", mongoHost,
+		"connection.port", mongoPort,
+		"connection.database", mongoDatabase,
+	}
+	return cconf.NewConfigParamsFromTuplesArray(append(config, tuples...))
+}
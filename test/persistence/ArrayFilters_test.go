@@ -0,0 +1,72 @@
+package test_persistence
+
+import (
+	"context"
+	"testing"
+
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestArrayFilters(t *testing.T) {
+	assert.Equal(t, bson.M{"tags": bson.M{"$elemMatch": bson.M{"$eq": "a"}}},
+		persist.ArrayContains("tags", "a"))
+
+	assert.Equal(t, bson.M{"tags": bson.M{"$all": bson.A{"a", "b"}}},
+		persist.ArrayContainsAll("tags", []string{"a", "b"}))
+	assert.Equal(t, bson.M{"tags": bson.M{"$all": bson.A{"a", "b"}}},
+		persist.ArrayContainsAll("tags", "a,b"))
+	assert.Equal(t, bson.M{"tags": bson.M{"$all": bson.A{"a", "b"}}},
+		persist.ArrayContainsAll("tags", cdata.NewAnyValueArrayFromValues("a", "b")))
+	assert.Equal(t, bson.M{"tags": bson.M{"$all": bson.A{}}},
+		persist.ArrayContainsAll("tags", nil))
+
+	assert.Equal(t, bson.M{"tags": bson.M{"$in": bson.A{1, 2}}},
+		persist.ArrayContainsAny("tags", []interface{}{1, 2}))
+}
+
+func TestArrayFiltersQueries(t *testing.T) {
+	persistence := NewDummyMapMongoDbPersistence()
+	persistence.Configure(getTestConfig(t,
+		"collection", "dummies_arrays",
+	))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+
+	items := []map[string]interface{}{
+		{"Id": "arr_1", "tags": bson.A{"a", "b", "c"}},
+		{"Id": "arr_2", "tags": bson.A{"a", "d"}},
+		{"Id": "arr_3", "tags": "a"},
+	}
+	for _, item := range items {
+		_, err = persistence.Create("", item)
+		assert.Nil(t, err)
+	}
+
+	count := func(filter bson.M) int64 {
+		result, err := persistence.Collection.CountDocuments(context.Background(), filter)
+		assert.Nil(t, err)
+		return result
+	}
+
+	// Scalar field is not matched as an array
+	assert.Equal(t, int64(2), count(persist.ArrayContains("tags", "a")))
+	assert.Equal(t, int64(1), count(persist.ArrayContains("tags", "b")))
+
+	assert.Equal(t, int64(1), count(persist.ArrayContainsAll("tags", "a,b")))
+	assert.Equal(t, int64(1), count(persist.ArrayContainsAll("tags", []string{"a", "d"})))
+	assert.Equal(t, int64(0), count(persist.ArrayContainsAll("tags", []string{})))
+
+	assert.Equal(t, int64(2), count(persist.ArrayContainsAny("tags", []string{"c", "d"})))
+	assert.Equal(t, int64(0), count(persist.ArrayContainsAny("tags", []string{"x"})))
+}
@@ -0,0 +1,30 @@
+package test_persistence
+
+import (
+	"reflect"
+	"strings"
+
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+)
+
+// extends MongoDbPersistence
+// overrides ConvertToPublic to check that base operations use conversion overrides
+type DummyConvertMongoDbPersistence struct {
+	persist.MongoDbPersistence
+}
+
+func NewDummyConvertMongoDbPersistence() *DummyConvertMongoDbPersistence {
+	proto := reflect.TypeOf(Dummy{})
+	c := &DummyConvertMongoDbPersistence{}
+	c.MongoDbPersistence = *persist.InheritMongoDbPersistence(c, proto, "dummies_convert")
+	return c
+}
+
+func (c *DummyConvertMongoDbPersistence) ConvertToPublic(value interface{}) interface{} {
+	item := c.MongoDbPersistence.ConvertToPublic(value)
+	if dummy, ok := item.(Dummy); ok {
+		dummy.Content = strings.ToUpper(dummy.Content)
+		return dummy
+	}
+	return item
+}
@@ -0,0 +1,50 @@
+package test_persistence
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDummyConvertMongoDbPersistence(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	persistence := NewDummyConvertMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr)
+		return
+	}
+
+	// Base Create uses overridden conversion
+	result, err := persistence.Create("", Dummy{Id: "convert_1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	dummy, ok := result.(Dummy)
+	assert.True(t, ok)
+	assert.Equal(t, "CONTENT 1", dummy.Content)
+
+	// Base queries use overridden conversion
+	items, err := persistence.GetListByFilter("", bson.M{"_id": "convert_1"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "CONTENT 1", items[0].(Dummy).Content)
+
+	page, err := persistence.GetPageByFilter("", bson.M{"_id": "convert_1"}, nil, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, "CONTENT 1", page.Data[0].(Dummy).Content)
+
+	item, err := persistence.GetOneRandom("", bson.M{"_id": "convert_1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "CONTENT 1", item.(Dummy).Content)
+}
@@ -64,6 +64,16 @@ func (c *DummyMapMongoDbPersistence) Update(correlationId string, item map[strin
 	return result, err
 }
 
+func (c *DummyMapMongoDbPersistence) ReplaceById(correlationId string, item map[string]interface{}) (result map[string]interface{}, err error) {
+	value, err := c.IdentifiableMongoDbPersistence.ReplaceById(correlationId, item)
+
+	if value != nil {
+		val, _ := value.(map[string]interface{})
+		result = val
+	}
+	return result, err
+}
+
 func (c *DummyMapMongoDbPersistence) UpdatePartially(correlationId string, id string, data *cdata.AnyValueMap) (item map[string]interface{}, err error) {
 	result, err := c.IdentifiableMongoDbPersistence.UpdatePartially(correlationId, id, data)
 
@@ -74,6 +84,16 @@ func (c *DummyMapMongoDbPersistence) UpdatePartially(correlationId string, id st
 	return item, err
 }
 
+func (c *DummyMapMongoDbPersistence) ModifyById(correlationId string, id string, update bson.M) (item map[string]interface{}, err error) {
+	result, err := c.IdentifiableMongoDbPersistence.ModifyById(correlationId, id, update)
+
+	if result != nil {
+		val, _ := result.(map[string]interface{})
+		item = val
+	}
+	return item, err
+}
+
 func (c *DummyMapMongoDbPersistence) DeleteById(correlationId string, id string) (item map[string]interface{}, err error) {
 	result, err := c.IdentifiableMongoDbPersistence.DeleteById(correlationId, id)
 
@@ -84,7 +104,7 @@ func (c *DummyMapMongoDbPersistence) DeleteById(correlationId string, id string)
 	return item, err
 }
 
-func (c *DummyMapMongoDbPersistence) DeleteByIds(correlationId string, ids []string) (err error) {
+func (c *DummyMapMongoDbPersistence) DeleteByIds(correlationId string, ids []string) (count int64, err error) {
 	convIds := make([]interface{}, len(ids))
 	for i, v := range ids {
 		convIds[i] = v
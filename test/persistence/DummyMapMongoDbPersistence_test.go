@@ -1,10 +1,14 @@
 package test_persistence
 
 import (
-	"os"
 	"testing"
+	"time"
 
 	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestDummyMapMongoDbPersistence(t *testing.T) {
@@ -12,34 +16,162 @@ func TestDummyMapMongoDbPersistence(t *testing.T) {
 	var persistence *DummyMapMongoDbPersistence
 	var fixture DummyMapPersistenceFixture
 
-	mongoUri := os.Getenv("MONGO_URI")
-	mongoHost := os.Getenv("MONGO_HOST")
-	if mongoHost == "" {
-		mongoHost = "localhost"
+	dbConfig := getTestConfig(t)
+
+	persistence = NewDummyMapMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	fixture = *NewDummyMapPersistenceFixture(persistence)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
 	}
-	mongoPort := os.Getenv("MONGO_PORT")
-	if mongoPort == "" {
-		mongoPort = "27017"
+	defer persistence.Close("")
+
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr)
+		return
 	}
-	mongoDatabase := os.Getenv("MONGO_DB")
-	if mongoDatabase == "" {
-		mongoDatabase = "test"
+
+	t.Run("DummyMapMongoDbPersistence:CRUD", fixture.TestCrudOperations)
+	t.Run("DummyMapMongoDbPersistence:Batch", fixture.TestBatchOperations)
+	t.Run("DummyMapMongoDbPersistence:Modify", fixture.TestModifyOperations)
+	t.Run("DummyMapMongoDbPersistence:Replace", fixture.TestReplaceOperations)
+
+}
+
+func TestDummyMapMongoDbPersistenceNestedIds(t *testing.T) {
+	persistence := NewDummyMapMongoDbPersistence()
+	persistence.Configure(cconf.NewConfigParamsFromTuples(
+		"options.convert_nested_ids", "true",
+	))
+
+	item := map[string]interface{}{
+		"Id":  "1",
+		"key": "Key 1",
+		"owner": map[string]interface{}{
+			"Id":   "2",
+			"name": "Owner",
+		},
+		"children": []interface{}{
+			map[string]interface{}{"Id": "3"},
+			bson.M{"Id": "4"},
+		},
+	}
+
+	// Convert ids to database format
+	value := persistence.ConvertFromPublic(item).(map[string]interface{})
+	assert.Equal(t, "1", value["_id"])
+	assert.Equal(t, "2", value["owner"].(map[string]interface{})["_id"])
+	children := value["children"].([]interface{})
+	assert.Equal(t, "3", children[0].(map[string]interface{})["_id"])
+	assert.Equal(t, "4", children[1].(bson.M)["_id"])
+	assert.NotContains(t, value["owner"], "Id")
+
+	// Convert ids back to public format
+	value = persistence.ConvertToPublic(value).(map[string]interface{})
+	assert.Equal(t, "1", value["Id"])
+	assert.Equal(t, "2", value["owner"].(map[string]interface{})["Id"])
+	children = value["children"].([]interface{})
+	assert.Equal(t, "3", children[0].(map[string]interface{})["Id"])
+	assert.Equal(t, "4", children[1].(bson.M)["Id"])
+	assert.NotContains(t, value["owner"], "_id")
+}
+
+func TestDummyMapMongoDbPersistenceTopLevelIds(t *testing.T) {
+	// Nested ids are not converted by default
+	persistence := NewDummyMapMongoDbPersistence()
+	persistence.Configure(cconf.NewEmptyConfigParams())
+
+	item := map[string]interface{}{
+		"Id":    "1",
+		"owner": map[string]interface{}{"Id": "2"},
+	}
+	value := persistence.ConvertFromPublic(item).(map[string]interface{})
+	assert.Equal(t, "1", value["_id"])
+	assert.Equal(t, "2", value["owner"].(map[string]interface{})["Id"])
+}
+
+func TestDummyMapMongoDbPersistenceIdFieldConversion(t *testing.T) {
+	persistence := NewDummyMapMongoDbPersistence()
+	persistence.Configure(cconf.NewConfigParamsFromTuples(
+		"options.id_field", "code",
+	))
+
+	item := map[string]interface{}{
+		"code": "1",
+		"key":  "Key 1",
 	}
-	if mongoUri == "" && mongoHost == "" {
+	value := persistence.ConvertFromPublic(item).(map[string]interface{})
+	assert.Equal(t, "1", value["_id"])
+	assert.NotContains(t, value, "code")
+
+	value = persistence.ConvertToPublic(value).(map[string]interface{})
+	assert.Equal(t, "1", value["code"])
+	assert.NotContains(t, value, "_id")
+	assert.NotContains(t, value, "Id")
+}
+
+func TestDummyMapMongoDbPersistenceIdField(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_id_field",
+		"options.id_field", "code",
+	)
+
+	persistence := NewDummyMapMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
 		return
 	}
+	defer persistence.Close("")
+
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+
+	// Item with the custom id field
+	item, err := persistence.Create("", map[string]interface{}{"code": "code_1", "key": "Key 1", "content": "Content 1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "code_1", item["code"])
+	assert.NotContains(t, item, "_id")
+
+	item, err = persistence.GetOneById("", "code_1")
+	assert.Nil(t, err)
+	assert.Equal(t, "code_1", item["code"])
+	assert.Equal(t, "Key 1", item["key"])
 
-	dbConfig := cconf.NewConfigParamsFromTuples(
-		"connection.uri", mongoUri,
-		"connection.host", mongoHost,
-		"connection.port", mongoPort,
-		"connection.database", mongoDatabase,
+	// Id is generated into the custom field
+	item, err = persistence.Create("", map[string]interface{}{"key": "Key 2", "content": "Content 2"})
+	assert.Nil(t, err)
+	code, ok := item["code"].(string)
+	assert.True(t, ok)
+	assert.NotEqual(t, "", code)
+	assert.NotContains(t, item, "Id")
+
+	item, err = persistence.Update("", map[string]interface{}{"code": code, "key": "Key 2", "content": "Content 3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Content 3", item["content"])
+
+	item, err = persistence.GetOneById("", code)
+	assert.Nil(t, err)
+	assert.Equal(t, "Content 3", item["content"])
+}
+
+func TestDummyMapMongoDbPersistenceGeo(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_geo",
 	)
 
-	persistence = NewDummyMapMongoDbPersistence()
+	persistence := NewDummyMapMongoDbPersistence()
 	persistence.Configure(dbConfig)
+	persistence.EnsureGeoIndex("location")
 
-	fixture = *NewDummyMapPersistenceFixture(persistence)
+	fixture := NewDummyMapPersistenceFixture(persistence)
 
 	opnErr := persistence.Open("")
 	if opnErr != nil {
@@ -48,13 +180,123 @@ func TestDummyMapMongoDbPersistence(t *testing.T) {
 	}
 	defer persistence.Close("")
 
-	opnErr = persistence.Clear("")
+	// Clear drops the collection with the geo index, so items are deleted instead
+	err := persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+
+	t.Run("DummyMapMongoDbPersistence:Geo", fixture.TestGeoOperations)
+}
+
+func TestDummyMapMongoDbPersistenceTimestamps(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"options.track_timestamps", "true",
+		"options.update_time_field", "modified_time",
+	)
+
+	persistence := NewDummyMapMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
 	if opnErr != nil {
-		t.Error("Error cleaned persistence", opnErr)
+		t.Error("Error opened persistence", opnErr)
 		return
 	}
+	defer persistence.Close("")
 
-	t.Run("DummyMapMongoDbPersistence:CRUD", fixture.TestCrudOperations)
-	t.Run("DummyMapMongoDbPersistence:Batch", fixture.TestBatchOperations)
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+
+	// Create sets creation time
+	item, err := persistence.Create("", map[string]interface{}{"Id": "time_1", "key": "Key 1", "content": "Content 1"})
+	assert.Nil(t, err)
+	createTime, ok := item["create_time"].(primitive.DateTime)
+	assert.True(t, ok)
+	assert.False(t, createTime.Time().IsZero())
+	assert.NotContains(t, item, "modified_time")
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Update keeps creation time and sets modification time
+	item, err = persistence.Update("", map[string]interface{}{"Id": "time_1", "key": "Key 2", "content": "Content 2"})
+	assert.Nil(t, err)
+	assert.Equal(t, createTime, item["create_time"])
+	updateTime, ok := item["modified_time"].(primitive.DateTime)
+	assert.True(t, ok)
+	assert.True(t, updateTime > createTime)
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Partial update changes modification time
+	item, err = persistence.UpdatePartially("", "time_1", cdata.NewAnyValueMapFromTuples("content", "Content 3"))
+	assert.Nil(t, err)
+	assert.Equal(t, createTime, item["create_time"])
+	assert.True(t, item["modified_time"].(primitive.DateTime) > updateTime)
+	updateTime = item["modified_time"].(primitive.DateTime)
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Modification with operators changes modification time
+	item, err = persistence.ModifyById("", "time_1", bson.M{"$set": bson.M{"content": "Content 3"}})
+	assert.Nil(t, err)
+	assert.Equal(t, createTime, item["create_time"])
+	assert.True(t, item["modified_time"].(primitive.DateTime) > updateTime)
+	updateTime = item["modified_time"].(primitive.DateTime)
+
+	time.Sleep(10 * time.Millisecond)
+
+	// Update by filter changes modification time
+	count, err := persistence.IdentifiableMongoDbPersistence.UpdateManyByFilter("", bson.M{"_id": "time_1"},
+		cdata.NewAnyValueMapFromTuples("content", "Content 3"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	item, err = persistence.GetOneById("", "time_1")
+	assert.Nil(t, err)
+	assert.Equal(t, createTime, item["create_time"])
+	assert.True(t, item["modified_time"].(primitive.DateTime) > updateTime)
+
+	// Timestamps are kept when items are read
+	item, err = persistence.GetOneById("", "time_1")
+	assert.Nil(t, err)
+	assert.Equal(t, createTime, item["create_time"])
+	assert.Contains(t, item, "modified_time")
+
+	// Set keeps creation time passed in the item
+	result, err := persistence.IdentifiableMongoDbPersistence.Set("", item)
+	assert.Nil(t, err)
+	item = result.(map[string]interface{})
+	assert.Equal(t, createTime, item["create_time"])
+
+	// Set keeps stored creation time when the item doesn't have it
+	result, err = persistence.IdentifiableMongoDbPersistence.Set("",
+		map[string]interface{}{"Id": "time_1", "key": "Key 4", "content": "Content 4"})
+	assert.Nil(t, err)
+	item = result.(map[string]interface{})
+	assert.Equal(t, createTime, item["create_time"])
+	assert.Equal(t, "Content 4", item["content"])
+
+	// Replace keeps stored creation time when the item doesn't have it
+	item, err = persistence.ReplaceById("", map[string]interface{}{"Id": "time_1", "key": "Key 5", "content": "Content 5"})
+	assert.Nil(t, err)
+	assert.Equal(t, createTime, item["create_time"])
+	assert.Equal(t, "Content 5", item["content"])
+
+	// Set creates new items with creation time
+	result, err = persistence.IdentifiableMongoDbPersistence.Set("",
+		map[string]interface{}{"Id": "time_3", "key": "Key 3", "content": "Content 3"})
+	assert.Nil(t, err)
+	item = result.(map[string]interface{})
+	newCreateTime, ok := item["create_time"].(primitive.DateTime)
+	assert.True(t, ok)
+	assert.True(t, newCreateTime > createTime)
+
+	// Upserted items get both timestamps
+	result, err = persistence.IdentifiableMongoDbPersistence.UpsertPartially("", "time_2",
+		cdata.NewAnyValueMapFromTuples("key", "Key 2"))
+	assert.Nil(t, err)
+	item = result.(map[string]interface{})
+	assert.Contains(t, item, "create_time")
+	assert.Contains(t, item, "modified_time")
 
+	err = persistence.Clear("")
+	assert.Nil(t, err)
 }
@@ -1,9 +1,11 @@
 package test_persistence
 
 import (
+	"testing"
+
 	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 type DummyMapPersistenceFixture struct {
@@ -146,7 +148,7 @@ func (c *DummyMapPersistenceFixture) TestBatchOperations(t *testing.T) {
 	assert.Len(t, items, 2)
 
 	// Delete batch
-	err = c.persistence.DeleteByIds("", []string{dummy1["Id"].(string), dummy2["Id"].(string)})
+	_, err = c.persistence.DeleteByIds("", []string{dummy1["Id"].(string), dummy2["Id"].(string)})
 	if err != nil {
 		t.Errorf("DeleteByIds method error %v", err)
 	}
@@ -161,3 +163,115 @@ func (c *DummyMapPersistenceFixture) TestBatchOperations(t *testing.T) {
 	assert.Len(t, items, 0)
 
 }
+
+func (c *DummyMapPersistenceFixture) TestModifyOperations(t *testing.T) {
+	dummy, err := c.persistence.Create("", map[string]interface{}{"Id": "modify_1", "key": "Key 1", "content": "Content 1"})
+	assert.Nil(t, err)
+	assert.NotNil(t, dummy)
+
+	// Update must contain only operators
+	_, err = c.persistence.ModifyById("", "modify_1", bson.M{"content": "Content 2"})
+	assert.NotNil(t, err)
+
+	// Increment a counter
+	item, err := c.persistence.ModifyById("", "modify_1", bson.M{"$inc": bson.M{"counter": 1}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 1, item["counter"])
+
+	item, err = c.persistence.ModifyById("", "modify_1", bson.M{"$inc": bson.M{"counter": 2}})
+	assert.Nil(t, err)
+	assert.EqualValues(t, 3, item["counter"])
+
+	// Push values into an array
+	item, err = c.persistence.ModifyById("", "modify_1", bson.M{"$push": bson.M{"tags": "tag1"}})
+	assert.Nil(t, err)
+	item, err = c.persistence.ModifyById("", "modify_1", bson.M{"$push": bson.M{"tags": "tag2"}})
+	assert.Nil(t, err)
+	assert.Len(t, item["tags"], 2)
+	assert.Equal(t, "Key 1", item["key"])
+
+	// Unset a field
+	item, err = c.persistence.ModifyById("", "modify_1", bson.M{"$unset": bson.M{"content": ""}})
+	assert.Nil(t, err)
+	assert.NotContains(t, item, "content")
+
+	// Missing item is not modified
+	item, err = c.persistence.ModifyById("", "modify_missing", bson.M{"$inc": bson.M{"counter": 1}})
+	assert.Nil(t, err)
+	assert.Nil(t, item)
+
+	_, err = c.persistence.DeleteById("", "modify_1")
+	assert.Nil(t, err)
+}
+
+func (c *DummyMapPersistenceFixture) TestReplaceOperations(t *testing.T) {
+	dummy, err := c.persistence.Create("", map[string]interface{}{"Id": "replace_1", "key": "Key 1", "content": "Content 1"})
+	assert.Nil(t, err)
+	assert.NotNil(t, dummy)
+
+	// Update keeps fields missing in the item
+	item, err := c.persistence.Update("", map[string]interface{}{"Id": "replace_1", "key": "Key 2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Key 2", item["key"])
+	assert.Equal(t, "Content 1", item["content"])
+
+	// Replace removes fields missing in the item
+	item, err = c.persistence.ReplaceById("", map[string]interface{}{"Id": "replace_1", "key": "Key 3"})
+	assert.Nil(t, err)
+	assert.Equal(t, "replace_1", item["Id"])
+	assert.Equal(t, "Key 3", item["key"])
+	assert.NotContains(t, item, "content")
+
+	item, err = c.persistence.GetOneById("", "replace_1")
+	assert.Nil(t, err)
+	assert.Equal(t, "Key 3", item["key"])
+	assert.NotContains(t, item, "content")
+
+	// Missing item is not created
+	item, err = c.persistence.ReplaceById("", map[string]interface{}{"Id": "replace_missing", "key": "Key 1"})
+	assert.Nil(t, err)
+	assert.Nil(t, item)
+
+	item, err = c.persistence.GetOneById("", "replace_missing")
+	assert.Nil(t, err)
+	assert.Nil(t, item)
+
+	_, err = c.persistence.DeleteById("", "replace_1")
+	assert.Nil(t, err)
+}
+
+func (c *DummyMapPersistenceFixture) TestGeoOperations(t *testing.T) {
+	points := []map[string]interface{}{
+		{"Id": "geo_1", "key": "Key 1", "location": bson.M{"type": "Point", "coordinates": bson.A{-73.97, 40.77}}},
+		{"Id": "geo_2", "key": "Key 2", "location": bson.M{"type": "Point", "coordinates": bson.A{-73.88, 40.78}}},
+		{"Id": "geo_3", "key": "Key 3", "location": bson.M{"type": "Point", "coordinates": bson.A{-74.00, 40.74}}},
+		{"Id": "geo_4", "key": "Key 4", "location": bson.M{"type": "Point", "coordinates": bson.A{-118.24, 34.05}}},
+	}
+	for _, point := range points {
+		_, err := c.persistence.Create("", point)
+		assert.Nil(t, err)
+	}
+
+	// Items are sorted from nearest to farthest
+	page, err := c.persistence.GetNearByFilter("", nil, "location", -73.98, 40.76, 20000, cdata.NewPagingParams(0, 10, true))
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 3)
+	assert.Equal(t, int64(3), *page.Total)
+	ids := []interface{}{}
+	for _, item := range page.Data {
+		ids = append(ids, item.(map[string]interface{})["Id"])
+	}
+	assert.Equal(t, []interface{}{"geo_1", "geo_3", "geo_2"}, ids)
+
+	// Filter is combined with location
+	page, err = c.persistence.GetNearByFilter("", bson.M{"key": "Key 2"}, "location", -73.98, 40.76, 20000, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+
+	// Coordinates are validated
+	_, err = c.persistence.GetNearByFilter("", nil, "location", -200, 40.76, 20000, nil)
+	assert.NotNil(t, err)
+
+	_, err = c.persistence.DeleteByIds("", []string{"geo_1", "geo_2", "geo_3", "geo_4"})
+	assert.Nil(t, err)
+}
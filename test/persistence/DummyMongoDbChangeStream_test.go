@@ -0,0 +1,39 @@
+package test_persistence
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDummyMongoDbChangeStream(t *testing.T) {
+
+	// Change streams are supported only by replica sets
+	mongoReplicaSet := os.Getenv("MONGO_REPLICA_SET")
+	if mongoReplicaSet == "" {
+		t.Skip("MONGO_REPLICA_SET is not set")
+	}
+
+	dbConfig := getTestConfig(t,
+		"options.replica_set", mongoReplicaSet,
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	fixture := *NewDummyPersistenceFixture(persistence)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr)
+		return
+	}
+
+	t.Run("DummyMongoDbChangeStream:WatchChanges", fixture.TestWatchChangesOperations)
+}
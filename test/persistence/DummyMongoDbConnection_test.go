@@ -1,12 +1,13 @@
 package test_persistence
 
 import (
-	"os"
 	"testing"
 
 	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
 	cref "github.com/pip-services3-go/pip-services3-commons-go/refer"
 	conn "github.com/pip-services3-go/pip-services3-mongodb-go/connect"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func TestDummyMongoDbConnection(t *testing.T) {
@@ -15,29 +16,7 @@ func TestDummyMongoDbConnection(t *testing.T) {
 	var fixture DummyPersistenceFixture
 	var connection *conn.MongoDbConnection
 
-	mongoUri := os.Getenv("MONGO_URI")
-	mongoHost := os.Getenv("MONGO_HOST")
-	if mongoHost == "" {
-		mongoHost = "localhost"
-	}
-	mongoPort := os.Getenv("MONGO_PORT")
-	if mongoPort == "" {
-		mongoPort = "27017"
-	}
-	mongoDatabase := os.Getenv("MONGO_DB")
-	if mongoDatabase == "" {
-		mongoDatabase = "test"
-	}
-	if mongoUri == "" && mongoHost == "" {
-		return
-	}
-
-	dbConfig := cconf.NewConfigParamsFromTuples(
-		"connection.uri", mongoUri,
-		"connection.host", mongoHost,
-		"connection.port", mongoPort,
-		"connection.database", mongoDatabase,
-	)
+	dbConfig := getTestConfig(t)
 
 	connection = conn.NewMongoDbConnection()
 	connection.Configure(dbConfig)
@@ -73,3 +52,135 @@ func TestDummyMongoDbConnection(t *testing.T) {
 	t.Run("DummyMondoDbConnection:Batch", fixture.TestBatchOperations)
 
 }
+
+func TestDummyMongoDbConnectionReferences(t *testing.T) {
+	// Without a registered connection the persistence creates a local one
+	persistence := NewDummyMongoDbPersistence()
+	persistence.SetReferences(cref.NewEmptyReferences())
+	assert.NotNil(t, persistence.Connection)
+
+	// Registered connection is shared by all persistence components
+	connection := conn.NewMongoDbConnection()
+	descr := cref.NewDescriptor("pip-services", "connection", "mongodb", "default", "1.0")
+	ref := cref.NewReferencesFromTuples(descr, connection)
+
+	persistence1 := NewDummyMongoDbPersistence()
+	persistence1.SetReferences(ref)
+	persistence2 := NewDummyMapMongoDbPersistence()
+	persistence2.SetReferences(ref)
+
+	assert.Same(t, connection, persistence1.Connection)
+	assert.Same(t, connection, persistence2.Connection)
+}
+
+func TestDummyMongoDbConnectionSharing(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(dbConfig)
+
+	descr := cref.NewDescriptor("pip-services", "connection", "mongodb", "default", "1.0")
+	ref := cref.NewReferencesFromTuples(descr, connection)
+
+	persistence1 := NewDummyMongoDbPersistence()
+	persistence1.SetReferences(ref)
+	persistence2 := NewDummyMapMongoDbPersistence()
+	persistence2.SetReferences(ref)
+
+	opnErr := connection.Open("")
+	if opnErr != nil {
+		t.Error("Error opened connection", opnErr)
+		return
+	}
+	defer connection.Close("")
+
+	opnErr = persistence1.Open("")
+	assert.Nil(t, opnErr)
+	opnErr = persistence2.Open("")
+	assert.Nil(t, opnErr)
+
+	// Both components use the same client
+	assert.NotNil(t, persistence1.Client)
+	assert.Same(t, connection.GetConnection(), persistence1.Client)
+	assert.Same(t, persistence1.Client, persistence2.Client)
+
+	// Closing a component keeps the shared connection open
+	err := persistence1.Close("")
+	assert.Nil(t, err)
+	assert.True(t, connection.IsOpen())
+
+	err = persistence2.Close("")
+	assert.Nil(t, err)
+}
+
+func TestDummyMongoDbConnectionRefCount(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(dbConfig)
+
+	descr := cref.NewDescriptor("pip-services", "connection", "mongodb", "default", "1.0")
+	ref := cref.NewReferencesFromTuples(descr, connection)
+
+	persistence1 := NewDummyMongoDbPersistence()
+	persistence1.SetReferences(ref)
+	persistence2 := NewDummyMongoDbPersistence()
+	persistence2.SetReferences(ref)
+
+	// Components open the shared connection themselves
+	opnErr := persistence1.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	opnErr = persistence2.Open("")
+	assert.Nil(t, opnErr)
+	assert.Same(t, persistence1.Client, persistence2.Client)
+
+	// Closing one component keeps the other functional
+	err := persistence1.Close("")
+	assert.Nil(t, err)
+	assert.True(t, connection.IsOpen())
+
+	dummy, err := persistence2.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	result, err := persistence2.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, dummy.Id, result.Id)
+	_, err = persistence2.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+
+	// The last component disconnects
+	err = persistence2.Close("")
+	assert.Nil(t, err)
+	assert.False(t, connection.IsOpen())
+}
+
+func TestDummyMongoDbConnectionFailedOpen(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	connection := conn.NewMongoDbConnection()
+	connection.Configure(dbConfig)
+
+	descr := cref.NewDescriptor("pip-services", "connection", "mongodb", "default", "1.0")
+	ref := cref.NewReferencesFromTuples(descr, connection)
+
+	// Capped collection without size can't be created
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(cconf.NewConfigParamsFromTuples("collection", "dummies_failed_open"))
+	persistence.SetReferences(ref)
+	persistence.EnsureCollection(options.CreateCollection().SetCapped(true))
+
+	// Failed opens release the shared connection
+	for i := 0; i < 2; i++ {
+		err := persistence.Open("")
+		assert.NotNil(t, err)
+		assert.False(t, persistence.IsOpen())
+		assert.Nil(t, persistence.Client)
+		assert.Nil(t, persistence.Collection)
+		assert.False(t, connection.IsOpen())
+	}
+
+	err := persistence.Close("")
+	assert.Nil(t, err)
+}
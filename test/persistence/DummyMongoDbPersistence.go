@@ -31,6 +31,29 @@ func (c *DummyMongoDbPersistence) Create(correlationId string, item Dummy) (resu
 	return result, err
 }
 
+func (c *DummyMongoDbPersistence) CreateIfAbsent(correlationId string, item Dummy) (result Dummy, err error) {
+	value, err := c.IdentifiableMongoDbPersistence.CreateIfAbsent(correlationId, item)
+	if value != nil {
+		val, _ := value.(Dummy)
+		result = val
+	}
+	return result, err
+}
+
+func (c *DummyMongoDbPersistence) CreateMany(correlationId string, items []Dummy) (result []Dummy, err error) {
+	convItems := make([]interface{}, len(items))
+	for i, v := range items {
+		convItems[i] = v
+	}
+	values, err := c.IdentifiableMongoDbPersistence.CreateMany(correlationId, convItems)
+	result = make([]Dummy, len(values))
+	for i, v := range values {
+		val, _ := v.(Dummy)
+		result[i] = val
+	}
+	return result, err
+}
+
 func (c *DummyMongoDbPersistence) GetListByIds(correlationId string, ids []string) (items []Dummy, err error) {
 	convIds := make([]interface{}, len(ids))
 	for i, v := range ids {
@@ -45,6 +68,21 @@ func (c *DummyMongoDbPersistence) GetListByIds(correlationId string, ids []strin
 	return items, err
 }
 
+func (c *DummyMongoDbPersistence) GetListByIdsOrdered(correlationId string, ids []string) (items []*Dummy, err error) {
+	convIds := make([]interface{}, len(ids))
+	for i, v := range ids {
+		convIds[i] = v
+	}
+	result, err := c.IdentifiableMongoDbPersistence.GetListByIdsOrdered(correlationId, convIds)
+	items = make([]*Dummy, len(result))
+	for i, v := range result {
+		if val, ok := v.(Dummy); ok {
+			items[i] = &val
+		}
+	}
+	return items, err
+}
+
 func (c *DummyMongoDbPersistence) GetOneById(correlationId string, id string) (item Dummy, err error) {
 	result, err := c.IdentifiableMongoDbPersistence.GetOneById(correlationId, id)
 	if result != nil {
@@ -54,6 +92,15 @@ func (c *DummyMongoDbPersistence) GetOneById(correlationId string, id string) (i
 	return item, err
 }
 
+func (c *DummyMongoDbPersistence) GetOneByIdWithProjection(correlationId string, id string, projection interface{}) (item Dummy, err error) {
+	result, err := c.IdentifiableMongoDbPersistence.GetOneByIdWithProjection(correlationId, id, projection)
+	if result != nil {
+		val, _ := result.(Dummy)
+		item = val
+	}
+	return item, err
+}
+
 func (c *DummyMongoDbPersistence) Update(correlationId string, item Dummy) (result Dummy, err error) {
 	value, err := c.IdentifiableMongoDbPersistence.Update(correlationId, item)
 	if value != nil {
@@ -73,6 +120,35 @@ func (c *DummyMongoDbPersistence) UpdatePartially(correlationId string, id strin
 	return item, err
 }
 
+func (c *DummyMongoDbPersistence) UpdateReturnBefore(correlationId string, item Dummy) (result Dummy, err error) {
+	value, err := c.IdentifiableMongoDbPersistence.UpdateReturnBefore(correlationId, item)
+	if value != nil {
+		val, _ := value.(Dummy)
+		result = val
+	}
+	return result, err
+}
+
+func (c *DummyMongoDbPersistence) UpdatePartiallyReturnBefore(correlationId string, id string, data *cdata.AnyValueMap) (item Dummy, err error) {
+	result, err := c.IdentifiableMongoDbPersistence.UpdatePartiallyReturnBefore(correlationId, id, data)
+
+	if result != nil {
+		val, _ := result.(Dummy)
+		item = val
+	}
+	return item, err
+}
+
+func (c *DummyMongoDbPersistence) UpsertPartially(correlationId string, id string, data *cdata.AnyValueMap) (item Dummy, err error) {
+	result, err := c.IdentifiableMongoDbPersistence.UpsertPartially(correlationId, id, data)
+
+	if result != nil {
+		val, _ := result.(Dummy)
+		item = val
+	}
+	return item, err
+}
+
 func (c *DummyMongoDbPersistence) DeleteById(correlationId string, id string) (item Dummy, err error) {
 	result, err := c.IdentifiableMongoDbPersistence.DeleteById(correlationId, id)
 	if result != nil {
@@ -82,7 +158,7 @@ func (c *DummyMongoDbPersistence) DeleteById(correlationId string, id string) (i
 	return item, err
 }
 
-func (c *DummyMongoDbPersistence) DeleteByIds(correlationId string, ids []string) (err error) {
+func (c *DummyMongoDbPersistence) DeleteByIds(correlationId string, ids []string) (count int64, err error) {
 	convIds := make([]interface{}, len(ids))
 	for i, v := range ids {
 		convIds[i] = v
@@ -90,24 +166,16 @@ func (c *DummyMongoDbPersistence) DeleteByIds(correlationId string, ids []string
 	return c.IdentifiableMongoDbPersistence.DeleteByIds(correlationId, convIds)
 }
 
-func (c *DummyMongoDbPersistence) GetPageByFilter(correlationId string, filter *cdata.FilterParams, paging *cdata.PagingParams) (page *DummyPage, err error) {
-
-	if filter == nil {
-		filter = cdata.NewEmptyFilterParams()
-	}
+func (c *DummyMongoDbPersistence) ComposeFilter(filter *cdata.FilterParams) interface{} {
+	return persist.FilterParamsToBson(filter, map[string]persist.FilterFieldSpec{
+		"Key": {Field: "key"},
+	})
+}
 
-	key := filter.GetAsNullableString("Key")
-	var filterObj bson.M
-	if key != nil && *key != "" {
-		filterObj = bson.M{"key": *key}
-	} else {
-		filterObj = bson.M{}
-	}
+func (c *DummyMongoDbPersistence) GetPageByFilter(correlationId string, filter *cdata.FilterParams, paging *cdata.PagingParams) (page *DummyPage, err error) {
 	sorting := bson.M{"key": -1}
 
-	tempPage, err := c.IdentifiableMongoDbPersistence.GetPageByFilter(correlationId,
-		filterObj, paging,
-		sorting, nil)
+	tempPage, err := c.IdentifiableMongoDbPersistence.GetPageByFilterParams(correlationId, filter, paging, sorting)
 	// Convert to DummyPage
 	dataLen := int64(len(tempPage.Data)) // For full release tempPage and delete this by GC
 	data := make([]Dummy, dataLen)
@@ -119,17 +187,5 @@ func (c *DummyMongoDbPersistence) GetPageByFilter(correlationId string, filter *
 }
 
 func (c *DummyMongoDbPersistence) GetCountByFilter(correlationId string, filter *cdata.FilterParams) (count int64, err error) {
-
-	if filter == nil {
-		filter = cdata.NewEmptyFilterParams()
-	}
-
-	key := filter.GetAsNullableString("Key")
-	var filterObj bson.M
-	if key != nil && *key != "" {
-		filterObj = bson.M{"key": *key}
-	} else {
-		filterObj = bson.M{}
-	}
-	return c.IdentifiableMongoDbPersistence.GetCountByFilter(correlationId, filterObj)
+	return c.IdentifiableMongoDbPersistence.GetCountByFilterParams(correlationId, filter)
 }
@@ -1,10 +1,27 @@
 package test_persistence
 
 import (
-	"os"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
+	cref "github.com/pip-services3-go/pip-services3-commons-go/refer"
+	ccount "github.com/pip-services3-go/pip-services3-components-go/count"
+	ctrace "github.com/pip-services3-go/pip-services3-components-go/trace"
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 func TestDummyMongoDbPersistence(t *testing.T) {
@@ -12,34 +29,349 @@ func TestDummyMongoDbPersistence(t *testing.T) {
 	var persistence *DummyMongoDbPersistence
 	var fixture DummyPersistenceFixture
 
-	mongoUri := os.Getenv("MONGO_URI")
-	mongoHost := os.Getenv("MONGO_HOST")
-	if mongoHost == "" {
-		mongoHost = "localhost"
+	dbConfig := getTestConfig(t)
+
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	fixture = *NewDummyPersistenceFixture(persistence)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	t.Run("DummyMongoDbPersistence:CRUD", fixture.TestCrudOperations)
+	t.Run("DummyMongoDbPersistence:Batch", fixture.TestBatchOperations)
+	t.Run("DummyMongoDbPersistence:CreateMany", fixture.TestCreateManyOperations)
+	t.Run("DummyMongoDbPersistence:BulkWrite", fixture.TestBulkWriteOperations)
+	t.Run("DummyMongoDbPersistence:Aggregate", fixture.TestAggregateOperations)
+	t.Run("DummyMongoDbPersistence:Distinct", fixture.TestDistinctOperations)
+	t.Run("DummyMongoDbPersistence:GetOneByFilter", fixture.TestGetOneByFilterOperations)
+	t.Run("DummyMongoDbPersistence:Exists", fixture.TestExistsOperations)
+	t.Run("DummyMongoDbPersistence:UpdateManyByFilter", fixture.TestUpdateManyByFilterOperations)
+	t.Run("DummyMongoDbPersistence:EstimatedCount", fixture.TestEstimatedCountOperations)
+	t.Run("DummyMongoDbPersistence:StreamByFilter", fixture.TestStreamByFilterOperations)
+	t.Run("DummyMongoDbPersistence:IterateByFilter", fixture.TestIterateByFilterOperations)
+	t.Run("DummyMongoDbPersistence:GetListByIdsOrdered", fixture.TestGetListByIdsOrderedOperations)
+	t.Run("DummyMongoDbPersistence:GetOneByIdWithProjection", fixture.TestGetOneByIdWithProjectionOperations)
+	t.Run("DummyMongoDbPersistence:DeleteByIdsCount", fixture.TestDeleteByIdsCountOperations)
+	t.Run("DummyMongoDbPersistence:Export", fixture.TestExportOperations)
+	t.Run("DummyMongoDbPersistence:Import", fixture.TestImportOperations)
+	t.Run("DummyMongoDbPersistence:ReturnBefore", fixture.TestReturnBeforeOperations)
+	t.Run("DummyMongoDbPersistence:ClaimNext", fixture.TestClaimNextOperations)
+	t.Run("DummyMongoDbPersistence:CreateIfAbsent", fixture.TestCreateIfAbsentOperations)
+	t.Run("DummyMongoDbPersistence:Explain", fixture.TestExplainOperations)
+	t.Run("DummyMongoDbPersistence:CountWithLimit", fixture.TestCountWithLimitOperations)
+	t.Run("DummyMongoDbPersistence:ListWithLimit", fixture.TestListWithLimitOperations)
+	t.Run("DummyMongoDbPersistence:ReplaceByFilter", fixture.TestReplaceByFilterOperations)
+	t.Run("DummyMongoDbPersistence:UpsertPartially", fixture.TestUpsertPartiallyOperations)
+	t.Run("DummyMongoDbPersistence:DeleteCount", fixture.TestDeleteCountOperations)
+	t.Run("DummyMongoDbPersistence:CursorPaging", fixture.TestCursorPagingOperations)
+	t.Run("DummyMongoDbPersistence:PageEx", fixture.TestPageExOperations)
+	t.Run("DummyMongoDbPersistence:ComposeFilter", fixture.TestComposeFilterOperations)
+
+}
+
+func TestDummyMongoDbPersistenceOperationTimeout(t *testing.T) {
+	// Nobody listens on this port, so operations can only end by timeout
+	dbConfig := cconf.NewConfigParamsFromTuples(
+		"connection.host", "localhost",
+		"connection.port", "1",
+		"connection.database", "test",
+		"options.operation_timeout", "500",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
 	}
-	mongoPort := os.Getenv("MONGO_PORT")
-	if mongoPort == "" {
-		mongoPort = "27017"
+	defer persistence.Close("")
+
+	start := time.Now()
+	_, err := persistence.GetOneById("", "1")
+	assert.NotNil(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+func TestDummyMongoDbPersistenceContextCancel(t *testing.T) {
+	// Single item batches make the cursor go to the server for every next item
+	dbConfig := getTestConfig(t,
+		"options.batch_size", "1",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
 	}
-	mongoDatabase := os.Getenv("MONGO_DB")
-	if mongoDatabase == "" {
-		mongoDatabase = "test"
+	defer persistence.Close("")
+
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = persistence.Create("", Dummy{Key: "Key " + strconv.Itoa(i), Content: "Content"})
+		assert.Nil(t, err)
 	}
-	if mongoUri == "" && mongoHost == "" {
+
+	// Cancelled context stops a running operation
+	ctx, cancel := context.WithCancel(context.Background())
+	count := 0
+	err = persistence.StreamByFilterWithContext(ctx, "", bson.M{}, nil, nil, func(item interface{}) error {
+		count++
+		cancel()
+		return nil
+	})
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 1, count)
+
+	// Operations are not started within a cancelled context
+	_, err = persistence.CreateWithContext(ctx, "", Dummy{Key: "Key 5", Content: "Content"})
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	total, err := persistence.GetCountByFilter("", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), total)
+}
+
+func TestDummyMongoDbPersistenceSoftDelete(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"options.soft_delete", "true",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	fixture := *NewDummyPersistenceFixture(persistence)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
 		return
 	}
+	defer persistence.Close("")
 
-	dbConfig := cconf.NewConfigParamsFromTuples(
-		"connection.uri", mongoUri,
-		"connection.host", mongoHost,
-		"connection.port", mongoPort,
-		"connection.database", mongoDatabase,
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	t.Run("DummyMongoDbPersistence:SoftDelete", fixture.TestSoftDeleteOperations)
+	t.Run("DummyMongoDbPersistence:SoftDeleteUpdate", fixture.TestSoftDeleteUpdateOperations)
+}
+
+func TestDummyMongoDbPersistenceMaxPageSize(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"options.max_page_size", "2",
+		"options.estimate_total", "true",
 	)
 
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	_, err := persistence.CreateMany("", []Dummy{
+		{Key: "Key 1", Content: "Content 1"},
+		{Key: "Key 2", Content: "Content 2"},
+		{Key: "Key 3", Content: "Content 3"},
+	})
+	assert.Nil(t, err)
+
+	// Requested take is limited by max_page_size
+	page, err := persistence.GetPageByFilter("", nil, cdata.NewPagingParams(0, 100, false))
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+
+	// Total for the whole collection is estimated
+	dataPage, err := persistence.IdentifiableMongoDbPersistence.GetPageByFilter("", bson.M{}, cdata.NewPagingParams(0, 2, true), nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, dataPage.Data, 2)
+	assert.Equal(t, int64(3), *dataPage.Total)
+}
+
+func TestDummyMongoDbPersistenceBatchSize(t *testing.T) {
+	// Batch size is not set by default
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(cconf.NewEmptyConfigParams())
+	assert.Nil(t, persistence.NewFindOptions().BatchSize)
+
 	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(cconf.NewConfigParamsFromTuples(
+		"options.batch_size", "500",
+	))
+	options := persistence.NewFindOptions()
+	assert.NotNil(t, options.BatchSize)
+	assert.Equal(t, int32(500), *options.BatchSize)
+}
+
+func TestDummyMongoDbPersistenceCollation(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"options.collation_locale", "en",
+		"options.collation_strength", "2",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
 	persistence.Configure(dbConfig)
 
-	fixture = *NewDummyPersistenceFixture(persistence)
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	_, err := persistence.CreateMany("", []Dummy{
+		{Key: "alpha", Content: "Content 1"},
+		{Key: "Alpha", Content: "Content 2"},
+		{Key: "ALPHA", Content: "Content 3"},
+		{Key: "Beta", Content: "Content 4"},
+	})
+	assert.Nil(t, err)
+
+	// Configured collation is applied to all queries
+	items, err := persistence.IdentifiableMongoDbPersistence.GetListByFilter("", bson.M{"key": "alpha"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+
+	page, err := persistence.IdentifiableMongoDbPersistence.GetPageByFilter("", bson.M{"key": "ALPHA"}, cdata.NewPagingParams(0, 10, true), nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 3)
+	assert.Equal(t, int64(3), *page.Total)
+
+	// Binary comparison can be requested for a single query
+	opts := options.Find().SetCollation(&options.Collation{Locale: "simple"})
+	items, err = persistence.GetListByFilterWithOptions(context.Background(), "", bson.M{"key": "alpha"}, nil, nil, opts)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+}
+
+func TestDummyMongoDbPersistenceIndexes(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureIndex(bson.M{"key": 1}, options.Index().SetName("key_idx"))
+	persistence.EnsureTTLIndex("expire_time", time.Hour)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	// Ensured index exists
+	indexes, err := persistence.ListIndexes("")
+	assert.Nil(t, err)
+	assert.NotNil(t, findIndex(indexes, "key_idx"))
+
+	// TTL index contains expiration period
+	ttlIndex := findIndex(indexes, "expire_time_1")
+	assert.NotNil(t, ttlIndex)
+	assert.EqualValues(t, 3600, ttlIndex["expireAfterSeconds"])
+
+	// Drop the index
+	err = persistence.DropIndex("", "key_idx")
+	assert.Nil(t, err)
+
+	indexes, err = persistence.ListIndexes("")
+	assert.Nil(t, err)
+	assert.Nil(t, findIndex(indexes, "key_idx"))
+}
+
+func TestDummyMongoDbPersistenceTextSearch(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_text",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureTextIndex("key", "content")
+
+	fixture := NewDummyPersistenceFixture(persistence)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	// Clear drops the collection with the text index, so items are deleted instead
+	err := persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+
+	t.Run("DummyMongoDbPersistence:TextSearch", fixture.TestTextSearchOperations)
+
+	// Search without text index fails with a clear error
+	noIndexPersistence := NewDummyMongoDbPersistence()
+	noIndexPersistence.Configure(getTestConfig(t,
+		"collection", "dummies_no_text",
+	))
+	opnErr = noIndexPersistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer noIndexPersistence.Close("")
+
+	_, err = noIndexPersistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	_, err = noIndexPersistence.SearchByText("", "content", nil)
+	assert.NotNil(t, err)
+	var appErr *cerror.ApplicationError
+	ok := errors.As(err, &appErr)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, "NO_TEXT_INDEX", appErr.Code)
+	}
+}
+
+func TestDummyMongoDbPersistenceReconnect(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"options.reconnect_interval", "100",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
 
 	opnErr := persistence.Open("")
 	if opnErr != nil {
@@ -48,13 +380,1121 @@ func TestDummyMongoDbPersistence(t *testing.T) {
 	}
 	defer persistence.Close("")
 
+	reconnects := 0
+	persistence.Connection.AddReconnectListener(func(correlationId string) {
+		reconnects++
+	})
+
+	dummy, err := persistence.Create("", Dummy{Key: "Key Reconnect", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Simulate dropped connection
+	err = persistence.Client.Disconnect(context.Background())
+	assert.Nil(t, err)
+
+	// The failed operation triggers reconnection
+	_, err = persistence.GetOneById("", dummy.Id)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, reconnects)
+
+	// Next operations use the new connection
+	result, err := persistence.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, dummy.Id, result.Id)
+
+	_, err = persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+}
+
+func TestDummyMongoDbPersistenceIdTypes(t *testing.T) {
+	for _, idType := range []string{"string", "objectid", "uuid"} {
+		t.Run("DummyMongoDbPersistence:IdType:"+idType, func(t *testing.T) {
+			dbConfig := getTestConfig(t,
+				"collection", "dummies_ids",
+				"options.id_type", idType,
+			)
+
+			persistence := NewDummyMongoDbPersistence()
+			persistence.Configure(dbConfig)
+
+			opnErr := persistence.Open("")
+			if opnErr != nil {
+				t.Error("Error opened persistence", opnErr)
+				return
+			}
+			defer persistence.Close("")
+
+			opnErr = persistence.Clear("")
+			if opnErr != nil {
+				t.Error("Error cleaned persistence", opnErr.Error())
+				return
+			}
+
+			dummy, err := persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+			assert.Nil(t, err)
+			assert.NotEqual(t, "", dummy.Id)
+
+			// Check format and type of stored id
+			var doc bson.M
+			err = persistence.Collection.FindOne(context.Background(), bson.M{}).Decode(&doc)
+			assert.Nil(t, err)
+			switch idType {
+			case "objectid":
+				assert.Len(t, dummy.Id, 24)
+				objectId, ok := doc["_id"].(primitive.ObjectID)
+				assert.True(t, ok)
+				assert.Equal(t, dummy.Id, objectId.Hex())
+			case "uuid":
+				assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", dummy.Id)
+				assert.Equal(t, dummy.Id, doc["_id"])
+			default:
+				assert.Equal(t, dummy.Id, doc["_id"])
+			}
+
+			// Round-trip retrieval by public id
+			result, err := persistence.GetOneById("", dummy.Id)
+			assert.Nil(t, err)
+			assert.Equal(t, dummy.Id, result.Id)
+			assert.Equal(t, dummy.Content, result.Content)
+
+			items, err := persistence.GetListByIds("", []string{dummy.Id})
+			assert.Nil(t, err)
+			assert.Len(t, items, 1)
+
+			// Cursor pages accept and return public ids
+			dummy2, err := persistence.Create("", Dummy{Key: "Key 2", Content: "Content 2"})
+			assert.Nil(t, err)
+
+			cursorPage, err := persistence.GetPageByFilterWithCursor("", nil, nil, 1, nil)
+			assert.Nil(t, err)
+			assert.Len(t, cursorPage.Data, 1)
+			assert.IsType(t, "", cursorPage.LastId)
+
+			cursorPage, err = persistence.GetPageByFilterWithCursor("", nil, cursorPage.LastId, 1, nil)
+			assert.Nil(t, err)
+			assert.Len(t, cursorPage.Data, 1)
+			assert.Nil(t, cursorPage.LastId)
+
+			_, err = persistence.DeleteById("", dummy2.Id)
+			assert.Nil(t, err)
+
+			dummy.Content = "Content 2"
+			result, err = persistence.Update("", dummy)
+			assert.Nil(t, err)
+			assert.Equal(t, dummy.Id, result.Id)
+			assert.Equal(t, "Content 2", result.Content)
+
+			result, err = persistence.DeleteById("", dummy.Id)
+			assert.Nil(t, err)
+			assert.Equal(t, dummy.Id, result.Id)
+		})
+	}
+}
+
+func TestDummyMongoDbPersistenceCappedCollection(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_capped",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureCollection(options.CreateCollection().SetCapped(true).SetSizeInBytes(1024 * 1024))
+
+	// Drop the collection left from previous runs and open again to create it
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
 	opnErr = persistence.Clear("")
 	if opnErr != nil {
 		t.Error("Error cleaned persistence", opnErr.Error())
 		return
 	}
+	persistence.Close("")
 
-	t.Run("DummyMongoDbPersistence:CRUD", fixture.TestCrudOperations)
-	t.Run("DummyMongoDbPersistence:Batch", fixture.TestBatchOperations)
+	opnErr = persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	cursor, err := persistence.Db.ListCollections(context.Background(), bson.M{"name": "dummies_capped"})
+	assert.Nil(t, err)
+	var collections []bson.M
+	err = cursor.All(context.Background(), &collections)
+	assert.Nil(t, err)
+	assert.Len(t, collections, 1)
+	if len(collections) == 1 {
+		collOptions, _ := collections[0]["options"].(bson.M)
+		assert.Equal(t, true, collOptions["capped"])
+		assert.EqualValues(t, 1024*1024, collOptions["size"])
+	}
+
+	// Existing collection is not an error
+	persistence.Close("")
+	opnErr = persistence.Open("")
+	assert.Nil(t, opnErr)
+}
+
+func TestDummyMongoDbPersistenceRenameCollection(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_rename_old",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	// Closed persistence can't be renamed
+	err := persistence.RenameCollection("", "dummies_rename_new", true)
+	assert.NotNil(t, err)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr.Error())
+		return
+	}
+
+	dummy1, err := persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	dummy2, err := persistence.Create("", Dummy{Key: "Key 2", Content: "Content 2"})
+	assert.Nil(t, err)
+
+	err = persistence.RenameCollection("", "dummies_rename_new", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "dummies_rename_new", persistence.CollectionName)
+
+	// Data is accessible under the new name
+	items, err := persistence.GetListByIds("", []string{dummy1.Id, dummy2.Id})
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+
+	// Old collection doesn't exist anymore
+	names, err := persistence.Db.ListCollectionNames(context.Background(), bson.M{"name": "dummies_rename_old"})
+	assert.Nil(t, err)
+	assert.Len(t, names, 0)
+
+	err = persistence.Clear("")
+	assert.Nil(t, err)
+}
+
+func TestDummyMongoDbPersistenceSetCollection(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_tenant_1",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureIndex(bson.M{"key": 1}, options.Index().SetName("key_idx"))
+
+	// Closed persistence can't switch collections
+	err := persistence.SetCollection("", "dummies_tenant_2")
+	assert.NotNil(t, err)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err = persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+	dummy1, err := persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	err = persistence.SetCollection("", "dummies_tenant_2")
+	assert.Nil(t, err)
+	assert.Equal(t, "dummies_tenant_2", persistence.CollectionName)
+
+	err = persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+	dummy2, err := persistence.Create("", Dummy{Key: "Key 2", Content: "Content 2"})
+	assert.Nil(t, err)
+
+	// Operations target the new collection
+	items, err := persistence.GetListByIds("", []string{dummy1.Id, dummy2.Id})
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, dummy2.Id, items[0].Id)
+
+	// Indexes are created in the new collection
+	indexes, err := persistence.ListIndexes("")
+	assert.Nil(t, err)
+	assert.NotNil(t, findIndex(indexes, "key_idx"))
+
+	// Data of the first collection is still in place
+	err = persistence.SetCollection("", "dummies_tenant_1")
+	assert.Nil(t, err)
+	items, err = persistence.GetListByIds("", []string{dummy1.Id, dummy2.Id})
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, dummy1.Id, items[0].Id)
+
+	err = persistence.SetCollection("", "")
+	assert.NotNil(t, err)
+}
+
+func TestDummyMongoDbPersistenceAsyncIndexes(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_async_idx",
+		"options.index_build_async", "true",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureIndex(bson.D{{Key: "key", Value: 1}, {Key: "content", Value: 1}}, options.Index().SetName("async_idx"))
+
+	start := time.Now()
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	// Open doesn't wait for index creation
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.True(t, persistence.IsOpen())
+
+	// Index is created in background
+	var index bson.M
+	for i := 0; i < 50 && index == nil; i++ {
+		// Listing fails until the collection is created by the index build
+		indexes, _ := persistence.ListIndexes("")
+		index = findIndex(indexes, "async_idx")
+		if index == nil {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	assert.NotNil(t, index)
+}
+
+func TestDummyMongoDbPersistenceIndexErrors(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_idx_errors",
+	)
+
+	// Create index with the name used later
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+	_, err = persistence.Collection.Indexes().CreateOne(context.Background(),
+		mongo.IndexModel{Keys: bson.M{"key": 1}, Options: options.Index().SetName("conflict_idx")})
+	assert.Nil(t, err)
+	persistence.Close("")
+
+	// Conflicting index returns an error, but the component is opened
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureIndex(bson.M{"content": 1}, options.Index().SetName("conflict_idx"))
+	err = persistence.Open("")
+	assert.NotNil(t, err)
+	appErr, ok := err.(*cerror.ApplicationError)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, "CREATE_IDX_FAILED", appErr.Code)
+		assert.NotEqual(t, "", appErr.Cause)
+	}
+	assert.True(t, persistence.IsOpen())
+	assert.NotNil(t, persistence.Client)
+	assert.NotNil(t, persistence.Db)
+	_, err = persistence.GetCountByFilter("", nil)
+	assert.Nil(t, err)
+	err = persistence.Close("")
+	assert.Nil(t, err)
+	assert.False(t, persistence.Connection.IsOpen())
+
+	// Index errors can be ignored
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig.SetDefaults(cconf.NewConfigParamsFromTuples(
+		"options.ignore_index_errors", "true",
+	)))
+	persistence.EnsureIndex(bson.M{"content": 1}, options.Index().SetName("conflict_idx"))
+	err = persistence.Open("")
+	assert.Nil(t, err)
+	assert.True(t, persistence.IsOpen())
+	persistence.Close("")
+}
+
+func findIndex(indexes []bson.M, name string) bson.M {
+	for _, index := range indexes {
+		if index["name"] == name {
+			return index
+		}
+	}
+	return nil
+}
+
+func TestDummyMongoDbPersistenceUniqueIndex(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_unique",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureUniqueIndex(bson.M{"key": 1})
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+
+	_, err = persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Second item with the same key is rejected
+	_, err = persistence.Create("", Dummy{Key: "Key 1", Content: "Content 2"})
+	assert.NotNil(t, err)
+	var appErr *cerror.ApplicationError
+	ok := errors.As(err, &appErr)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, cerror.Conflict, appErr.Category)
+		assert.Equal(t, "DUPLICATE_KEY", appErr.Code)
+		assert.NotEqual(t, "", appErr.Cause)
+	}
+}
+
+func TestDummyMongoDbPersistencePartialIndex(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_partial",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsurePartialIndex(bson.M{"key": 1}, bson.M{"content": "Active"}, true)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+
+	_, err = persistence.Create("", Dummy{Key: "Key 1", Content: "Active"})
+	assert.Nil(t, err)
+
+	// Duplicates are allowed outside of the filter
+	_, err = persistence.Create("", Dummy{Key: "Key 1", Content: "Inactive"})
+	assert.Nil(t, err)
+	_, err = persistence.Create("", Dummy{Key: "Key 1", Content: "Inactive"})
+	assert.Nil(t, err)
+
+	// Duplicates are rejected inside of the filter
+	_, err = persistence.Create("", Dummy{Key: "Key 1", Content: "Active"})
+	assert.NotNil(t, err)
+	var appErr *cerror.ApplicationError
+	ok := errors.As(err, &appErr)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, "DUPLICATE_KEY", appErr.Code)
+	}
+
+	indexes, err := persistence.ListIndexes("")
+	assert.Nil(t, err)
+	index := findIndex(indexes, "key_1")
+	assert.NotNil(t, index)
+	assert.NotNil(t, index["partialFilterExpression"])
+}
+
+func TestDummyMongoDbPersistenceCounters(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	counters := ccount.NewLogCounters()
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.SetReferences(cref.NewReferencesFromTuples(
+		cref.NewDescriptor("pip-services", "counters", "log", "default", "1.0"), counters,
+	))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	dummy, err := persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	_, err = persistence.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	_, err = persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+
+	// Operations are counted and timed
+	names := make(map[string]int)
+	for _, counter := range counters.GetAll() {
+		names[counter.Name] = counter.Count
+	}
+	assert.Equal(t, 1, names["mongodb.dummies.create.exec_count"])
+	assert.Equal(t, 1, names["mongodb.dummies.get_one_by_id.exec_count"])
+	assert.Equal(t, 1, names["mongodb.dummies.delete_by_id.exec_count"])
+	assert.Contains(t, names, "mongodb.dummies.create.exec_time")
+}
+
+type mockTracer struct {
+	traces   []string
+	failures []string
+}
+
+func (c *mockTracer) Trace(correlationId string, component string, operation string, duration int64) {
+	c.traces = append(c.traces, component+"."+operation)
+}
+
+func (c *mockTracer) Failure(correlationId string, component string, operation string, err error, duration int64) {
+	c.failures = append(c.failures, component+"."+operation)
+}
+
+func (c *mockTracer) BeginTrace(correlationId string, component string, operation string) *ctrace.TraceTiming {
+	return ctrace.NewTraceTiming(correlationId, component, operation, c)
+}
+
+func TestDummyMongoDbPersistenceTracing(t *testing.T) {
+	dbConfig := getTestConfig(t)
+
+	tracer := &mockTracer{}
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.SetReferences(cref.NewReferencesFromTuples(
+		cref.NewDescriptor("pip-services", "tracer", "mock", "default", "1.0"), tracer,
+	))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	dummy, err := persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	_, err = persistence.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	_, err = persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+
+	// Every call produces a trace
+	assert.Equal(t, []string{
+		"mongodb.dummies.create",
+		"mongodb.dummies.get_one_by_id",
+		"mongodb.dummies.delete_by_id",
+	}, tracer.traces)
+
+	// Failed call is traced as failure
+	_, err = persistence.DeleteById("", dummy.Id)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"mongodb.dummies.delete_by_id"}, tracer.failures)
+}
+
+type mockLogger struct {
+	warnings []string
+	traces   []string
+}
+
+func (c *mockLogger) Level() int {
+	return 6
+}
+
+func (c *mockLogger) SetLevel(value int) {}
+
+func (c *mockLogger) Log(level int, correlationId string, err error, message string, args ...interface{}) {
+}
+
+func (c *mockLogger) Fatal(correlationId string, err error, message string, args ...interface{}) {}
+
+func (c *mockLogger) Error(correlationId string, err error, message string, args ...interface{}) {}
+
+func (c *mockLogger) Info(correlationId string, message string, args ...interface{}) {}
+
+func (c *mockLogger) Debug(correlationId string, message string, args ...interface{}) {}
+
+func (c *mockLogger) Warn(correlationId string, message string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(message, args...))
+}
+
+func (c *mockLogger) Trace(correlationId string, message string, args ...interface{}) {
+	c.traces = append(c.traces, fmt.Sprintf(message, args...))
+}
+
+func TestDummyMongoDbPersistenceSlowQueries(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"options.slow_query_threshold", "100",
+	)
+
+	logger := &mockLogger{}
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.SetReferences(cref.NewReferencesFromTuples(
+		cref.NewDescriptor("pip-services", "logger", "mock", "default", "1.0"), logger,
+	))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+	_, err = persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Fast query is traced
+	items, err := persistence.IdentifiableMongoDbPersistence.GetListByFilter("", bson.M{"key": "Key 1"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Len(t, logger.warnings, 0)
+	assert.Contains(t, logger.traces, "Retrieved 1 from dummies")
+
+	// Server side sleep makes the query exceed the threshold
+	items, err = persistence.IdentifiableMongoDbPersistence.GetListByFilter("",
+		bson.M{"$where": "sleep(200) || true"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Len(t, logger.warnings, 1)
+	if len(logger.warnings) > 0 {
+		assert.Contains(t, logger.warnings[0], "Slow query in dummies")
+		assert.Contains(t, logger.warnings[0], "sleep(200)")
+	}
+}
+
+func TestDummyMongoDbPersistenceMaxTime(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"options.max_time_ms", "100",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = persistence.Create("", Dummy{Key: "Key " + strconv.Itoa(i), Content: "Content"})
+		assert.Nil(t, err)
+	}
+
+	// Queries within the limit succeed
+	items, err := persistence.IdentifiableMongoDbPersistence.GetListByFilter("", bson.M{}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 5)
+
+	// Server side sleep for every item makes the query exceed the limit
+	slowFilter := bson.M{"$where": "sleep(50) || true"}
+
+	_, err = persistence.IdentifiableMongoDbPersistence.GetListByFilter("", slowFilter, nil, nil)
+	assert.NotNil(t, err)
+	var appErr *cerror.ApplicationError
+	ok := errors.As(err, &appErr)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, "QUERY_TIMEOUT", appErr.Code)
+	}
+
+	_, err = persistence.IdentifiableMongoDbPersistence.GetPageByFilter("", slowFilter, nil, nil, nil)
+	assert.NotNil(t, err)
+	ok = errors.As(err, &appErr)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, "QUERY_TIMEOUT", appErr.Code)
+	}
+}
+
+func TestDummyMongoDbPersistenceErrorWrapping(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"options.auto_reconnect", "false",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	dummy, err := persistence.Create("", Dummy{Key: "Key Error", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Application errors get correlation id
+	_, err = persistence.Create("123", dummy)
+	assert.NotNil(t, err)
+	var appErr *cerror.ApplicationError
+	ok := errors.As(err, &appErr)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, "DUPLICATE_KEY", appErr.Code)
+		assert.Equal(t, "123", appErr.CorrelationId)
+	}
+
+	// Driver error is kept for unwrapping
+	var writeErr mongo.WriteException
+	assert.True(t, errors.As(err, &writeErr))
+	assert.True(t, mongo.IsDuplicateKeyError(err))
+
+	// Force driver errors by closing the client
+	err = persistence.Client.Disconnect(context.Background())
+	assert.Nil(t, err)
+
+	_, err = persistence.GetOneById("123", dummy.Id)
+	assert.NotNil(t, err)
+	ok = errors.As(err, &appErr)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, "123", appErr.CorrelationId)
+		assert.Equal(t, "get_one_by_id", appErr.Details.GetAsString("operation"))
+		assert.Equal(t, "dummies", appErr.Details.GetAsString("collection"))
+		assert.Contains(t, appErr.Message, "dummies")
+		assert.NotEqual(t, "", appErr.Cause)
+	}
+	assert.NotNil(t, errors.Unwrap(err))
+}
+
+func TestDummyMongoDbPersistenceClearModes(t *testing.T) {
+	for _, mode := range []string{"delete", "drop"} {
+		dbConfig := getTestConfig(t,
+			"collection", "dummies_clear",
+			"options.clear_mode", mode,
+		)
+
+		persistence := NewDummyMongoDbPersistence()
+		persistence.Configure(dbConfig)
+		persistence.EnsureIndex(bson.M{"key": 1}, options.Index().SetName("key_idx"))
+
+		opnErr := persistence.Open("")
+		if opnErr != nil {
+			t.Error("Error opened persistence", opnErr)
+			return
+		}
+
+		_, err := persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+		assert.Nil(t, err)
+
+		err = persistence.Clear("")
+		assert.Nil(t, err)
+
+		count, err := persistence.GetCountByFilter("", nil)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), count)
+
+		indexes, err := persistence.ListIndexes("")
+		if mode == "delete" {
+			// Indexes survive deleting documents
+			assert.Nil(t, err)
+			assert.NotNil(t, findIndex(indexes, "key_idx"))
+		} else {
+			// Dropped collection has no indexes
+			assert.Nil(t, findIndex(indexes, "key_idx"))
+		}
+
+		// Clearing a missing collection succeeds
+		err = persistence.Clear("")
+		assert.Nil(t, err)
+
+		persistence.Close("")
+	}
+}
+
+func TestDummyMongoDbPersistenceHint(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_hint",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureIndex(bson.M{"key": 1}, options.Index().SetName("key_idx"))
+	persistence.EnsureIndex(bson.M{"content": 1}, options.Index().SetName("content_idx"))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+
+	_, err = persistence.Create("", Dummy{Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	filter := bson.M{"key": "Key 1", "content": "Content 1"}
+
+	// Hint by index name
+	items, err := persistence.GetListByFilterWithOptions(context.Background(), "", filter, nil, nil,
+		persist.WithHint("content_idx"))
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+
+	// Hint by index keys
+	page, err := persistence.GetPageByFilterWithOptions(context.Background(), "", filter,
+		cdata.NewPagingParams(nil, nil, true), nil, nil, persist.WithHint(persist.NewSortParams().Asc("key")))
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, int64(1), *page.Total)
+
+	// Hint of a missing index fails
+	_, err = persistence.GetListByFilterWithOptions(context.Background(), "", filter, nil, nil,
+		persist.WithHint("missing_idx"))
+	assert.NotNil(t, err)
+}
+
+func TestDummyMongoDbPersistenceWriteConcern(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_write_concern",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+
+	// Majority write concern is accepted by any deployment
+	ctx := persist.WithWriteConcern(context.Background(), writeconcern.New(writeconcern.WMajority()))
+	_, err = persistence.CreateWithContext(ctx, "", Dummy{Id: "wc_1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Write concern that can't be satisfied fails the operation
+	ctx = persist.WithWriteConcern(context.Background(),
+		writeconcern.New(writeconcern.W(50), writeconcern.WTimeout(100*time.Millisecond)))
+	_, err = persistence.UpdatePartiallyWithContext(ctx, "", "wc_1", cdata.NewAnyValueMapFromTuples("content", "Content 2"))
+	assert.NotNil(t, err)
+
+	// Operations without override use the connection write concern
+	_, err = persistence.DeleteByIdWithContext(context.Background(), "", "wc_1")
+	assert.Nil(t, err)
+}
+
+func TestDummyMongoDbPersistenceRetries(t *testing.T) {
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(cconf.NewConfigParamsFromTuples(
+		"options.operation_retries", "2",
+	))
+
+	transientErr := mongo.CommandError{Code: 91, Message: "connection reset", Labels: []string{"NetworkError"}}
+
+	// Flaky operation succeeds after retries
+	attempts := 0
+	err := persistence.RunWithRetries(context.Background(), "", func() error {
+		attempts++
+		if attempts < 3 {
+			return transientErr
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// Retries are limited
+	attempts = 0
+	err = persistence.RunWithRetries(context.Background(), "", func() error {
+		attempts++
+		return transientErr
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// Logical errors are not retried
+	attempts = 0
+	duplicateErr := mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key"}}}
+	err = persistence.RunWithRetries(context.Background(), "", func() error {
+		attempts++
+		return duplicateErr
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, attempts)
+
+	// Retries are disabled by default
+	persistence = NewDummyMongoDbPersistence()
+	persistence.Configure(cconf.NewEmptyConfigParams())
+	attempts = 0
+	err = persistence.RunWithRetries(context.Background(), "", func() error {
+		attempts++
+		return transientErr
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDummyMongoDbPersistenceRawPage(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_raw",
+	)
+
+	logger := &mockLogger{}
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.SetReferences(cref.NewReferencesFromTuples(
+		cref.NewDescriptor("pip-services", "logger", "mock", "default", "1.0"), logger,
+	))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+
+	_, err = persistence.Create("", Dummy{Id: "raw_1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	// Document with a number key does not match the prototype
+	_, err = persistence.Collection.InsertOne(context.Background(), bson.M{"_id": "raw_2", "key": 123, "content": "Content 2"})
+	assert.Nil(t, err)
+
+	// Raw page contains all documents
+	page, err := persistence.GetPageByFilterRaw("", bson.M{}, nil, bson.M{"_id": 1}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+	doc, ok := page.Data[1].(bson.M)
+	assert.True(t, ok)
+	assert.Equal(t, "raw_2", doc["_id"])
+
+	// Typed page skips mismatched document with a warning
+	page, err = persistence.GetPageByFilterWithContext(context.Background(), "", bson.M{}, nil, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	found := false
+	for _, warning := range logger.warnings {
+		if strings.Contains(warning, "raw_2") {
+			found = true
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestDummyMongoDbPersistenceStrictDecode(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_decode",
+	)
+
+	logger := &mockLogger{}
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.SetReferences(cref.NewReferencesFromTuples(
+		cref.NewDescriptor("pip-services", "logger", "mock", "default", "1.0"), logger,
+	))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.DeleteByFilter("", bson.M{})
+	assert.Nil(t, err)
+
+	_, err = persistence.Create("", Dummy{Id: "decode_1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	// Malformed document with a number key
+	_, err = persistence.Collection.InsertOne(context.Background(), bson.M{"_id": "decode_2", "key": 123, "content": "Content 2"})
+	assert.Nil(t, err)
+	_, err = persistence.Create("", Dummy{Id: "decode_3", Key: "Key 3", Content: "Content 3"})
+	assert.Nil(t, err)
+
+	// Lenient mode skips the document with a warning
+	items, err := persistence.GetListByFilterWithContext(context.Background(), "", bson.M{}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 2)
+	found := false
+	for _, warning := range logger.warnings {
+		if strings.Contains(warning, "decode_2") {
+			found = true
+		}
+	}
+	assert.True(t, found)
+
+	// Cursor paging continues after the skipped document
+	readIds := []string{}
+	var afterId interface{}
+	for pages := 0; pages < 5; pages++ {
+		page, err := persistence.GetPageByFilterWithCursor("", bson.M{}, afterId, 1, nil)
+		assert.Nil(t, err)
+		if err != nil {
+			break
+		}
+		for _, item := range page.Data {
+			readIds = append(readIds, item.(Dummy).Id)
+		}
+		if page.LastId == nil {
+			break
+		}
+		afterId = page.LastId
+	}
+	assert.Equal(t, []string{"decode_1", "decode_3"}, readIds)
+
+	// Strict mode aborts the query
+	persistence.Close("")
+	persistence.Configure(getTestConfig(t,
+		"collection", "dummies_decode",
+		"options.strict_decode", true,
+	))
+	opnErr = persistence.Open("")
+	assert.Nil(t, opnErr)
+
+	items, err = persistence.GetListByFilterWithContext(context.Background(), "", bson.M{}, nil, nil)
+	assert.NotNil(t, err)
+	assert.Nil(t, items)
+	appErr, ok := err.(*cerror.ApplicationError)
+	if assert.True(t, ok) {
+		assert.Equal(t, "DECODE_FAILED", appErr.Code)
+	}
+}
+
+func TestDummyMongoDbPersistenceValidation(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_validated",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	// Recreate the collection with a validator
+	ctx := context.Background()
+	err := persistence.Collection.Drop(ctx)
+	assert.Nil(t, err)
+	err = persistence.Db.CreateCollection(ctx, "dummies_validated", options.CreateCollection().SetValidator(bson.M{
+		"$jsonSchema": bson.M{
+			"bsonType": "object",
+			"required": bson.A{"key", "content"},
+			"properties": bson.M{
+				"content": bson.M{"bsonType": "string", "maxLength": 10},
+			},
+		},
+	}))
+	assert.Nil(t, err)
+
+	assertValidationError := func(err error) {
+		assert.NotNil(t, err)
+		var appErr *cerror.ApplicationError
+		ok := errors.As(err, &appErr)
+		if assert.True(t, ok) {
+			assert.Equal(t, "VALIDATION_FAILED", appErr.Code)
+			assert.Equal(t, cerror.BadRequest, appErr.Category)
+			assert.Equal(t, 400, appErr.Status)
+		}
+	}
+
+	dummy, err := persistence.Create("", Dummy{Id: "valid_1", Key: "Key 1", Content: "Short"})
+	assert.Nil(t, err)
+
+	// Create
+	_, err = persistence.Create("", Dummy{Id: "valid_2", Key: "Key 2", Content: "Content is too long"})
+	assertValidationError(err)
+	var writeErr mongo.WriteException
+	assert.True(t, errors.As(err, &writeErr))
+
+	// Update
+	_, err = persistence.Update("", Dummy{Id: dummy.Id, Key: dummy.Key, Content: "Content is too long"})
+	assertValidationError(err)
+
+	// Set
+	_, err = persistence.IdentifiableMongoDbPersistence.Set("", Dummy{Id: dummy.Id, Key: dummy.Key, Content: "Content is too long"})
+	assertValidationError(err)
+
+	// The stored item is unchanged
+	item, err := persistence.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Short", item.Content)
+
+	err = persistence.Collection.Drop(ctx)
+	assert.Nil(t, err)
+}
+
+func TestDummyMongoDbPersistenceCompoundIndex(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"collection", "dummies_compound",
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+	persistence.EnsureCompoundIndex([]persist.IndexField{
+		{Name: "content", Direction: 1},
+		{Name: "key", Direction: -1},
+	})
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	// Stored keys keep the order of fields
+	ctx := context.Background()
+	cursor, err := persistence.Collection.Indexes().List(ctx)
+	assert.Nil(t, err)
+	var indexes []struct {
+		Name string `bson:"name"`
+		Key  bson.D `bson:"key"`
+	}
+	err = cursor.All(ctx, &indexes)
+	assert.Nil(t, err)
+
+	found := false
+	for _, index := range indexes {
+		if index.Name == "content_1_key_-1" {
+			found = true
+			assert.Len(t, index.Key, 2)
+			assert.Equal(t, "content", index.Key[0].Key)
+			assert.EqualValues(t, 1, index.Key[0].Value)
+			assert.Equal(t, "key", index.Key[1].Key)
+			assert.EqualValues(t, -1, index.Key[1].Value)
+		}
+	}
+	assert.True(t, found)
 
+	err = persistence.Clear("")
+	assert.Nil(t, err)
 }
@@ -0,0 +1,75 @@
+package test_persistence
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDummyMongoDbTransaction(t *testing.T) {
+
+	// Transactions are supported only by replica sets
+	mongoReplicaSet := os.Getenv("MONGO_REPLICA_SET")
+	if mongoReplicaSet == "" {
+		t.Skip("MONGO_REPLICA_SET is not set")
+	}
+
+	dbConfig := getTestConfig(t,
+		"options.replica_set", mongoReplicaSet,
+	)
+
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(dbConfig)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	opnErr = persistence.Clear("")
+	if opnErr != nil {
+		t.Error("Error cleaned persistence", opnErr)
+		return
+	}
+
+	// Create the collection outside of transactions
+	dummy1, err := persistence.Create("", Dummy{Id: "", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Rollback on error
+	_, err = persistence.Connection.WithTransaction("", func(sessCtx mongo.SessionContext) (interface{}, error) {
+		_, err := persistence.CreateWithContext(sessCtx, "", Dummy{Id: "rollback", Key: "Key 2", Content: "Content 2"})
+		if err != nil {
+			return nil, err
+		}
+		_, err = persistence.DeleteByIdWithContext(sessCtx, "", dummy1.Id)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errors.New("rollback")
+	})
+	assert.NotNil(t, err)
+
+	dummy, err := persistence.GetOneById("", "rollback")
+	assert.Nil(t, err)
+	assert.Equal(t, "", dummy.Id)
+
+	dummy, err = persistence.GetOneById("", dummy1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, dummy1.Id, dummy.Id)
+
+	// Commit on success
+	_, err = persistence.Connection.WithTransaction("", func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return persistence.DeleteByIdWithContext(sessCtx, "", dummy1.Id)
+	})
+	assert.Nil(t, err)
+
+	dummy, err = persistence.GetOneById("", dummy1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "", dummy.Id)
+}
@@ -1,9 +1,20 @@
 package test_persistence
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
 	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type DummyPersistenceFixture struct {
@@ -109,6 +120,11 @@ func (c *DummyPersistenceFixture) TestCrudOperations(t *testing.T) {
 	// Try to get item, must be an empty Dummy struct
 	temp := Dummy{}
 	assert.Equal(t, temp, result)
+
+	// Delete the missing dummy
+	result, err = c.persistence.DeleteById("", dummy1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, temp, result)
 }
 
 func (c *DummyPersistenceFixture) TestBatchOperations(t *testing.T) {
@@ -147,7 +163,7 @@ func (c *DummyPersistenceFixture) TestBatchOperations(t *testing.T) {
 	assert.Len(t, items, 2)
 
 	// Delete batch
-	err = c.persistence.DeleteByIds("", []string{dummy1.Id, dummy2.Id})
+	_, err = c.persistence.DeleteByIds("", []string{dummy1.Id, dummy2.Id})
 	if err != nil {
 		t.Errorf("DeleteByIds method error %v", err)
 	}
@@ -162,3 +178,1023 @@ func (c *DummyPersistenceFixture) TestBatchOperations(t *testing.T) {
 	assert.Len(t, items, 0)
 
 }
+
+func (c *DummyPersistenceFixture) TestCreateManyOperations(t *testing.T) {
+	// Create empty batch
+	items, err := c.persistence.CreateMany("", []Dummy{})
+	assert.Nil(t, err)
+	assert.Len(t, items, 0)
+
+	// Create batch
+	items, err = c.persistence.CreateMany("", []Dummy{c.dummy1, c.dummy2})
+	if err != nil {
+		t.Errorf("CreateMany method error %v", err)
+	}
+	assert.Len(t, items, 2)
+	assert.NotEqual(t, "", items[0].Id)
+	assert.NotEqual(t, "", items[1].Id)
+	assert.Equal(t, c.dummy1.Key, items[0].Key)
+	assert.Equal(t, c.dummy2.Key, items[1].Key)
+
+	// Read batch
+	result, err := c.persistence.GetListByIds("", []string{items[0].Id, items[1].Id})
+	if err != nil {
+		t.Errorf("GetListByIds method error %v", err)
+	}
+	assert.Len(t, result, 2)
+
+	// Delete batch
+	_, err = c.persistence.DeleteByIds("", []string{items[0].Id, items[1].Id})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestBulkWriteOperations(t *testing.T) {
+	dummy1 := Dummy{Id: "bulk_1", Key: "Key 1", Content: "Content 1"}
+	dummy2 := Dummy{Id: "bulk_2", Key: "Key 2", Content: "Content 2"}
+
+	// Insert two dummies
+	result, err := c.persistence.BulkWrite("", []mongo.WriteModel{
+		mongo.NewInsertOneModel().SetDocument(dummy1),
+		mongo.NewInsertOneModel().SetDocument(dummy2),
+	}, true)
+	if err != nil {
+		t.Errorf("BulkWrite method error %v", err)
+	}
+	assert.Equal(t, int64(2), result.InsertedCount)
+
+	// Update one dummy and delete another
+	result, err = c.persistence.BulkWrite("", []mongo.WriteModel{
+		mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": dummy1.Id}).SetUpdate(bson.M{"$set": bson.M{"content": "Updated Content 1"}}),
+		mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": dummy2.Id}),
+	}, false)
+	if err != nil {
+		t.Errorf("BulkWrite method error %v", err)
+	}
+	assert.Equal(t, int64(1), result.ModifiedCount)
+	assert.Equal(t, int64(1), result.DeletedCount)
+
+	item, err := c.persistence.GetOneById("", dummy1.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Updated Content 1", item.Content)
+
+	_, err = c.persistence.DeleteByIds("", []string{dummy1.Id})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestAggregateOperations(t *testing.T) {
+	items, err := c.persistence.CreateMany("", []Dummy{
+		{Key: "Key 1", Content: "Content 1"},
+		{Key: "Key 1", Content: "Content 2"},
+		{Key: "Key 2", Content: "Content 3"},
+	})
+	if err != nil {
+		t.Errorf("CreateMany method error %v", err)
+	}
+
+	// Group dummies by key
+	result, err := c.persistence.Aggregate("", []bson.M{
+		{"$match": bson.M{"_id": bson.M{"$in": []string{items[0].Id, items[1].Id, items[2].Id}}}},
+		{"$group": bson.M{"_id": "$key", "count": bson.M{"$sum": 1}}},
+		{"$sort": bson.M{"_id": 1}},
+	}, nil)
+	if err != nil {
+		t.Errorf("Aggregate method error %v", err)
+	}
+	assert.Len(t, result, 2)
+
+	group1, ok := result[0].(bson.M)
+	assert.True(t, ok)
+	assert.Equal(t, "Key 1", group1["_id"])
+	assert.EqualValues(t, 2, group1["count"])
+
+	group2, ok := result[1].(bson.M)
+	assert.True(t, ok)
+	assert.Equal(t, "Key 2", group2["_id"])
+	assert.EqualValues(t, 1, group2["count"])
+
+	// Documents that match the prototype are decoded into it
+	result, err = c.persistence.Aggregate("", []bson.M{
+		{"$match": bson.M{"_id": items[2].Id}},
+	}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+	dummy, ok := result[0].(Dummy)
+	assert.True(t, ok)
+	assert.Equal(t, "Content 3", dummy.Content)
+
+	_, err = c.persistence.DeleteByIds("", []string{items[0].Id, items[1].Id, items[2].Id})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestDistinctOperations(t *testing.T) {
+	items, err := c.persistence.CreateMany("", []Dummy{
+		{Key: "Key 1", Content: "Content 1"},
+		{Key: "Key 1", Content: "Content 2"},
+		{Key: "Key 2", Content: "Content 3"},
+	})
+	if err != nil {
+		t.Errorf("CreateMany method error %v", err)
+	}
+	ids := []string{items[0].Id, items[1].Id, items[2].Id}
+
+	values, err := c.persistence.GetDistinct("", "key", bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		t.Errorf("GetDistinct method error %v", err)
+	}
+	assert.Len(t, values, 2)
+	assert.Contains(t, values, "Key 1")
+	assert.Contains(t, values, "Key 2")
+
+	count, err := c.persistence.GetDistinctCount("", "key", bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		t.Errorf("GetDistinctCount method error %v", err)
+	}
+	assert.Equal(t, (int64)(len(values)), count)
+
+	count, err = c.persistence.GetDistinctCount("", "key", bson.M{"_id": "unknown"})
+	assert.Nil(t, err)
+	assert.Equal(t, (int64)(0), count)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestGetOneByFilterOperations(t *testing.T) {
+	items, err := c.persistence.CreateMany("", []Dummy{
+		{Key: "Key 1", Content: "Content 1"},
+		{Key: "Key 1", Content: "Content 2"},
+	})
+	if err != nil {
+		t.Errorf("CreateMany method error %v", err)
+	}
+	ids := []string{items[0].Id, items[1].Id}
+
+	// Get the first item sorted by content
+	item, err := c.persistence.GetOneByFilter("", bson.M{"key": "Key 1"}, bson.M{"content": -1})
+	if err != nil {
+		t.Errorf("GetOneByFilter method error %v", err)
+	}
+	dummy, ok := item.(Dummy)
+	assert.True(t, ok)
+	assert.Equal(t, "Content 2", dummy.Content)
+
+	// Get missing item
+	item, err = c.persistence.GetOneByFilter("", bson.M{"key": "Missing Key"}, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, item)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestExistsOperations(t *testing.T) {
+	dummy, err := c.persistence.Create("", c.dummy1)
+	if err != nil {
+		t.Errorf("Create method error %v", err)
+	}
+
+	// Check present item
+	exists, err := c.persistence.Exists("", bson.M{"_id": dummy.Id})
+	assert.Nil(t, err)
+	assert.True(t, exists)
+
+	// Check absent item
+	exists, err = c.persistence.Exists("", bson.M{"_id": "missing_id"})
+	assert.Nil(t, err)
+	assert.False(t, exists)
+
+	_, err = c.persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestWatchChangesOperations(t *testing.T) {
+	events := make(chan bson.M, 10)
+	stop, err := c.persistence.WatchChanges("", func(changeEvent bson.M) error {
+		events <- changeEvent
+		return nil
+	})
+	assert.Nil(t, err)
+	defer stop()
+
+	dummy, err := c.persistence.Create("", c.dummy1)
+	assert.Nil(t, err)
+
+	// Wait for the insert event
+	select {
+	case event := <-events:
+		assert.Equal(t, "insert", event["operationType"])
+		fullDocument, ok := event["fullDocument"].(Dummy)
+		assert.True(t, ok)
+		assert.Equal(t, dummy.Id, fullDocument.Id)
+		assert.Equal(t, c.dummy1.Key, fullDocument.Key)
+	case <-time.After(10 * time.Second):
+		t.Error("Change event was not received")
+	}
+
+	_, err = c.persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestUpdateManyByFilterOperations(t *testing.T) {
+	dummy1 := Dummy{Id: "update_many_1", Key: "Key 5", Content: "Content 1"}
+	dummy2 := Dummy{Id: "update_many_2", Key: "Key 5", Content: "Content 2"}
+	dummy3 := Dummy{Id: "update_many_3", Key: "Key 6", Content: "Content 3"}
+	_, err := c.persistence.CreateMany("", []Dummy{dummy1, dummy2, dummy3})
+	assert.Nil(t, err)
+
+	// Empty update is not allowed
+	_, err = c.persistence.UpdateManyByFilter("", bson.M{"key": "Key 5"}, cdata.NewEmptyAnyValueMap())
+	assert.NotNil(t, err)
+
+	// Update matching items
+	count, err := c.persistence.UpdateManyByFilter("", bson.M{"key": "Key 5"},
+		cdata.NewAnyValueMapFromTuples("content", "Updated"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	items, err := c.persistence.GetListByIds("", []string{dummy1.Id, dummy2.Id, dummy3.Id})
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+	for _, item := range items {
+		if item.Key == "Key 5" {
+			assert.Equal(t, "Updated", item.Content)
+		} else {
+			assert.Equal(t, dummy3.Content, item.Content)
+		}
+	}
+
+	_, err = c.persistence.DeleteByIds("", []string{dummy1.Id, dummy2.Id, dummy3.Id})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestGetListByIdsOrderedOperations(t *testing.T) {
+	dummy1 := Dummy{Id: "ordered_1", Key: "Key 1", Content: "Content 1"}
+	dummy2 := Dummy{Id: "ordered_2", Key: "Key 2", Content: "Content 2"}
+	dummy3 := Dummy{Id: "ordered_3", Key: "Key 3", Content: "Content 3"}
+	_, err := c.persistence.CreateMany("", []Dummy{dummy1, dummy2, dummy3})
+	assert.Nil(t, err)
+
+	// Items are returned in the order of ids with nil for missing ones
+	items, err := c.persistence.GetListByIdsOrdered("", []string{dummy3.Id, "ordered_missing", dummy1.Id, dummy2.Id})
+	assert.Nil(t, err)
+	assert.Len(t, items, 4)
+	assert.NotNil(t, items[0])
+	assert.Equal(t, dummy3.Id, items[0].Id)
+	assert.Nil(t, items[1])
+	assert.NotNil(t, items[2])
+	assert.Equal(t, dummy1.Id, items[2].Id)
+	assert.NotNil(t, items[3])
+	assert.Equal(t, dummy2.Id, items[3].Id)
+
+	_, err = c.persistence.DeleteByIds("", []string{dummy1.Id, dummy2.Id, dummy3.Id})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestDeleteByIdsCountOperations(t *testing.T) {
+	dummy1 := Dummy{Id: "delete_ids_1", Key: "Key 1", Content: "Content 1"}
+	dummy2 := Dummy{Id: "delete_ids_2", Key: "Key 2", Content: "Content 2"}
+	_, err := c.persistence.CreateMany("", []Dummy{dummy1, dummy2})
+	assert.Nil(t, err)
+
+	// Only existing items are counted
+	count, err := c.persistence.DeleteByIds("", []string{dummy1.Id, "delete_ids_missing", dummy2.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = c.persistence.DeleteByIds("", []string{dummy1.Id, dummy2.Id})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+}
+
+func (c *DummyPersistenceFixture) TestExportOperations(t *testing.T) {
+	dummies := []Dummy{
+		{Id: "export_1", Key: "Export", Content: "Content 1"},
+		{Id: "export_2", Key: "Export", Content: "Content <2>"},
+		{Id: "export_3", Key: "Export", Content: "Content 3"},
+	}
+	_, err := c.persistence.CreateMany("", dummies)
+	assert.Nil(t, err)
+
+	var buffer bytes.Buffer
+	count, err := c.persistence.ExportToWriter("", bson.M{"key": "Export"}, &buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	// Every item is written as JSON on a separate line
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	assert.Len(t, lines, 3)
+	ids := make([]string, 0, len(lines))
+	for _, line := range lines {
+		var dummy Dummy
+		err = json.Unmarshal([]byte(line), &dummy)
+		assert.Nil(t, err)
+		assert.Equal(t, "Export", dummy.Key)
+		ids = append(ids, dummy.Id)
+	}
+	assert.ElementsMatch(t, []string{"export_1", "export_2", "export_3"}, ids)
+	assert.Contains(t, buffer.String(), "Content <2>")
+
+	// Nothing is exported for an empty result
+	buffer.Reset()
+	count, err = c.persistence.ExportToWriter("", bson.M{"key": "Export missing"}, &buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	assert.Equal(t, 0, buffer.Len())
+
+	_, err = c.persistence.DeleteByIds("", []string{"export_1", "export_2", "export_3"})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestImportOperations(t *testing.T) {
+	data := `{"id":"import_1","key":"Import","content":"Content 1"}
+{"id":"import_2","key":"Import","content":"Content 2"}
+{"id":"import_bad","key":
+{"id":"import_3","key":"Import","content":"Content 3"}
+
+`
+	// Malformed line is skipped, other items are inserted in batches
+	count, err := c.persistence.ImportFromReader("", strings.NewReader(data), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	items, err := c.persistence.GetListByIds("", []string{"import_1", "import_2", "import_3", "import_bad"})
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+
+	item, err := c.persistence.GetOneById("", "import_2")
+	assert.Nil(t, err)
+	assert.Equal(t, "Import", item.Key)
+	assert.Equal(t, "Content 2", item.Content)
+
+	// Exported items can be imported back
+	var buffer bytes.Buffer
+	_, err = c.persistence.ExportToWriter("", bson.M{"key": "Import"}, &buffer)
+	assert.Nil(t, err)
+	_, err = c.persistence.DeleteByIds("", []string{"import_1", "import_2", "import_3"})
+	assert.Nil(t, err)
+
+	count, err = c.persistence.ImportFromReader("", &buffer, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	// Items without id get generated ids
+	count, err = c.persistence.ImportFromReader("", strings.NewReader(`{"key":"Import New","content":"Content 4"}`), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	list, err := c.persistence.GetListByFilterWithLimit("", bson.M{"key": "Import New"}, nil, nil, 0)
+	assert.Nil(t, err)
+	assert.Len(t, list, 1)
+	assert.NotEqual(t, "", list[0].(Dummy).Id)
+
+	_, err = c.persistence.DeleteCountByFilter("", bson.M{"key": "Import New"})
+	assert.Nil(t, err)
+
+	// Import stops at a duplicate item and counts only inserted items
+	data = `{"id":"import_4","key":"Import","content":"Content 4"}
+{"id":"import_1","key":"Import","content":"Content 1"}
+{"id":"import_5","key":"Import","content":"Content 5"}
+`
+	count, err = c.persistence.ImportFromReader("", strings.NewReader(data), 0)
+	assert.NotNil(t, err)
+	assert.Equal(t, int64(1), count)
+
+	_, err = c.persistence.DeleteByIds("", []string{"import_1", "import_2", "import_3", "import_4"})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestGetOneByIdWithProjectionOperations(t *testing.T) {
+	dummy, err := c.persistence.Create("", Dummy{Id: "projection_1", Key: "Key Projection 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Only projected fields are populated
+	item, err := c.persistence.GetOneByIdWithProjection("", dummy.Id, bson.M{"key": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, dummy.Id, item.Id)
+	assert.Equal(t, dummy.Key, item.Key)
+	assert.Equal(t, "", item.Content)
+
+	item, err = c.persistence.GetOneByIdWithProjection("", dummy.Id, persist.NewProjectionParams().Include("content"))
+	assert.Nil(t, err)
+	assert.Equal(t, dummy.Id, item.Id)
+	assert.Equal(t, "", item.Key)
+	assert.Equal(t, dummy.Content, item.Content)
+
+	// Missing item is not found
+	item, err = c.persistence.GetOneByIdWithProjection("", "projection_missing", bson.M{"key": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "", item.Id)
+
+	_, err = c.persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestReturnBeforeOperations(t *testing.T) {
+	dummy, err := c.persistence.Create("", Dummy{Id: "before_1", Key: "Key Before 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Update returns old field values
+	item, err := c.persistence.UpdateReturnBefore("", Dummy{Id: dummy.Id, Key: dummy.Key, Content: "Content 2"})
+	assert.Nil(t, err)
+	assert.Equal(t, dummy.Id, item.Id)
+	assert.Equal(t, "Content 1", item.Content)
+
+	// Partial update returns old field values
+	item, err = c.persistence.UpdatePartiallyReturnBefore("", dummy.Id,
+		cdata.NewAnyValueMapFromTuples("content", "Content 3"))
+	assert.Nil(t, err)
+	assert.Equal(t, dummy.Id, item.Id)
+	assert.Equal(t, "Content 2", item.Content)
+
+	// The item is updated
+	item, err = c.persistence.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Content 3", item.Content)
+
+	// Missing items are not found without an error
+	item, err = c.persistence.UpdateReturnBefore("", Dummy{Id: "before_missing", Key: "Key Missing", Content: "Content"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", item.Id)
+
+	item, err = c.persistence.UpdatePartiallyReturnBefore("", "before_missing",
+		cdata.NewAnyValueMapFromTuples("content", "Content"))
+	assert.Nil(t, err)
+	assert.Equal(t, "", item.Id)
+
+	_, err = c.persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestCreateIfAbsentOperations(t *testing.T) {
+	// The first call creates the item
+	item, err := c.persistence.CreateIfAbsent("", Dummy{Id: "absent_1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "absent_1", item.Id)
+	assert.Equal(t, "Content 1", item.Content)
+
+	// The second call with the same id returns the stored item
+	item, err = c.persistence.CreateIfAbsent("", Dummy{Id: "absent_1", Key: "Key 2", Content: "Content 2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "absent_1", item.Id)
+	assert.Equal(t, "Key 1", item.Key)
+	assert.Equal(t, "Content 1", item.Content)
+
+	// The first write is intact
+	item, err = c.persistence.GetOneById("", "absent_1")
+	assert.Nil(t, err)
+	assert.Equal(t, "Key 1", item.Key)
+	assert.Equal(t, "Content 1", item.Content)
+
+	// Items without id get a generated one
+	item, err = c.persistence.CreateIfAbsent("", Dummy{Key: "Key 3", Content: "Content 3"})
+	assert.Nil(t, err)
+	assert.NotEqual(t, "", item.Id)
+
+	_, err = c.persistence.DeleteByIds("", []string{"absent_1", item.Id})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestPageExOperations(t *testing.T) {
+	items := make([]Dummy, 5)
+	ids := make([]string, len(items))
+	for i := range items {
+		ids[i] = fmt.Sprintf("page_ex_%d", i)
+		items[i] = Dummy{Id: ids[i], Key: "Key Page Ex", Content: fmt.Sprintf("Content %d", i)}
+	}
+	_, err := c.persistence.CreateMany("", items)
+	assert.Nil(t, err)
+
+	filter := bson.M{"key": "Key Page Ex"}
+	sort := bson.M{"_id": 1}
+
+	// With total
+	page, err := c.persistence.GetPageByFilterEx("", filter, cdata.NewPagingParams(0, 2, true), sort, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+	assert.Equal(t, int64(5), *page.Total)
+	assert.Equal(t, int64(0), page.Skip)
+	assert.Equal(t, int64(2), page.Take)
+	assert.Equal(t, int64(0), page.Page)
+	assert.True(t, page.HasMore)
+
+	page, err = c.persistence.GetPageByFilterEx("", filter, cdata.NewPagingParams(2, 2, true), sort, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+	assert.Equal(t, int64(1), page.Page)
+	assert.True(t, page.HasMore)
+
+	page, err = c.persistence.GetPageByFilterEx("", filter, cdata.NewPagingParams(4, 2, true), sort, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, int64(2), page.Page)
+	assert.False(t, page.HasMore)
+
+	// Without total
+	page, err = c.persistence.GetPageByFilterEx("", filter, cdata.NewPagingParams(3, 2, false), sort, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+	assert.Nil(t, page.Total)
+	assert.False(t, page.HasMore)
+
+	page, err = c.persistence.GetPageByFilterEx("", filter, cdata.NewPagingParams(2, 2, false), sort, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+	assert.True(t, page.HasMore)
+
+	page, err = c.persistence.GetPageByFilterEx("", filter, cdata.NewPagingParams(0, 5, false), sort, nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 5)
+	assert.False(t, page.HasMore)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestClaimNextOperations(t *testing.T) {
+	jobs := make([]Dummy, 20)
+	ids := make([]string, len(jobs))
+	for i := range jobs {
+		ids[i] = fmt.Sprintf("claim_%02d", i)
+		jobs[i] = Dummy{Id: ids[i], Key: ids[i], Content: "pending"}
+	}
+	_, err := c.persistence.CreateMany("", jobs)
+	assert.Nil(t, err)
+
+	// Competing workers claim jobs until the queue is empty
+	claimed := make(map[string]int)
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < 5; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for {
+				item, err := c.persistence.ClaimNext("",
+					bson.M{"key": bson.M{"$regex": "^claim_"}, "content": "pending"},
+					bson.M{"$set": bson.M{"content": fmt.Sprintf("processing by %d", worker)}},
+					bson.M{"key": 1})
+				assert.Nil(t, err)
+				if err != nil || item == nil {
+					return
+				}
+				lock.Lock()
+				claimed[item.(Dummy).Id]++
+				lock.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Every job is claimed exactly once
+	assert.Len(t, claimed, len(jobs))
+	for id, count := range claimed {
+		assert.Equal(t, 1, count, "Job %s is claimed %d times", id, count)
+	}
+
+	// Update without operators is rejected
+	_, err = c.persistence.ClaimNext("", bson.M{"content": "pending"}, bson.M{"content": "processing"}, nil)
+	assert.NotNil(t, err)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestExplainOperations(t *testing.T) {
+	// Query planner is the default verbosity
+	result, err := c.persistence.Explain("", bson.M{"key": "Key 1"}, "")
+	assert.Nil(t, err)
+	assert.NotNil(t, result["queryPlanner"])
+
+	result, err = c.persistence.Explain("", bson.M{"key": "Key 1"}, "executionStats")
+	assert.Nil(t, err)
+	assert.NotNil(t, result["queryPlanner"])
+	assert.NotNil(t, result["executionStats"])
+
+	// Unknown verbosity is rejected
+	_, err = c.persistence.Explain("", nil, "everything")
+	assert.NotNil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestCountWithLimitOperations(t *testing.T) {
+	items := make([]Dummy, 150)
+	ids := make([]string, len(items))
+	for i := range items {
+		ids[i] = fmt.Sprintf("count_%03d", i)
+		items[i] = Dummy{Id: ids[i], Key: "Key Count", Content: ids[i]}
+	}
+	_, err := c.persistence.CreateMany("", items)
+	assert.Nil(t, err)
+
+	// Count is capped by the limit
+	count, err := c.persistence.GetCountByFilterWithLimit("", bson.M{"key": "Key Count"}, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), count)
+
+	// Limit above the number of items
+	count, err = c.persistence.GetCountByFilterWithLimit("", bson.M{"key": "Key Count"}, 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(150), count)
+
+	// Zero limit counts all items
+	count, err = c.persistence.GetCountByFilterWithLimit("", bson.M{"key": "Key Count"}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(150), count)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestListWithLimitOperations(t *testing.T) {
+	items := make([]Dummy, 10)
+	ids := make([]string, len(items))
+	for i := range items {
+		ids[i] = fmt.Sprintf("list_%02d", i)
+		items[i] = Dummy{Id: ids[i], Key: "Key List", Content: ids[i]}
+	}
+	_, err := c.persistence.CreateMany("", items)
+	assert.Nil(t, err)
+
+	// List is capped by the limit
+	list, err := c.persistence.GetListByFilterWithLimit("", bson.M{"key": "Key List"}, bson.M{"_id": 1}, nil, 3)
+	assert.Nil(t, err)
+	assert.Len(t, list, 3)
+	assert.Equal(t, "list_00", list[0].(Dummy).Id)
+
+	// Limit above the number of items
+	list, err = c.persistence.GetListByFilterWithLimit("", bson.M{"key": "Key List"}, nil, nil, 100)
+	assert.Nil(t, err)
+	assert.Len(t, list, 10)
+
+	// Zero limit returns all items
+	list, err = c.persistence.GetListByFilterWithLimit("", bson.M{"key": "Key List"}, nil, nil, 0)
+	assert.Nil(t, err)
+	assert.Len(t, list, 10)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestReplaceByFilterOperations(t *testing.T) {
+	dummy, err := c.persistence.Create("", Dummy{Id: "replace_1", Key: "Key Replace 1", Content: "Content 1"})
+	assert.Nil(t, err)
+
+	// Replace an existing item
+	result, err := c.persistence.ReplaceByFilter("", bson.M{"key": dummy.Key},
+		Dummy{Id: dummy.Id, Key: dummy.Key, Content: "Replaced"}, false)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, dummy.Id, result.(Dummy).Id)
+	assert.Equal(t, "Replaced", result.(Dummy).Content)
+
+	// Missing item is not inserted without upsert
+	result, err = c.persistence.ReplaceByFilter("", bson.M{"key": "Key Replace 2"},
+		Dummy{Id: "replace_2", Key: "Key Replace 2", Content: "Content 2"}, false)
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+
+	// Missing item is inserted with upsert
+	result, err = c.persistence.ReplaceByFilter("", bson.M{"key": "Key Replace 2"},
+		Dummy{Id: "replace_2", Key: "Key Replace 2", Content: "Content 2"}, true)
+	assert.Nil(t, err)
+	assert.NotNil(t, result)
+	assert.Equal(t, "replace_2", result.(Dummy).Id)
+
+	item, err := c.persistence.GetOneById("", "replace_2")
+	assert.Nil(t, err)
+	assert.Equal(t, "Content 2", item.Content)
+
+	_, err = c.persistence.DeleteByIds("", []string{"replace_1", "replace_2"})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestUpsertPartiallyOperations(t *testing.T) {
+	// Missing item is created with a given id
+	item, err := c.persistence.UpsertPartially("", "upsert_1",
+		cdata.NewAnyValueMapFromTuples("key", "Key Upsert", "content", "Content 1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "upsert_1", item.Id)
+	assert.Equal(t, "Key Upsert", item.Key)
+	assert.Equal(t, "Content 1", item.Content)
+
+	// Existing item is updated partially
+	item, err = c.persistence.UpsertPartially("", "upsert_1",
+		cdata.NewAnyValueMapFromTuples("content", "Content 2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "upsert_1", item.Id)
+	assert.Equal(t, "Key Upsert", item.Key)
+	assert.Equal(t, "Content 2", item.Content)
+
+	_, err = c.persistence.DeleteById("", "upsert_1")
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestDeleteCountOperations(t *testing.T) {
+	_, err := c.persistence.CreateMany("", []Dummy{
+		{Id: "delete_count_1", Key: "Key Delete", Content: "Content 1"},
+		{Id: "delete_count_2", Key: "Key Delete", Content: "Content 2"},
+		{Id: "delete_count_3", Key: "Key Delete", Content: "Content 3"},
+		{Id: "delete_count_4", Key: "Key Keep", Content: "Content 4"},
+	})
+	assert.Nil(t, err)
+
+	count, err := c.persistence.DeleteCountByFilter("", bson.M{"key": "Key Delete"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), count)
+
+	// Nothing matches the second time
+	count, err = c.persistence.DeleteCountByFilter("", bson.M{"key": "Key Delete"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	count, err = c.persistence.DeleteCountByFilter("", bson.M{"key": "Key Keep"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func (c *DummyPersistenceFixture) TestCursorPagingOperations(t *testing.T) {
+	dummies := make([]Dummy, 25)
+	ids := make([]string, len(dummies))
+	for i := range dummies {
+		ids[i] = fmt.Sprintf("keyset_%02d", i)
+		dummies[i] = Dummy{Id: ids[i], Key: "Key Keyset", Content: fmt.Sprintf("Content %d", i)}
+	}
+	_, err := c.persistence.CreateMany("", dummies)
+	assert.Nil(t, err)
+
+	// Read all items page by page using continuation token
+	filter := bson.M{"key": "Key Keyset"}
+	pageSizes := []int{}
+	readIds := []string{}
+	var afterId interface{}
+	for {
+		page, err := c.persistence.GetPageByFilterWithCursor("", filter, afterId, 10, nil)
+		assert.Nil(t, err)
+		if err != nil {
+			break
+		}
+		pageSizes = append(pageSizes, len(page.Data))
+		for _, item := range page.Data {
+			readIds = append(readIds, item.(Dummy).Id)
+		}
+		if page.LastId == nil {
+			break
+		}
+		afterId = page.LastId
+	}
+	assert.Equal(t, []int{10, 10, 5}, pageSizes)
+	assert.Equal(t, ids, readIds)
+
+	// Explicit sort by _id is accepted, other orders are rejected
+	page, err := c.persistence.GetPageByFilterWithCursor("", filter, nil, 10, bson.D{{"_id", 1}})
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 10)
+
+	_, err = c.persistence.GetPageByFilterWithCursor("", filter, nil, 10, bson.D{{"_id", -1}})
+	assert.NotNil(t, err)
+
+	_, err = c.persistence.GetPageByFilterWithCursor("", filter, nil, 10, persist.NewSortParams().Asc("key"))
+	assert.NotNil(t, err)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestTextSearchOperations(t *testing.T) {
+	_, err := c.persistence.CreateMany("", []Dummy{
+		{Id: "text_1", Key: "Key 1", Content: "Red apple and green pear"},
+		{Id: "text_2", Key: "Key 2", Content: "Green apple"},
+		{Id: "text_3", Key: "Key 3", Content: "Yellow banana"},
+	})
+	assert.Nil(t, err)
+
+	// Items are found by words and sorted by relevance
+	page, err := c.persistence.SearchByText("", "green apple", cdata.NewPagingParams(0, 10, true))
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+	assert.Equal(t, int64(2), *page.Total)
+	assert.Equal(t, "text_2", page.Data[0].(Dummy).Id)
+
+	page, err = c.persistence.SearchByText("", "banana", nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 1)
+	assert.Equal(t, "text_3", page.Data[0].(Dummy).Id)
+
+	page, err = c.persistence.SearchByText("", "cherry", nil)
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 0)
+
+	_, err = c.persistence.DeleteByIds("", []string{"text_1", "text_2", "text_3"})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestComposeFilterOperations(t *testing.T) {
+	items, err := c.persistence.CreateMany("", []Dummy{
+		{Id: "compose_1", Key: "Key Compose", Content: "Content 1"},
+		{Id: "compose_2", Key: "Key Compose", Content: "Content 2"},
+		{Id: "compose_3", Key: "Key Other", Content: "Content 3"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, items, 3)
+
+	// The same filter is applied to pages and counts
+	filter := cdata.NewFilterParamsFromTuples("Key", "Key Compose")
+	page, err := c.persistence.GetPageByFilter("", filter, cdata.NewEmptyPagingParams())
+	assert.Nil(t, err)
+	assert.Len(t, page.Data, 2)
+	for _, item := range page.Data {
+		assert.Equal(t, "Key Compose", item.Key)
+	}
+
+	count, err := c.persistence.GetCountByFilter("", filter)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(page.Data)), count)
+
+	_, err = c.persistence.DeleteByIds("", []string{"compose_1", "compose_2", "compose_3"})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestSoftDeleteOperations(t *testing.T) {
+	dummy, err := c.persistence.Create("", c.dummy1)
+	assert.Nil(t, err)
+
+	// Soft delete the item
+	_, err = c.persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+
+	// Deleted item is hidden from queries
+	result, err := c.persistence.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "", result.Id)
+
+	page, err := c.persistence.GetPageByFilter("", cdata.NewEmptyFilterParams(), cdata.NewEmptyPagingParams())
+	assert.Nil(t, err)
+	for _, item := range page.Data {
+		assert.NotEqual(t, dummy.Id, item.Id)
+	}
+
+	count, err := c.persistence.GetCountByFilter("", cdata.NewFilterParamsFromTuples("Key", dummy.Key))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	// Deleted item is recoverable
+	items, err := c.persistence.GetDeleted("", bson.M{"_id": dummy.Id}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, dummy.Id, items[0].(Dummy).Id)
+
+	// Purge the item
+	err = c.persistence.Purge("", bson.M{"_id": dummy.Id})
+	assert.Nil(t, err)
+
+	items, err = c.persistence.GetDeleted("", bson.M{"_id": dummy.Id}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 0)
+}
+
+func (c *DummyPersistenceFixture) TestSoftDeleteUpdateOperations(t *testing.T) {
+	dummy, err := c.persistence.Create("", Dummy{Id: "soft_update_1", Key: "Key 1", Content: "Content 1"})
+	assert.Nil(t, err)
+	_, err = c.persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+
+	// Deleted item is not updated
+	result, err := c.persistence.Update("", Dummy{Id: dummy.Id, Key: "Key 2", Content: "Content 2"})
+	assert.Nil(t, err)
+	assert.Equal(t, "", result.Id)
+
+	result, err = c.persistence.UpdatePartially("", dummy.Id, cdata.NewAnyValueMapFromTuples("content", "Content 2"))
+	assert.Nil(t, err)
+	assert.Equal(t, "", result.Id)
+
+	replaced, err := c.persistence.ReplaceById("", Dummy{Id: dummy.Id, Key: "Key 2", Content: "Content 2"})
+	assert.Nil(t, err)
+	assert.Nil(t, replaced)
+
+	count, err := c.persistence.UpdateManyByFilter("", bson.M{"_id": dummy.Id}, cdata.NewAnyValueMapFromTuples("content", "Content 2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+
+	items, err := c.persistence.GetDeleted("", bson.M{"_id": dummy.Id}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "Content 1", items[0].(Dummy).Content)
+
+	// Upserts revive the deleted item in place
+	result, err = c.persistence.UpsertPartially("", dummy.Id, cdata.NewAnyValueMapFromTuples("content", "Content 3"))
+	assert.Nil(t, err)
+	assert.Equal(t, dummy.Id, result.Id)
+	assert.Equal(t, "Key 1", result.Key)
+	assert.Equal(t, "Content 3", result.Content)
+
+	items, err = c.persistence.GetDeleted("", bson.M{"_id": dummy.Id}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 0)
+
+	_, err = c.persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+
+	result, err = c.persistence.CreateIfAbsent("", Dummy{Id: dummy.Id, Key: "Key 4", Content: "Content 4"})
+	assert.Nil(t, err)
+	assert.Equal(t, dummy.Id, result.Id)
+	assert.Equal(t, "Content 4", result.Content)
+
+	result, err = c.persistence.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Key 4", result.Key)
+
+	_, err = c.persistence.DeleteById("", dummy.Id)
+	assert.Nil(t, err)
+
+	set, err := c.persistence.Set("", Dummy{Id: dummy.Id, Key: "Key 5", Content: "Content 5"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Content 5", set.(Dummy).Content)
+
+	result, err = c.persistence.GetOneById("", dummy.Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "Content 5", result.Content)
+
+	items, err = c.persistence.GetDeleted("", bson.M{"_id": dummy.Id}, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 0)
+
+	err = c.persistence.Purge("", bson.M{"_id": dummy.Id})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestEstimatedCountOperations(t *testing.T) {
+	items, err := c.persistence.CreateMany("", []Dummy{c.dummy1, c.dummy2})
+	assert.Nil(t, err)
+
+	count, err := c.persistence.GetCountByFilter("", nil)
+	assert.Nil(t, err)
+
+	estimated, err := c.persistence.GetEstimatedCount("")
+	assert.Nil(t, err)
+	assert.Equal(t, count, estimated)
+
+	_, err = c.persistence.DeleteByIds("", []string{items[0].Id, items[1].Id})
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestStreamByFilterOperations(t *testing.T) {
+	dummies := make([]Dummy, 200)
+	ids := make([]string, len(dummies))
+	for i := range dummies {
+		dummies[i] = Dummy{Id: fmt.Sprintf("stream_%d", i), Key: "Stream", Content: fmt.Sprintf("Content %d", i)}
+		ids[i] = dummies[i].Id
+	}
+	_, err := c.persistence.CreateMany("", dummies)
+	assert.Nil(t, err)
+
+	// Count all streamed items
+	count := 0
+	err = c.persistence.StreamByFilter("", bson.M{"key": "Stream"}, nil, nil, func(item interface{}) error {
+		_, ok := item.(Dummy)
+		assert.True(t, ok)
+		count++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, len(dummies), count)
+
+	// Stop streaming on error
+	count = 0
+	stopErr := errors.New("stop")
+	err = c.persistence.StreamByFilter("", bson.M{"key": "Stream"}, nil, nil, func(item interface{}) error {
+		count++
+		if count == 10 {
+			return stopErr
+		}
+		return nil
+	})
+	assert.Equal(t, stopErr, err)
+	assert.Equal(t, 10, count)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
+
+func (c *DummyPersistenceFixture) TestIterateByFilterOperations(t *testing.T) {
+	dummies := make([]Dummy, 50)
+	ids := make([]string, len(dummies))
+	for i := range dummies {
+		dummies[i] = Dummy{Id: fmt.Sprintf("iterate_%d", i), Key: "Iterate", Content: fmt.Sprintf("Content %d", i)}
+		ids[i] = dummies[i].Id
+	}
+	_, err := c.persistence.CreateMany("", dummies)
+	assert.Nil(t, err)
+
+	// Consume all items from the channel
+	items, errs := c.persistence.IterateByFilter("", bson.M{"key": "Iterate"}, bson.M{"_id": 1})
+	count := 0
+	for item := range items {
+		_, ok := item.(Dummy)
+		assert.True(t, ok)
+		count++
+	}
+	assert.Nil(t, <-errs)
+	assert.Equal(t, len(dummies), count)
+
+	_, err = c.persistence.DeleteByIds("", ids)
+	assert.Nil(t, err)
+}
@@ -17,9 +17,7 @@ type DummyRefMongoDbPersistence struct {
 func NewDummyRefMongoDbPersistence() *DummyRefMongoDbPersistence {
 	proto := reflect.TypeOf(&Dummy{})
 
-	c := &DummyRefMongoDbPersistence{}
-	c.IdentifiableMongoDbPersistence = *persist.InheritIdentifiableMongoDbPersistence(c, proto, "dummies")
-	return c
+	return &DummyRefMongoDbPersistence{*persist.NewIdentifiableMongoDbPersistence(proto, "dummies")}
 }
 
 func (c *DummyRefMongoDbPersistence) Create(correlationId string, item *Dummy) (result *Dummy, err error) {
@@ -83,7 +81,7 @@ func (c *DummyRefMongoDbPersistence) DeleteById(correlationId string, id string)
 	return item, err
 }
 
-func (c *DummyRefMongoDbPersistence) DeleteByIds(correlationId string, ids []string) (err error) {
+func (c *DummyRefMongoDbPersistence) DeleteByIds(correlationId string, ids []string) (count int64, err error) {
 	convIds := make([]interface{}, len(ids))
 	for i, v := range ids {
 		convIds[i] = v
@@ -1,10 +1,7 @@
 package test_persistence
 
 import (
-	"os"
 	"testing"
-
-	cconf "github.com/pip-services3-go/pip-services3-commons-go/config"
 )
 
 func TestDummyRefMongoDbPersistence(t *testing.T) {
@@ -12,29 +9,7 @@ func TestDummyRefMongoDbPersistence(t *testing.T) {
 	var persistence *DummyRefMongoDbPersistence
 	var fixture DummyRefPersistenceFixture
 
-	mongoUri := os.Getenv("MONGO_URI")
-	mongoHost := os.Getenv("MONGO_HOST")
-	if mongoHost == "" {
-		mongoHost = "localhost"
-	}
-	mongoPort := os.Getenv("MONGO_PORT")
-	if mongoPort == "" {
-		mongoPort = "27017"
-	}
-	mongoDatabase := os.Getenv("MONGO_DB")
-	if mongoDatabase == "" {
-		mongoDatabase = "test"
-	}
-	if mongoUri == "" && mongoHost == "" {
-		return
-	}
-
-	dbConfig := cconf.NewConfigParamsFromTuples(
-		"connection.uri", mongoUri,
-		"connection.host", mongoHost,
-		"connection.port", mongoPort,
-		"connection.database", mongoDatabase,
-	)
+	dbConfig := getTestConfig(t)
 
 	persistence = NewDummyRefMongoDbPersistence()
 	persistence.Configure(dbConfig)
@@ -146,7 +146,7 @@ func (c *DummyRefPersistenceFixture) TestBatchOperations(t *testing.T) {
 	assert.Len(t, items, 2)
 
 	// Delete batch
-	err = c.persistence.DeleteByIds("", []string{dummy1.Id, dummy2.Id})
+	_, err = c.persistence.DeleteByIds("", []string{dummy1.Id, dummy2.Id})
 	if err != nil {
 		t.Errorf("DeleteByIds method error %v", err)
 	}
@@ -0,0 +1,125 @@
+package test_persistence
+
+import (
+	"context"
+	"testing"
+
+	cconv "github.com/pip-services3-go/pip-services3-commons-go/convert"
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFilterParamsToBson(t *testing.T) {
+	mapping := map[string]persist.FilterFieldSpec{
+		"id":     {Field: "_id"},
+		"name":   {Operator: persist.FilterLike},
+		"code":   {Operator: persist.FilterRegex},
+		"age":    {Operator: persist.FilterRange, Type: cconv.Integer},
+		"status": {Operator: persist.FilterIn},
+		"level":  {Operator: persist.FilterIn, Type: cconv.Integer},
+	}
+
+	// Empty filter matches all items
+	assert.Equal(t, bson.M{}, persist.FilterParamsToBson(nil, mapping))
+	assert.Equal(t, bson.M{}, persist.FilterParamsToBson(cdata.NewEmptyFilterParams(), mapping))
+	assert.Equal(t, bson.M{}, persist.FilterParamsToBson(
+		cdata.NewFilterParamsFromTuples("id", "", "unknown", "1"), mapping))
+
+	// Equality
+	filter := persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("id", "1"), mapping)
+	assert.Equal(t, bson.M{"_id": "1"}, filter)
+
+	// Like escapes special characters and ignores case
+	filter = persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("name", "a.b"), mapping)
+	assert.Equal(t, bson.M{"name": bson.M{"$regex": "a\\.b", "$options": "i"}}, filter)
+
+	// Regex is used as is
+	filter = persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("code", "^A[0-9]+$"), mapping)
+	assert.Equal(t, bson.M{"code": bson.M{"$regex": "^A[0-9]+$"}}, filter)
+
+	// Range with converted bounds
+	filter = persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("age_min", "18", "age_max", "65"), mapping)
+	assert.Equal(t, bson.M{"age": bson.M{"$gte": 18, "$lte": 65}}, filter)
+	filter = persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("age_min", "18"), mapping)
+	assert.Equal(t, bson.M{"age": bson.M{"$gte": 18}}, filter)
+
+	// Lists
+	filter = persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("status", "new,active"), mapping)
+	assert.Equal(t, bson.M{"status": bson.M{"$in": bson.A{"new", "active"}}}, filter)
+	filter = persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("level", "1,2"), mapping)
+	assert.Equal(t, bson.M{"level": bson.M{"$in": bson.A{1, 2}}}, filter)
+
+	// Several keys are combined
+	filter = persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("id", "1", "status", "new"), mapping)
+	assert.Equal(t, bson.M{"_id": "1", "status": bson.M{"$in": bson.A{"new"}}}, filter)
+}
+
+func TestFilterParamsToBsonSameField(t *testing.T) {
+	mapping := map[string]persist.FilterFieldSpec{
+		"name":   {Operator: persist.FilterEq},
+		"search": {Field: "name", Operator: persist.FilterLike},
+	}
+
+	filter := persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("name", "abc", "search", "b"), mapping)
+	assert.Equal(t, bson.M{
+		"name": "abc",
+		"$and": bson.A{bson.M{"name": bson.M{"$regex": "b", "$options": "i"}}},
+	}, filter)
+}
+
+func TestLikeFilter(t *testing.T) {
+	assert.Equal(t, bson.M{"name": bson.M{"$regex": "abc", "$options": "i"}},
+		persist.LikeFilter("name", "abc", true))
+	assert.Equal(t, bson.M{"name": bson.M{"$regex": "abc"}},
+		persist.LikeFilter("name", "abc", false))
+
+	// Metacharacters are escaped
+	assert.Equal(t, bson.M{"name": bson.M{"$regex": "a\\.b\\*\\(c\\)"}},
+		persist.LikeFilter("name", "a.b*(c)", false))
+
+	// Filter mapping can match with case
+	mapping := map[string]persist.FilterFieldSpec{
+		"name": {Operator: persist.FilterLike, CaseSensitive: true},
+	}
+	filter := persist.FilterParamsToBson(cdata.NewFilterParamsFromTuples("name", "A.b"), mapping)
+	assert.Equal(t, persist.LikeFilter("name", "A.b", false), filter)
+}
+
+func TestLikeFilterQueries(t *testing.T) {
+	persistence := NewDummyMongoDbPersistence()
+	persistence.Configure(getTestConfig(t,
+		"collection", "dummies_like",
+	))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+
+	_, err = persistence.CreateMany("", []Dummy{
+		{Id: "like_1", Key: "Key A.B", Content: "Content 1"},
+		{Id: "like_2", Key: "Key axb", Content: "Content 2"},
+		{Id: "like_3", Key: "key a.b", Content: "Content 3"},
+	})
+	assert.Nil(t, err)
+
+	count := func(filter bson.M) int64 {
+		result, err := persistence.Collection.CountDocuments(context.Background(), filter)
+		assert.Nil(t, err)
+		return result
+	}
+
+	// Dot is not a wildcard
+	assert.Equal(t, int64(2), count(persist.LikeFilter("key", "a.b", true)))
+	assert.Equal(t, int64(1), count(persist.LikeFilter("key", "a.b", false)))
+	assert.Equal(t, int64(1), count(persist.LikeFilter("key", "A.B", false)))
+	assert.Equal(t, int64(3), count(persist.LikeFilter("key", "KEY", true)))
+	assert.Equal(t, int64(0), count(persist.LikeFilter("key", "a*", true)))
+}
@@ -0,0 +1,82 @@
+package test_persistence
+
+import (
+	"testing"
+
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGenericMongoDbPersistence(t *testing.T) {
+	persistence := persist.NewGenericMongoDbPersistence("generic_docs")
+	persistence.Configure(getTestConfig(t))
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	err := persistence.Clear("")
+	assert.Nil(t, err)
+
+	// Create documents of different shapes
+	result, err := persistence.Create("", bson.M{"type": "login", "user": "user1"})
+	assert.Nil(t, err)
+	doc1, ok := result.(map[string]interface{})
+	assert.True(t, ok)
+	assert.NotEmpty(t, doc1["Id"])
+	assert.Nil(t, doc1["_id"])
+	assert.Equal(t, "login", doc1["type"])
+
+	result, err = persistence.Create("", map[string]interface{}{
+		"Id":   "doc_2",
+		"type": "order",
+		"tags": bson.A{"a", "b"},
+	})
+	assert.Nil(t, err)
+	doc2 := result.(map[string]interface{})
+	assert.Equal(t, "doc_2", doc2["Id"])
+
+	// Get documents
+	result, err = persistence.GetOneById("", doc1["Id"])
+	assert.Nil(t, err)
+	item, ok := result.(map[string]interface{})
+	assert.True(t, ok)
+	assert.Equal(t, doc1["Id"], item["Id"])
+	assert.Equal(t, "user1", item["user"])
+
+	items, err := persistence.GetListByFilter("", bson.M{"type": "order"}, nil, nil)
+	assert.Nil(t, err)
+	assert.Len(t, items, 1)
+	assert.Equal(t, "doc_2", items[0].(map[string]interface{})["Id"])
+
+	// Update documents
+	result, err = persistence.Update("", bson.M{"Id": "doc_2", "type": "order", "status": "paid"})
+	assert.Nil(t, err)
+	item = result.(map[string]interface{})
+	assert.Equal(t, "doc_2", item["Id"])
+	assert.Equal(t, "paid", item["status"])
+	assert.Nil(t, item["tags"])
+
+	result, err = persistence.UpdatePartially("", "doc_2", cdata.NewAnyValueMapFromTuples("status", "shipped"))
+	assert.Nil(t, err)
+	item = result.(map[string]interface{})
+	assert.Equal(t, "shipped", item["status"])
+
+	// Delete documents
+	result, err = persistence.DeleteById("", doc1["Id"])
+	assert.Nil(t, err)
+	assert.Equal(t, doc1["Id"], result.(map[string]interface{})["Id"])
+
+	result, err = persistence.GetOneById("", doc1["Id"])
+	assert.Nil(t, err)
+	assert.Nil(t, result)
+
+	count, err := persistence.GetCountByFilter("", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+}
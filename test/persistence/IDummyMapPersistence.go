@@ -1,6 +1,9 @@
 package test_persistence
 
-import cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+import (
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	"go.mongodb.org/mongo-driver/bson"
+)
 
 // extends IGetter<DummyMap, String>, IWriter<DummyMap, String>, IPartialUpdater<DummyMap, String> {
 type IDummyMapPersistence interface {
@@ -9,8 +12,12 @@ type IDummyMapPersistence interface {
 	GetOneById(correlationId string, id string) (item map[string]interface{}, err error)
 	Create(correlationId string, item map[string]interface{}) (result map[string]interface{}, err error)
 	Update(correlationId string, item map[string]interface{}) (result map[string]interface{}, err error)
+	ReplaceById(correlationId string, item map[string]interface{}) (result map[string]interface{}, err error)
 	UpdatePartially(correlationId string, id string, data *cdata.AnyValueMap) (item map[string]interface{}, err error)
+	ModifyById(correlationId string, id string, update bson.M) (item map[string]interface{}, err error)
 	DeleteById(correlationId string, id string) (item map[string]interface{}, err error)
-	DeleteByIds(correlationId string, ids []string) (err error)
+	DeleteByIds(correlationId string, ids []string) (count int64, err error)
 	GetCountByFilter(correlationId string, filter *cdata.FilterParams) (count int64, err error)
+	GetNearByFilter(correlationId string, filter interface{}, field string, lng float64, lat float64, maxMeters float64,
+		paging *cdata.PagingParams) (page *cdata.DataPage, err error)
 }
@@ -1,16 +1,57 @@
 package test_persistence
 
-import cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+import (
+	"io"
+
+	cdata "github.com/pip-services3-go/pip-services3-commons-go/data"
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
 
 // extends IGetter<Dummy, String>, IWriter<Dummy, String>, IPartialUpdater<Dummy, String> {
 type IDummyPersistence interface {
 	GetPageByFilter(correlationId string, filter *cdata.FilterParams, paging *cdata.PagingParams) (page *DummyPage, err error)
+	GetPageByFilterEx(correlationId string, filter interface{}, paging *cdata.PagingParams, sort interface{}, sel interface{}) (page *persist.DataPageEx, err error)
+	GetPageByFilterWithCursor(correlationId string, filter interface{}, afterId interface{}, limit int64, sort interface{}) (page *persist.CursorPage, err error)
+	SearchByText(correlationId string, searchText string, paging *cdata.PagingParams) (page *cdata.DataPage, err error)
 	GetListByIds(correlationId string, ids []string) (items []Dummy, err error)
+	GetListByIdsOrdered(correlationId string, ids []string) (items []*Dummy, err error)
 	GetOneById(correlationId string, id string) (item Dummy, err error)
+	GetOneByIdWithProjection(correlationId string, id string, projection interface{}) (item Dummy, err error)
 	Create(correlationId string, item Dummy) (result Dummy, err error)
+	CreateIfAbsent(correlationId string, item Dummy) (result Dummy, err error)
+	CreateMany(correlationId string, items []Dummy) (result []Dummy, err error)
 	Update(correlationId string, item Dummy) (result Dummy, err error)
 	UpdatePartially(correlationId string, id string, data *cdata.AnyValueMap) (item Dummy, err error)
+	UpdateReturnBefore(correlationId string, item Dummy) (result Dummy, err error)
+	UpdatePartiallyReturnBefore(correlationId string, id string, data *cdata.AnyValueMap) (item Dummy, err error)
+	UpsertPartially(correlationId string, id string, data *cdata.AnyValueMap) (item Dummy, err error)
+	Set(correlationId string, item interface{}) (result interface{}, err error)
+	ReplaceById(correlationId string, item interface{}) (result interface{}, err error)
+	UpdateManyByFilter(correlationId string, filter interface{}, update *cdata.AnyValueMap) (count int64, err error)
 	DeleteById(correlationId string, id string) (item Dummy, err error)
-	DeleteByIds(correlationId string, ids []string) (err error)
+	DeleteByIds(correlationId string, ids []string) (count int64, err error)
+	DeleteCountByFilter(correlationId string, filter interface{}) (count int64, err error)
 	GetCountByFilter(correlationId string, filter *cdata.FilterParams) (count int64, err error)
+	GetListByFilterWithLimit(correlationId string, filter interface{}, sort interface{}, sel interface{}, limit int64) (items []interface{}, err error)
+	GetCountByFilterWithLimit(correlationId string, filter interface{}, limit int64) (count int64, err error)
+	GetEstimatedCount(correlationId string) (count int64, err error)
+	BulkWrite(correlationId string, operations []mongo.WriteModel, ordered bool) (result *mongo.BulkWriteResult, err error)
+	Aggregate(correlationId string, pipeline []bson.M, opts *options.AggregateOptions) (items []interface{}, err error)
+	GetDistinct(correlationId string, fieldName string, filter interface{}) (values []interface{}, err error)
+	GetDistinctCount(correlationId string, fieldName string, filter interface{}) (count int64, err error)
+	GetOneByFilter(correlationId string, filter interface{}, sort interface{}) (item interface{}, err error)
+	ClaimNext(correlationId string, filter interface{}, claimUpdate bson.M, sort interface{}) (item interface{}, err error)
+	ReplaceByFilter(correlationId string, filter interface{}, item interface{}, upsert bool) (result interface{}, err error)
+	ExportToWriter(correlationId string, filter interface{}, w io.Writer) (count int64, err error)
+	ImportFromReader(correlationId string, r io.Reader, batchSize int) (count int64, err error)
+	StreamByFilter(correlationId string, filter interface{}, sort interface{}, sel interface{}, fn func(item interface{}) error) (err error)
+	IterateByFilter(correlationId string, filter interface{}, sort interface{}) (<-chan interface{}, <-chan error)
+	Explain(correlationId string, filter interface{}, verbosity string) (result bson.M, err error)
+	Exists(correlationId string, filter interface{}) (exists bool, err error)
+	GetDeleted(correlationId string, filter interface{}, sort interface{}) (items []interface{}, err error)
+	Purge(correlationId string, filter interface{}) error
+	WatchChanges(correlationId string, handler func(changeEvent bson.M) error) (stop func(), err error)
 }
@@ -0,0 +1,24 @@
+package test_persistence
+
+import (
+	"testing"
+
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestComposeIndexKeys(t *testing.T) {
+	keys := persist.ComposeIndexKeys([]persist.IndexField{
+		{Name: "key", Direction: -1},
+		{Name: "content"},
+		{Name: "create_time", Direction: 1},
+	})
+	assert.Equal(t, bson.D{
+		{Key: "key", Value: -1},
+		{Key: "content", Value: 1},
+		{Key: "create_time", Value: 1},
+	}, keys)
+
+	assert.Equal(t, bson.D{}, persist.ComposeIndexKeys(nil))
+}
@@ -0,0 +1,61 @@
+package test_persistence
+
+import (
+	"bytes"
+	"testing"
+
+	cerror "github.com/pip-services3-go/pip-services3-commons-go/errors"
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestMongoDbGridFsPersistence(t *testing.T) {
+	dbConfig := getTestConfig(t,
+		"bucket", "attachments",
+		"options.chunk_size", "1024",
+	)
+
+	persistence := persist.NewMongoDbGridFsPersistence("")
+	persistence.Configure(dbConfig)
+	assert.Equal(t, "attachments", persistence.BucketName)
+
+	// Operations fail before the component is opened
+	_, err := persistence.Upload("", "closed.txt", bytes.NewReader([]byte("data")), nil)
+	assert.NotNil(t, err)
+
+	opnErr := persistence.Open("")
+	if opnErr != nil {
+		t.Error("Error opened persistence", opnErr)
+		return
+	}
+	defer persistence.Close("")
+
+	// Content spans several chunks
+	content := bytes.Repeat([]byte("0123456789"), 500)
+	fileId, err := persistence.Upload("", "test.txt", bytes.NewReader(content), bson.M{"owner": "test"})
+	assert.Nil(t, err)
+	assert.NotNil(t, fileId)
+
+	var buffer bytes.Buffer
+	err = persistence.Download("", fileId, &buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, content, buffer.Bytes())
+
+	err = persistence.Delete("", fileId)
+	assert.Nil(t, err)
+
+	// Deleted file is not found
+	buffer.Reset()
+	err = persistence.Download("", fileId, &buffer)
+	assert.NotNil(t, err)
+	appErr, ok := err.(*cerror.ApplicationError)
+	assert.True(t, ok)
+	if ok {
+		assert.Equal(t, "FILE_NOT_FOUND", appErr.Code)
+	}
+
+	// Deleting a missing file succeeds
+	err = persistence.Delete("", fileId)
+	assert.Nil(t, err)
+}
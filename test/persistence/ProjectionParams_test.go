@@ -0,0 +1,29 @@
+package test_persistence
+
+import (
+	"testing"
+
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestProjectionParamsInclude(t *testing.T) {
+	projection, err := persist.NewProjectionParams().Include("key", "content").Exclude("_id").ToBson()
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"key": 1, "content": 1, "_id": 0}, projection)
+}
+
+func TestProjectionParamsExclude(t *testing.T) {
+	projection, err := persist.NewProjectionParams().Exclude("content").ToBson()
+	assert.Nil(t, err)
+	assert.Equal(t, bson.M{"content": 0}, projection)
+}
+
+func TestProjectionParamsMixing(t *testing.T) {
+	_, err := persist.NewProjectionParams().Include("key").Exclude("content").ToBson()
+	assert.NotNil(t, err)
+
+	_, err = persist.NewProjectionParams().Exclude("content").Include("key").ToBson()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,17 @@
+package test_persistence
+
+import (
+	"testing"
+
+	persist "github.com/pip-services3-go/pip-services3-mongodb-go/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSortParams(t *testing.T) {
+	sort := persist.NewSortParams().Desc("key").Asc("content").ToBson()
+	assert.Equal(t, bson.D{
+		{Key: "key", Value: -1},
+		{Key: "content", Value: 1},
+	}, sort)
+}